@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertState はジョブの失敗の通知の重複の排除・まとめ・復旧の状態です
+type alertState struct {
+	mu      sync.Mutex
+	seen    map[string]time.Time      // 重複を排除する通知のキー → 最後に送信した時刻
+	groups  map[string][]Notification // ジョブの種類（サイト）ごとにまとめている失敗の通知
+	failing map[string]bool           // 失敗を通知して、まだ成功していないジョブの種類
+}
+
+// rateState は通知先ごとの送信の回数の制限の状態です
+type rateState struct {
+	mu      sync.Mutex
+	sent    map[string][]time.Time // 通知先ごとの直近1時間の送信時刻
+	dropped map[string]int         // 通知先ごとに制限のため送信しなかった通知の数
+}
+
+func alertKey(note Notification) string {
+	return note.JobType + "\x00" + note.Account + "\x00" + note.Message
+}
+
+// Alert はジョブの失敗を通知します
+// dedupeWindow の間に同じ内容の通知は1回だけ送信し、groupWindow の間に同じジョブの種類で失敗した通知は1つにまとめて送信します
+func (n *Notifiers) Alert(note Notification) {
+	now := n.now()
+	key := note.key
+	if key == "" {
+		key = alertKey(note)
+	}
+	n.alerts.mu.Lock()
+	if last, ok := n.alerts.seen[key]; ok && now.Sub(last) < n.dedupeWindow {
+		n.alerts.mu.Unlock()
+		log.Printf("同じ内容の通知を %s 以内に送信したため、通知しません: %s", n.dedupeWindow, note.Message)
+		return
+	}
+	n.alerts.seen[key] = now
+	for k, last := range n.alerts.seen {
+		if now.Sub(last) >= n.dedupeWindow {
+			delete(n.alerts.seen, k)
+		}
+	}
+	n.alerts.failing[note.JobType] = true
+	if n.groupWindow <= 0 {
+		n.alerts.mu.Unlock()
+		n.Notify(context.Background(), note)
+		return
+	}
+	pending := n.alerts.groups[note.JobType]
+	n.alerts.groups[note.JobType] = append(pending, note)
+	n.alerts.mu.Unlock()
+	if len(pending) == 0 {
+		time.AfterFunc(n.groupWindow, func() { n.flushGroup(note.JobType) })
+	}
+}
+
+// flushGroup はまとめている失敗の通知を送信します。複数ある場合は1つの通知にまとめます
+func (n *Notifiers) flushGroup(jobType string) {
+	n.alerts.mu.Lock()
+	notes := n.alerts.groups[jobType]
+	delete(n.alerts.groups, jobType)
+	n.alerts.mu.Unlock()
+	switch len(notes) {
+	case 0:
+		return
+	case 1:
+		n.Notify(context.Background(), notes[0])
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s で %d 件のジョブが失敗しました。", jobType, len(notes))
+	for _, note := range notes {
+		account := note.Account
+		if account == "" {
+			account = note.JobID
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", account, note.Message)
+	}
+	n.Notify(context.Background(), Notification{Severity: severityError, JobType: jobType, Message: b.String(), Time: notes[len(notes)-1].Time})
+}
+
+// Recover はジョブの成功を記録し、失敗を通知していたジョブの種類であれば復旧を通知します
+func (n *Notifiers) Recover(jobType, account string) {
+	n.alerts.mu.Lock()
+	failing := n.alerts.failing[jobType]
+	delete(n.alerts.failing, jobType)
+	if failing {
+		// 復旧した後の失敗は改めて通知する
+		for k := range n.alerts.seen {
+			if strings.HasPrefix(k, jobType+"\x00") {
+				delete(n.alerts.seen, k)
+			}
+		}
+	}
+	n.alerts.mu.Unlock()
+	if !failing {
+		return
+	}
+	// まとめている失敗の通知を先に送信する
+	n.flushGroup(jobType)
+	message := fmt.Sprintf("%s のジョブが成功し、復旧しました。", jobType)
+	if account != "" {
+		message = fmt.Sprintf("%s のジョブ（%s）が成功し、復旧しました。", jobType, account)
+	}
+	n.Notify(context.Background(), Notification{Severity: severityInfo, JobType: jobType, Account: account, Message: message})
+}
+
+// allow は通知先に送信してよいかどうかを返します
+// 直近1時間の送信が rateLimit 回に達している場合は送信せず、送信しなかった数を数えます
+// 送信してよい場合は、前回までに送信しなかった数を返します
+func (n *Notifiers) allow(name string, now time.Time) (bool, int) {
+	if n.rateLimit <= 0 {
+		return true, 0
+	}
+	n.rate.mu.Lock()
+	defer n.rate.mu.Unlock()
+	sent := n.rate.sent[name]
+	for len(sent) > 0 && now.Sub(sent[0]) >= time.Hour {
+		sent = sent[1:]
+	}
+	if len(sent) >= n.rateLimit {
+		n.rate.sent[name] = sent
+		n.rate.dropped[name]++
+		return false, 0
+	}
+	n.rate.sent[name] = append(sent, now)
+	dropped := n.rate.dropped[name]
+	delete(n.rate.dropped, name)
+	return true, dropped
+}
+
+// notifyJobFinished はジョブの終了時に呼び出し、成功したジョブの種類が失敗していた場合は復旧を通知します
+// 成功を通知するアカウントの場合は成功も通知します。n はジョブの開始時の通知先です（初期化されていない場合は nil）
+func notifyJobFinished(n *Notifiers, job *Job) {
+	info := job.Info()
+	if n == nil || info.Status != JobSucceeded {
+		return
+	}
+	n.Recover(info.Type, info.Account)
+	notifyJobSucceeded(n, job)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testAlertNotifiers は受け取った通知のメッセージを返す webhook の通知先を1つだけ持つ Notifiers を作成します
+func testAlertNotifiers(t *testing.T, c NotifyConfig) (*Notifiers, func() []string, *time.Time) {
+	t.Helper()
+	webhook, received := jsonReceiver(t, http.StatusOK)
+	c.Channels = map[string]NotifierConfig{"webhook": {Type: notifierWebhook, URL: webhook.URL}}
+	n, err := NewNotifiers(c, LineWorksConfig{})
+	assert.Nil(t, err)
+	now := time.Date(2026, 10, 17, 6, 0, 0, 0, time.Local)
+	n.now = func() time.Time { return now }
+	return n, func() []string {
+		var messages []string
+		for _, payload := range received() {
+			messages = append(messages, payload["message"].(string))
+		}
+		return messages
+	}, &now
+}
+
+func TestAlertDedupe(t *testing.T) {
+	n, messages, now := testAlertNotifiers(t, NotifyConfig{DedupeWindowSeconds: 600})
+	failure := Notification{Severity: severityError, JobType: jobTypeGeneralCsv, Account: "honsha", Message: "スクレイピング中にエラーが発生しました: ログインに失敗しました"}
+
+	n.Alert(failure)
+	n.Alert(failure)
+	other := failure
+	other.Account = "shiten"
+	n.Alert(other)
+	assert.Len(t, messages(), 2)
+
+	// 時間が経てば同じ内容でも改めて通知する
+	*now = now.Add(10 * time.Minute)
+	n.Alert(failure)
+	assert.Len(t, messages(), 3)
+
+	// 成功して復旧を通知したら、同じ内容の失敗も改めて通知する
+	n.Recover(jobTypeGeneralCsv, "honsha")
+	n.Alert(failure)
+	assert.Equal(t, []string{
+		failure.Message,
+		failure.Message,
+		failure.Message,
+		"GeneralCsv のジョブ（honsha）が成功し、復旧しました。",
+		failure.Message,
+	}, messages())
+}
+
+func TestAlertGroup(t *testing.T) {
+	n, messages, _ := testAlertNotifiers(t, NotifyConfig{})
+	n.groupWindow = 50 * time.Millisecond
+
+	// 同じサイトの失敗は1つの通知にまとめる
+	for _, account := range []string{"etc-honsha", "etc-shiten", "etc-eigyo"} {
+		n.Alert(Notification{Severity: severityError, JobType: jobTypeEtcMeisai, Account: account, Message: "ログイン画面が表示されません"})
+	}
+	n.Alert(Notification{Severity: severityError, JobType: jobTypeGeneralCsv, Account: "honsha", Message: "タイムアウトしました"})
+	assert.Empty(t, messages())
+	assert.Eventually(t, func() bool { return len(messages()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{
+		"etc-meisai で 3 件のジョブが失敗しました。\n- etc-honsha: ログイン画面が表示されません\n- etc-shiten: ログイン画面が表示されません\n- etc-eigyo: ログイン画面が表示されません",
+		"タイムアウトしました",
+	}, messages())
+
+	// まとめている間に成功した場合は、まとめた失敗を送信してから復旧を通知する
+	n.Alert(Notification{Severity: severityError, JobType: jobTypeEtcMeisai, Account: "etc-honsha", JobID: "1", Message: "CSVが空です"})
+	n.Recover(jobTypeEtcMeisai, "")
+	assert.Equal(t, []string{"CSVが空です", "etc-meisai のジョブが成功し、復旧しました。"}, messages()[2:])
+
+	// 失敗していないジョブの種類の成功は通知しない
+	n.Recover(jobTypeEtcMeisai, "")
+	n.Recover("kintone", "")
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, messages(), 4)
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	n, messages, now := testAlertNotifiers(t, NotifyConfig{RateLimitPerHour: 2})
+	for _, message := range []string{"1", "2", "3", "4"} {
+		assert.Nil(t, n.Notify(context.Background(), Notification{Severity: severityError, Message: message}))
+	}
+	assert.Equal(t, []string{"1", "2"}, messages())
+
+	// 1時間経てば送信し、送信しなかった数を書き添える
+	*now = now.Add(time.Hour)
+	assert.Nil(t, n.Notify(context.Background(), Notification{Severity: severityError, Message: "5"}))
+	assert.Nil(t, n.Notify(context.Background(), Notification{Severity: severityError, Message: "6"}))
+	assert.Equal(t, []string{"1", "2", "5\n（送信の回数の上限のため、2 件の通知を送信しませんでした）", "6"}, messages())
+}
+
+func TestNotifyJobFinished(t *testing.T) {
+	n, messages, _ := testAlertNotifiers(t, NotifyConfig{DedupeWindowSeconds: 600})
+	old := notifiers
+	t.Cleanup(func() { notifiers = old })
+	notifiers = n
+	store := NewJobStore(t.TempDir())
+
+	fail := func(ctx context.Context, job *Job) error {
+		err := errors.New("タイムアウト")
+		notifyJobError(job, "スクレイピング中にエラーが発生しました: タイムアウト", err)
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		job := store.Start(jobTypeGeneralCsv, "honsha", fail)
+		assert.Eventually(t, func() bool { return job.Info().EndedAt != nil }, 5*time.Second, 10*time.Millisecond)
+	}
+	// 同じ失敗は1回だけ通知し、成功したら復旧を通知する
+	job := store.Start(jobTypeGeneralCsv, "honsha", func(ctx context.Context, job *Job) error { return nil })
+	assert.Eventually(t, func() bool { return len(messages()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, JobSucceeded, job.Info().Status)
+	assert.Equal(t, []string{"スクレイピング中にエラーが発生しました: タイムアウト", "GeneralCsv のジョブ（honsha）が成功し、復旧しました。"}, messages())
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+var errBrowserPoolClosed = errors.New("ブラウザプールは停止済みです")
+
+// browserPool はサーバー起動時に作成し、全ジョブで共有するブラウザプールです
+var browserPool *BrowserPool
+
+// pooledBrowser はプールが管理するブラウザ1つ分の状態です
+type pooledBrowser struct {
+	browser playwright.Browser
+	jobs    int         // このブラウザで実行したジョブ数
+	crashed atomic.Bool // ブラウザが切断（クラッシュ）したかどうか
+}
+
+// BrowserPool は起動済みのブラウザを使い回し、ジョブごとに新しい BrowserContext を払い出します
+// ブラウザは最大 size 個まで起動し、maxJobs 回使ったものやクラッシュしたものは作り直します
+type BrowserPool struct {
+	launch  func() (playwright.Browser, error)
+	maxJobs int
+	slots   chan *pooledBrowser // 空きスロット。browser が nil のスロットは未起動
+	mu      sync.Mutex
+	all     map[*pooledBrowser]struct{}
+	closed  bool
+}
+
+// NewBrowserPool はブラウザプールを作成します
+// ブラウザは最初に Acquire されたときに起動します
+func NewBrowserPool(launch func() (playwright.Browser, error), size, maxJobs int) *BrowserPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &BrowserPool{
+		launch:  launch,
+		maxJobs: maxJobs,
+		slots:   make(chan *pooledBrowser, size),
+		all:     make(map[*pooledBrowser]struct{}),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- &pooledBrowser{}
+	}
+	return p
+}
+
+// BrowserLease はプールから借りたブラウザと、そのジョブ専用の BrowserContext です
+// 使い終わったら必ず Release を呼び出してください
+type BrowserLease struct {
+	Context   playwright.BrowserContext
+	pool      *BrowserPool
+	pb        *pooledBrowser
+	once      sync.Once
+	closeOnce sync.Once
+	stop      func() bool // ctx のキャンセル監視を解除する
+
+	hooksMu     sync.Mutex
+	beforeClose []func() // BrowserContext を閉じる前に呼び出す関数
+}
+
+// Acquire は空いているブラウザを借り、新しい BrowserContext を作成します
+// 空きがない場合は他のジョブが Release するか ctx がキャンセルされるまで待機します
+// 借りている間に ctx がキャンセルされると BrowserContext を閉じ、実行中の Playwright の操作を中断させます
+func (p *BrowserPool) Acquire(ctx context.Context) (*BrowserLease, error) {
+	var pb *pooledBrowser
+	select {
+	case slot, ok := <-p.slots:
+		if !ok {
+			return nil, errBrowserPoolClosed
+		}
+		pb = slot
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if pb.browser == nil {
+		if err := p.start(pb); err != nil {
+			p.returnSlot(pb)
+			return nil, err
+		}
+	}
+	bctx, err := pb.browser.NewContext(playwright.BrowserNewContextOptions{
+		AcceptDownloads: playwright.Bool(true),
+	})
+	if err != nil {
+		// コンテキストが作れないブラウザは壊れているとみなして作り直す
+		pb.crashed.Store(true)
+		p.put(pb)
+		return nil, fmt.Errorf("BrowserContextの作成に失敗しました: %w", err)
+	}
+	lease := &BrowserLease{Context: bctx, pool: p, pb: pb}
+	lease.stop = context.AfterFunc(ctx, func() {
+		log.Println("ジョブがキャンセルされたため、BrowserContextを閉じます。")
+		lease.closeContext()
+	})
+	return lease, nil
+}
+
+// Release は BrowserContext を閉じ、ブラウザをプールに返却します
+func (l *BrowserLease) Release() {
+	l.once.Do(func() {
+		l.stop()
+		l.closeContext()
+		l.pb.jobs++
+		l.pool.put(l.pb)
+	})
+}
+
+// BeforeClose は BrowserContext を閉じる前に呼び出す関数を登録します
+// ジョブのキャンセルで閉じる場合も、Release で閉じる場合も呼び出します
+func (l *BrowserLease) BeforeClose(fn func()) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	l.beforeClose = append(l.beforeClose, fn)
+}
+
+// closeContext は BrowserContext を1度だけ閉じます
+func (l *BrowserLease) closeContext() {
+	l.closeOnce.Do(func() {
+		l.hooksMu.Lock()
+		hooks := l.beforeClose
+		l.hooksMu.Unlock()
+		for _, fn := range hooks {
+			fn()
+		}
+		if err := l.Context.Close(); err != nil {
+			log.Printf("BrowserContextのクローズに失敗しました: %v", err)
+		}
+	})
+}
+
+// Close はプール内の全てのブラウザを閉じます
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.slots)
+	browsers := make([]*pooledBrowser, 0, len(p.all))
+	for pb := range p.all {
+		browsers = append(browsers, pb)
+	}
+	p.mu.Unlock()
+
+	for _, pb := range browsers {
+		if err := pb.browser.Close(); err != nil {
+			log.Printf("ブラウザのクローズに失敗しました: %v", err)
+		}
+	}
+}
+
+// start はスロットにブラウザを起動します
+func (p *BrowserPool) start(pb *pooledBrowser) error {
+	log.Println("ブラウザを起動しています...")
+	browser, err := p.launch()
+	if err != nil {
+		return fmt.Errorf("ブラウザの起動に失敗しました: %w", err)
+	}
+	pb.browser = browser
+	pb.jobs = 0
+	pb.crashed.Store(false)
+	browser.OnDisconnected(func(playwright.Browser) {
+		log.Println("ブラウザが切断されました。次回の利用時に再起動します。")
+		pb.crashed.Store(true)
+	})
+	p.mu.Lock()
+	p.all[pb] = struct{}{}
+	p.mu.Unlock()
+	return nil
+}
+
+// put はブラウザをスロットに戻します
+// 使用回数が上限に達したものやクラッシュしたものは閉じて、未起動のスロットとして戻します
+func (p *BrowserPool) put(pb *pooledBrowser) {
+	recycle := pb.crashed.Load() || !pb.browser.IsConnected() || (p.maxJobs > 0 && pb.jobs >= p.maxJobs)
+	if recycle {
+		log.Printf("ブラウザを再起動のため破棄します（ジョブ数: %d, クラッシュ: %v）", pb.jobs, pb.crashed.Load())
+		if err := pb.browser.Close(); err != nil {
+			log.Printf("ブラウザのクローズに失敗しました: %v", err)
+		}
+		p.mu.Lock()
+		delete(p.all, pb)
+		p.mu.Unlock()
+		pb = &pooledBrowser{}
+	}
+	p.returnSlot(pb)
+}
+
+// returnSlot はスロットを空きとして戻します。停止済みのプールには戻しません
+func (p *BrowserPool) returnSlot(pb *pooledBrowser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	// スロット数は固定なのでチャネルが満杯になることはない
+	p.slots <- pb
+}
+
+// initBrowserPool は Playwright のランタイムを起動し、共有ブラウザプールを作成します
+// サーバー起動時に1度だけ呼び出します
+func initBrowserPool() error {
+	err := playwright.Install()
+	if err != nil {
+		return fmt.Errorf("Playwright のインストールに失敗しました: %w", err)
+	}
+	log.Println("Playwright ブラウザがインストールされました！")
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return fmt.Errorf("Playwright の起動に失敗しました: %w", err)
+	}
+	size := cfg.Browser.PoolSize
+	maxJobs := cfg.Browser.MaxJobs
+	browserPool = NewBrowserPool(func() (playwright.Browser, error) {
+		return pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+			Headless: playwright.Bool(cfg.Browser.Headless), // ヘッドレスモードを有効にする場合はtrue、GUIを表示したい場合はfalseに設定
+		})
+	}, size, maxJobs)
+	log.Printf("ブラウザプールを作成しました（サイズ: %d, 再起動までのジョブ数: %d）", size, maxJobs)
+	return nil
+}
+
+// acquireBrowser は共有ブラウザプールからブラウザを借ります
+func acquireBrowser(ctx context.Context) (*BrowserLease, error) {
+	if browserPool == nil {
+		return nil, errors.New("ブラウザプールが初期化されていません")
+	}
+	return browserPool.Acquire(ctx)
+}
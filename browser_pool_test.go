@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBrowser はブラウザプールのテスト用に playwright.Browser の一部だけを実装したモックです
+type fakeBrowser struct {
+	playwright.Browser
+	mu           sync.Mutex
+	closed       bool
+	connected    bool
+	disconnected func(playwright.Browser)
+	contexts     int
+}
+
+func (b *fakeBrowser) NewContext(options ...playwright.BrowserNewContextOptions) (playwright.BrowserContext, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.connected {
+		return nil, errors.New("browser has been closed")
+	}
+	b.contexts++
+	return &fakeBrowserContext{}, nil
+}
+
+func (b *fakeBrowser) Close(options ...playwright.BrowserCloseOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.connected = false
+	return nil
+}
+
+func (b *fakeBrowser) IsConnected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connected
+}
+
+func (b *fakeBrowser) OnDisconnected(fn func(playwright.Browser)) {
+	b.disconnected = fn
+}
+
+// crash はブラウザプロセスのクラッシュを再現します
+func (b *fakeBrowser) crash() {
+	b.mu.Lock()
+	b.connected = false
+	b.mu.Unlock()
+	b.disconnected(b)
+}
+
+type fakeBrowserContext struct {
+	playwright.BrowserContext
+	closed atomic.Bool
+}
+
+func (c *fakeBrowserContext) Close(options ...playwright.BrowserContextCloseOptions) error {
+	c.closed.Store(true)
+	return nil
+}
+
+// fakeLauncher は起動したブラウザを記録するランチャーです
+type fakeLauncher struct {
+	mu       sync.Mutex
+	browsers []*fakeBrowser
+}
+
+func (l *fakeLauncher) launch() (playwright.Browser, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := &fakeBrowser{connected: true}
+	l.browsers = append(l.browsers, b)
+	return b, nil
+}
+
+func (l *fakeLauncher) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.browsers)
+}
+
+func TestBrowserPoolReusesBrowser(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		lease, err := pool.Acquire(context.Background())
+		assert.Nil(t, err)
+		lease.Release()
+		assert.True(t, lease.Context.(*fakeBrowserContext).closed.Load(), "BrowserContext should be closed on release")
+	}
+	assert.Equal(t, 1, launcher.count(), "Browser should be launched only once")
+	assert.Equal(t, 3, launcher.browsers[0].contexts)
+}
+
+func TestBrowserPoolRecyclesAfterMaxJobs(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 2)
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		lease, err := pool.Acquire(context.Background())
+		assert.Nil(t, err)
+		lease.Release()
+	}
+	assert.Equal(t, 2, launcher.count(), "Browser should be relaunched after max jobs")
+	assert.True(t, launcher.browsers[0].closed, "Recycled browser should be closed")
+}
+
+func TestBrowserPoolRecyclesAfterCrash(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	defer pool.Close()
+
+	lease, err := pool.Acquire(context.Background())
+	assert.Nil(t, err)
+	launcher.browsers[0].crash()
+	lease.Release()
+
+	lease, err = pool.Acquire(context.Background())
+	assert.Nil(t, err)
+	lease.Release()
+	assert.Equal(t, 2, launcher.count(), "Crashed browser should be relaunched")
+}
+
+func TestBrowserPoolBlocksWhenExhausted(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background())
+	assert.Nil(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := pool.Acquire(context.Background())
+		assert.Nil(t, err)
+		second.Release()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block while the only browser is in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire should succeed after the browser is released")
+	}
+}
+
+func TestBrowserPoolClosed(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	lease, err := pool.Acquire(context.Background())
+	assert.Nil(t, err)
+	pool.Close()
+	assert.True(t, launcher.browsers[0].closed)
+	lease.Release()
+
+	_, err = pool.Acquire(context.Background())
+	assert.ErrorIs(t, err, errBrowserPoolClosed)
+}
+
+func TestBrowserPoolAcquireCanceledWhileWaiting(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background())
+	assert.Nil(t, err)
+	defer first.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBrowserPoolCancelClosesContext(t *testing.T) {
+	launcher := &fakeLauncher{}
+	pool := NewBrowserPool(launcher.launch, 1, 0)
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lease, err := pool.Acquire(ctx)
+	assert.Nil(t, err)
+	bctx := lease.Context.(*fakeBrowserContext)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return bctx.closed.Load()
+	}, time.Second, 10*time.Millisecond, "BrowserContext should be closed when the job is canceled")
+	lease.Release()
+
+	// キャンセル後もブラウザはプールに戻り、再利用できる
+	lease, err = pool.Acquire(context.Background())
+	assert.Nil(t, err)
+	lease.Release()
+	assert.Equal(t, 1, launcher.count())
+}
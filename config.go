@@ -0,0 +1,471 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigFile = "./config.yaml"
+	configFileEnv     = "CONFIG_FILE"
+	configEnvPrefix   = "SCRAPER_" // 設定ファイルの項目を上書きする環境変数の接頭辞
+)
+
+// Config はサーバー全体の設定です
+// 設定ファイル（YAML）で指定し、各項目は環境変数で上書きできます
+// 環境変数名は env タグがあればその名前、なければ SCRAPER_ + YAMLのキーを大文字にして _ でつないだものです
+// 例: theearth.loginUrl → SCRAPER_THEEARTH_LOGINURL
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Dirs        DirsConfig        `yaml:"dirs"`
+	Browser     BrowserConfig     `yaml:"browser"`
+	Jobs        JobsConfig        `yaml:"jobs"`
+	TheEarth    TheEarthConfig    `yaml:"theearth"`
+	EtcMeisai   EtcMeisaiConfig   `yaml:"etcMeisai"`
+	LineWorks   LineWorksConfig   `yaml:"lineworks"`
+	Notify      NotifyConfig      `yaml:"notify"`
+	Credentials CredentialsConfig `yaml:"credentials"`
+	Sync        SyncConfig        `yaml:"sync"`
+	Outbox      OutboxConfig      `yaml:"outbox"`
+	Callback    CallbackConfig    `yaml:"callback"`
+	// Sinks は名前を付けて登録する送信先です（リクエストやスケジュールの sinks で {"name": "..."} として参照します）
+	Sinks map[string]SinkConfig `yaml:"sinks"`
+}
+
+// ServerConfig はHTTPサーバーの設定です
+type ServerConfig struct {
+	Port string `yaml:"port" env:"PORT"`
+}
+
+// DirsConfig はファイルの保存先の設定です
+type DirsConfig struct {
+	Jobs          string `yaml:"jobs" env:"JOBS_DIR"` // ジョブごとの作業ディレクトリを作成する場所
+	Legacy        string `yaml:"legacy"`              // ジョブ管理の外から呼び出された場合の保存先
+	Logs          string `yaml:"logs" env:"LOGS_DIR"` // アプリケーションログの保存先
+	LogMaxSizeMB  int    `yaml:"logMaxSizeMb"`        // ログファイルをローテーションするサイズ（MB）
+	LogMaxAgeDays int    `yaml:"logMaxAgeDays"`       // ログファイルを保持する日数
+	LogMaxBackups int    `yaml:"logMaxBackups"`       // 保持するバックアップログファイルの数
+}
+
+// BrowserConfig はブラウザプールの設定です
+type BrowserConfig struct {
+	PoolSize           int  `yaml:"poolSize" env:"BROWSER_POOL_SIZE"`               // 同時に起動しておくブラウザの数
+	MaxJobs            int  `yaml:"maxJobs" env:"BROWSER_MAX_JOBS"`                 // 1つのブラウザで実行するジョブ数の上限（0で無制限）
+	Headless           bool `yaml:"headless"`                                       // false にするとブラウザの画面を表示する
+	Tracing            bool `yaml:"tracing"`                                        // ジョブごとに Playwright のトレースを記録する
+	KeepTraceOnSuccess bool `yaml:"keepTraceOnSuccess" env:"KEEP_TRACE_ON_SUCCESS"` // 成功したジョブのトレースも保存する（既定では失敗したジョブだけ）
+}
+
+// JobsConfig はジョブ管理の設定です
+type JobsConfig struct {
+	RetentionHours int    `yaml:"retentionHours" env:"JOB_RETENTION_HOURS"` // 終了したジョブの作業ディレクトリを保持する時間
+	SchedulesFile  string `yaml:"schedulesFile" env:"SCHEDULES_FILE"`       // スケジュール定義ファイル
+}
+
+// TheEarthConfig は theearth-np.com（デジタコ）の設定です
+type TheEarthConfig struct {
+	LoginURL     string            `yaml:"loginUrl"`
+	Scenario     string            `yaml:"scenario"`     // 画面の操作手順のシナリオファイル（空の場合は組み込みのシナリオ）
+	PopupValue   string            `yaml:"popupValue"`   // 接続ユーザー確認ポップアップのボタンの値
+	IgnoredUsers []string          `yaml:"ignoredUsers"` // 接続ユーザー一覧でログに出さないユーザー
+	MaxRangeDays int               `yaml:"maxRangeDays"` // 1回のCSV出力で指定できる最大の日数（超える期間は分割して出力する。0で無制限）
+	MaxPastDays  int               `yaml:"maxPastDays"`  // 何日前までのデータを出力できるか（0で無制限）
+	Selectors    TheEarthSelectors `yaml:"selectors"`
+	Timeouts     TheEarthTimeouts  `yaml:"timeouts"`
+	TachoHeaders TachoHeaders      `yaml:"tachoHeaders"` // デジタコのCSVの見出し
+}
+
+// TachoHeaders はデジタコのCSVの種類ごとの、列と見出しの候補の対応です
+// 見出しは全角を半角にし、空白を除いて比較します
+// 既定の見出しは実際の出力で確認していないため、GeneralCsv の出力と異なる場合は設定ファイルで修正してください
+type TachoHeaders struct {
+	Operations map[string][]string `yaml:"operations"` // 運行データ（date・vehicle・driver・departure・return・distance）
+	Events     map[string][]string `yaml:"events"`     // 運転イベント（at・event・vehicle・driver・speed・location）
+	Stops      map[string][]string `yaml:"stops"`      // 停車・休憩（start・end・kind・vehicle・driver・location）
+}
+
+// TheEarthSelectors は theearth-np.com の画面のセレクターです
+// シナリオからは ${selectors.csv} のように参照します
+type TheEarthSelectors struct {
+	Popup      string `yaml:"popup"`
+	CompanyID  string `yaml:"companyId"`
+	UserID     string `yaml:"userId"`
+	Password   string `yaml:"password"`
+	Login      string `yaml:"login"`
+	Menu1      string `yaml:"menu1"` // ログイン後のメニュー
+	Menu2      string `yaml:"menu2"`
+	Menu3      string `yaml:"menu3"`
+	Select     string `yaml:"select"` // 出力対象の選択ラジオボタン
+	DateRange  string `yaml:"dateRange"`
+	StartYear  string `yaml:"startYear"`
+	StartMonth string `yaml:"startMonth"`
+	StartDay   string `yaml:"startDay"`
+	EndYear    string `yaml:"endYear"`
+	EndMonth   string `yaml:"endMonth"`
+	EndDay     string `yaml:"endDay"`
+	Csv        string `yaml:"csv"`
+	PopupRow   string `yaml:"popupRow"`
+	PopupCell  string `yaml:"popupCell"`
+}
+
+// TheEarthTimeouts は theearth-np.com の待機時間（ミリ秒）です
+type TheEarthTimeouts struct {
+	Click      int32 `yaml:"click"`      // メニューやポップアップのクリック
+	Popup      int32 `yaml:"popup"`      // ログイン後のポップアップの表示待機
+	PopupLoad  int32 `yaml:"popupLoad"`  // 接続ユーザー一覧のウィンドウの読み込み待機
+	Menu       int32 `yaml:"menu"`       // ログイン後のメニューの表示待機
+	AfterLogin int32 `yaml:"afterLogin"` // ログイン後の固定待機
+	DateForm   int32 `yaml:"dateForm"`   // 日付入力画面の表示待機
+	Download   int32 `yaml:"download"`   // CSVダウンロードの完了待機
+}
+
+// EtcMeisaiConfig は etc-meisai.jp の設定です
+type EtcMeisaiConfig struct {
+	LoginURL         string             `yaml:"loginUrl"`
+	Scenario         string             `yaml:"scenario"`         // 画面の操作手順のシナリオファイル（空の場合は組み込みのシナリオ）
+	MenuFuncCode     string             `yaml:"menuFuncCode"`     // ログイン後のページに含まれていればメニュー移動を行う
+	MenuScript       string             `yaml:"menuScript"`       // 検索画面へ移動するJavaScript
+	CardSelectScript string             `yaml:"cardSelectScript"` // 全てのカードを選択するJavaScript
+	CsvButtonValue   string             `yaml:"csvButtonValue"`   // CSV出力ボタンの value
+	SokoKbn          int                `yaml:"sokoKbn"`          // 利用区分のラジオボタンの value（リクエストの sokoKbn で上書きできる）
+	Cards            []string           `yaml:"cards"`            // 選択するETCカードの番号（空の場合は全てのカード。リクエストの cards で上書きできる）
+	Selectors        EtcMeisaiSelectors `yaml:"selectors"`
+	Timeouts         EtcMeisaiTimeouts  `yaml:"timeouts"`
+}
+
+// EtcMeisaiSelectors は etc-meisai.jp の画面の要素の name 属性です
+type EtcMeisaiSelectors struct {
+	Login     string `yaml:"login"`
+	LoginID   string `yaml:"loginId"`
+	Password  string `yaml:"password"`
+	Search    string `yaml:"search"`
+	FromYear  string `yaml:"fromYear"`
+	FromMonth string `yaml:"fromMonth"`
+	FromDay   string `yaml:"fromDay"`
+	ToYear    string `yaml:"toYear"`
+	ToMonth   string `yaml:"toMonth"`
+	ToDay     string `yaml:"toDay"`
+	SokoKbn   string `yaml:"sokoKbn"` // 利用区分のラジオボタン
+	Card      string `yaml:"card"`    // ETCカードのチェックボックス
+}
+
+// EtcMeisaiTimeouts は etc-meisai.jp の待機時間（ミリ秒）です
+type EtcMeisaiTimeouts struct {
+	Wait        int32 `yaml:"wait"`        // ログイン画面・検索画面の表示待機
+	AfterLogin  int32 `yaml:"afterLogin"`  // ログイン後の固定待機
+	AfterSearch int32 `yaml:"afterSearch"` // 検索後の固定待機
+	Download    int32 `yaml:"download"`    // CSVダウンロードの完了待機
+}
+
+// LineWorksConfig は LINE WORKS への通知の設定です
+// プロキシを使わずに Bot API を直接呼び出す場合は、Developer Console で発行したアプリ・サービスアカウント・秘密鍵・ボットを指定します
+type LineWorksConfig struct {
+	URL string `yaml:"url" env:"LINEWORKS_URL"` // LINE WORKS ボットのプロキシのURL（空の場合はプロキシを使わない）
+
+	ClientID       string `yaml:"clientId" env:"LINEWORKS_CLIENT_ID"`
+	ClientSecret   string `yaml:"clientSecret" env:"LINEWORKS_CLIENT_SECRET"`
+	ServiceAccount string `yaml:"serviceAccount" env:"LINEWORKS_SERVICE_ACCOUNT"`
+	PrivateKeyFile string `yaml:"privateKeyFile" env:"LINEWORKS_PRIVATE_KEY_FILE"` // サービスアカウントの秘密鍵（PEM）
+	BotID          string `yaml:"botId" env:"LINEWORKS_BOT_ID"`
+	ChannelID      string `yaml:"channelId"` // 既定の送信先のトークルーム
+	UserID         string `yaml:"userId"`    // 既定の送信先のユーザー（channelId がない場合）
+	AuthURL        string `yaml:"authUrl"`   // アクセストークンの取得先
+	APIURL         string `yaml:"apiUrl"`    // Bot API のURL
+
+	// BotSecret は /lineworks/callback で受け取るメッセージの署名（X-WORKS-Signature）の検証に使う Bot Secret です
+	BotSecret    string   `yaml:"botSecret" env:"LINEWORKS_BOT_SECRET"`
+	CommandUsers []string `yaml:"commandUsers"` // ボットのコマンドを実行できるユーザーのID（空の場合は全員）
+	CommandSinks []string `yaml:"commandSinks"` // ボットのコマンドで開始したジョブのファイルの送信先（sinks に登録した名前）
+}
+
+// NotifyConfig はエラーなどの通知先と振り分けのルールの設定です
+// 通知先を登録していない場合は lineworks.url のプロキシに全ての通知を送信します
+type NotifyConfig struct {
+	Channels map[string]NotifierConfig `yaml:"channels"` // 名前を付けて登録する通知先
+	Routes   []NotifyRoute             `yaml:"routes"`   // 通知先を選ぶルール（空の場合は全ての通知を全ての通知先に送信）
+
+	DedupeWindowSeconds int `yaml:"dedupeWindowSeconds"` // 同じ内容の失敗の通知を1回だけ送信する時間（秒）
+	GroupWindowSeconds  int `yaml:"groupWindowSeconds"`  // 同じジョブの種類の失敗を1つの通知にまとめる時間（秒、0でまとめない）
+	RateLimitPerHour    int `yaml:"rateLimitPerHour"`    // 通知先ごとの1時間の送信の回数の上限（0で無制限）
+
+	Templates  MessageTemplates               `yaml:"templates"`  // イベントごとのメッセージのテンプレート
+	Accounts   map[string]NotifyAccountConfig `yaml:"accounts"`   // ジョブの開始・成功を通知するアカウント
+	DigestCron string                         `yaml:"digestCron"` // 過去24時間のジョブの一覧を通知する cron 式（空の場合は通知しない）
+}
+
+// CredentialsConfig はエイリアスで登録したアカウントの保存先の設定です
+// 暗号化の鍵は環境変数 CREDENTIALS_KEY で指定します
+type CredentialsConfig struct {
+	File string `yaml:"file" env:"CREDENTIALS_FILE"` // 暗号化したアカウントファイル
+}
+
+// SyncConfig は incremental で使う同期日の設定です
+type SyncConfig struct {
+	File        string `yaml:"file" env:"SYNC_STATE_FILE"` // アカウント・サイトごとの同期日を保存するファイル
+	OverlapDays int    `yaml:"overlapDays"`                // 前回の同期日から何日分を重ねてダウンロードするか（0で同期日の翌日から）
+}
+
+// OutboxConfig は送信に失敗したファイルを再送する送信待ちの設定です
+type OutboxConfig struct {
+	Dir              string `yaml:"dir" env:"OUTBOX_DIR"` // 送信待ちのファイルを保存するディレクトリ
+	MaxAttempts      int    `yaml:"maxAttempts"`          // 最初の送信を含めた送信の回数の上限（超えた送信待ちは手動でのみ再送する）
+	BaseDelaySeconds int    `yaml:"baseDelaySeconds"`     // 1回目の再送までの時間（以降は2倍ずつ増やす）
+	MaxDelaySeconds  int    `yaml:"maxDelaySeconds"`      // 再送までの時間の上限
+	IntervalSeconds  int    `yaml:"intervalSeconds"`      // 再送の時刻を過ぎた送信待ちを確認する間隔
+	TimeoutSeconds   int    `yaml:"timeoutSeconds"`       // 1回の再送のタイムアウト（応答のない送信先で再送が止まらないようにする）
+}
+
+// CallbackConfig はジョブの結果を callbackUrl に送信する設定です
+type CallbackConfig struct {
+	Secret            string `yaml:"secret" env:"CALLBACK_SECRET"` // 署名（HMAC-SHA256）の鍵（空の場合は callbackUrl を使えません）
+	TimeoutSeconds    int    `yaml:"timeoutSeconds"`               // 1回の送信のタイムアウト
+	MaxAttempts       int    `yaml:"maxAttempts"`                  // 送信に失敗した場合に送り直す回数の上限（最初の送信を含む）
+	RetryDelaySeconds int    `yaml:"retryDelaySeconds"`            // 送り直すまでの時間（以降は2倍ずつ増やし、上限は callbackMaxRetryDelay）
+}
+
+// DefaultConfig は設定ファイルがない場合の既定の設定を返します
+func DefaultConfig() Config {
+	return Config{
+		Server: ServerConfig{Port: "8080"},
+		Dirs: DirsConfig{
+			Jobs:          "./jobs",
+			Legacy:        "./file",
+			Logs:          "./logs",
+			LogMaxSizeMB:  1,
+			LogMaxAgeDays: 28,
+			LogMaxBackups: 3,
+		},
+		Browser: BrowserConfig{PoolSize: 2, MaxJobs: 20, Headless: true, Tracing: true},
+		Jobs:    JobsConfig{RetentionHours: 72, SchedulesFile: "./schedules.json"},
+		TheEarth: TheEarthConfig{
+			LoginURL:     "http://theearth-np.com/F-OES1010[Login].aspx",
+			PopupValue:   "接続ユーザー確認",
+			IgnoredUsers: []string{"auto2", "auto1", "auto3", "autoload"},
+			MaxRangeDays: 31,
+			MaxPastDays:  365,
+			Selectors: TheEarthSelectors{
+				Popup:      "#popup_1",
+				CompanyID:  "#txtID2",
+				UserID:     "#txtID1",
+				Password:   "#txtPass",
+				Login:      "#imgLogin",
+				Menu1:      "#Button1st_2",
+				Menu2:      "#Button2nd_5",
+				Menu3:      "#Button3rd_0",
+				Select:     "#rdoSelect1",
+				DateRange:  "#rdoDate1",
+				StartYear:  "#MainContent_ucStartDate_txtYear",
+				StartMonth: "#MainContent_ucStartDate_txtMonth",
+				StartDay:   "#MainContent_ucStartDate_txtDay",
+				EndYear:    "#MainContent_ucEndDate_txtYear",
+				EndMonth:   "#MainContent_ucEndDate_txtMonth",
+				EndDay:     "#MainContent_ucEndDate_txtDay",
+				Csv:        "#btnCsv",
+				PopupRow:   "tr",
+				PopupCell:  "td",
+			},
+			Timeouts: TheEarthTimeouts{
+				Click:      3000,
+				Popup:      3000,
+				PopupLoad:  10000,
+				Menu:       10000,
+				AfterLogin: 3000,
+				DateForm:   10000,
+				Download:   60000,
+			},
+			TachoHeaders: TachoHeaders{
+				Operations: map[string][]string{
+					"date":      {"運行日", "運行年月日"},
+					"vehicle":   {"車両番号", "車番"},
+					"driver":    {"乗務員", "乗務員名", "運転者"},
+					"departure": {"出庫日時", "出発日時"},
+					"return":    {"帰庫日時", "帰着日時"},
+					"distance":  {"走行距離", "走行距離(km)"},
+				},
+				Events: map[string][]string{
+					"at":       {"発生日時", "日時"},
+					"event":    {"イベント", "イベント名", "事象"},
+					"vehicle":  {"車両番号", "車番"},
+					"driver":   {"乗務員", "乗務員名", "運転者"},
+					"speed":    {"速度", "速度(km/h)"},
+					"location": {"場所", "住所", "地点"},
+				},
+				Stops: map[string][]string{
+					"start":    {"開始日時", "停車開始", "停車開始日時"},
+					"end":      {"終了日時", "停車終了", "停車終了日時"},
+					"kind":     {"区分", "停車区分", "作業"},
+					"vehicle":  {"車両番号", "車番"},
+					"driver":   {"乗務員", "乗務員名", "運転者"},
+					"location": {"場所", "住所", "地点"},
+				},
+			},
+		},
+		EtcMeisai: EtcMeisaiConfig{
+			LoginURL:         "https://www2.etc-meisai.jp/etc/R?funccode=1013000000&nextfunc=1013000000",
+			MenuFuncCode:     "1014000000",
+			MenuScript:       "submitPage('frm','/etc/R?funccode=1014000000&nextfunc=1014000000')",
+			CardSelectScript: "allSelected('hyojiCard')",
+			CsvButtonValue:   "利用明細ＣＳＶ出力",
+			Cards:            []string{},
+			Selectors: EtcMeisaiSelectors{
+				Login:     "focusTarget",
+				LoginID:   "risLoginId",
+				Password:  "risPassword",
+				Search:    "focusTarget_Save",
+				FromYear:  "fromYYYY",
+				FromMonth: "fromMM",
+				FromDay:   "fromDD",
+				ToYear:    "toYYYY",
+				ToMonth:   "toMM",
+				ToDay:     "toDD",
+				SokoKbn:   "sokoKbn",
+				Card:      "hyojiCard",
+			},
+			Timeouts: EtcMeisaiTimeouts{
+				Wait:        10000,
+				AfterLogin:  3000,
+				AfterSearch: 7000,
+				Download:    60000,
+			},
+		},
+		LineWorks: LineWorksConfig{
+			URL:          "https://hono-lineworks-bot.mtamaramu.com/api/tasks",
+			AuthURL:      lineWorksAuthURL,
+			APIURL:       lineWorksAPIURL,
+			CommandUsers: []string{},
+			CommandSinks: []string{},
+		},
+		Notify: NotifyConfig{
+			Channels:            map[string]NotifierConfig{},
+			Routes:              []NotifyRoute{},
+			DedupeWindowSeconds: 30 * 60,
+			GroupWindowSeconds:  60,
+			RateLimitPerHour:    20,
+			Templates: MessageTemplates{
+				Started:        "{{.Type}} のジョブを開始しました{{if .Account}}（{{.Account}}）{{end}}。",
+				Succeeded:      "{{.Type}} のジョブが完了しました{{if .Account}}（{{.Account}}）{{end}}。{{if .From}}期間: {{.From}}〜{{.To}}、{{end}}{{.Files}} ファイル（{{size .Size}}）、{{.Rows}} 行、{{duration .Duration}}",
+				Failed:         "{{.Message}}",
+				DeliveryFailed: "{{.Type}} のファイルの送信に失敗しました{{if .Account}}（{{.Account}}）{{end}}: {{.Target}}: {{.Error}}{{if .Outbox}}（送信待ち {{.Outbox}} から再送します）{{end}}",
+				Digest:         defaultDigestTemplate,
+			},
+			Accounts: map[string]NotifyAccountConfig{},
+		},
+		Credentials: CredentialsConfig{File: "./credentials.enc"},
+		Sync:        SyncConfig{File: "./sync_state.json", OverlapDays: 1},
+		Outbox:      OutboxConfig{Dir: "./outbox", MaxAttempts: 10, BaseDelaySeconds: 60, MaxDelaySeconds: 6 * 60 * 60, IntervalSeconds: 30, TimeoutSeconds: 300},
+		Callback:    CallbackConfig{TimeoutSeconds: 10, MaxAttempts: 3, RetryDelaySeconds: 5},
+		Sinks:       map[string]SinkConfig{},
+	}
+}
+
+// defaultDigestTemplate は過去24時間のジョブの一覧の既定のテンプレートです
+const defaultDigestTemplate = `過去24時間のジョブ: 成功 {{.Succeeded}} 件、失敗 {{.Failed}} 件、その他 {{.Other}} 件
+{{range .Jobs}}- {{.Type}}{{if .Account}} {{.Account}}{{end}}: {{.Status}}{{if .Error}}（{{.Error}}）{{end}}
+{{end}}`
+
+// cfg はサーバー全体で参照する設定です。main で設定ファイルを読み込んで置き換えます
+var cfg = DefaultConfig()
+
+// LoadConfig は既定の設定に設定ファイルと環境変数の値を重ねて返します
+// 設定ファイルが存在しない場合は既定の設定と環境変数だけを使います
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("設定ファイル '%s' がないため、既定の設定を使用します。", path)
+	case err != nil:
+		return c, fmt.Errorf("設定ファイル '%s' の読み込みに失敗しました: %w", path, err)
+	default:
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return c, fmt.Errorf("設定ファイル '%s' の解析に失敗しました: %w", path, err)
+		}
+		log.Printf("設定ファイル '%s' を読み込みました。", path)
+	}
+	if err := applyEnvOverrides(reflect.ValueOf(&c).Elem(), configEnvPrefix); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// configPath は設定ファイルのパスを返します
+func configPath() string {
+	if path := os.Getenv(configFileEnv); path != "" {
+		return path
+	}
+	return defaultConfigFile
+}
+
+// applyEnvOverrides は構造体の各項目を対応する環境変数の値で上書きします
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fv, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+		if tag := field.Tag.Get("env"); tag != "" {
+			// 従来から使っている環境変数名があればそちらを優先する
+			if _, ok := os.LookupEnv(tag); ok {
+				name = tag
+			}
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFieldFromString(fv, value); err != nil {
+			return fmt.Errorf("環境変数 %s の値 '%s' が不正です: %w", name, value, err)
+		}
+	}
+	return nil
+}
+
+// setFieldFromString は文字列を項目の型に変換して設定します
+// スライスはカンマ区切りで指定します
+func setFieldFromString(fv reflect.Value, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("未対応の型です: %s", fv.Type())
+		}
+		parts := strings.Split(value, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		fv.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("未対応の型です: %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+server:
+  port: "9090"
+theearth:
+  loginUrl: http://localhost:3000/login
+  selectors:
+    csv: "#btnDownload"
+  timeouts:
+    download: 120000
+etcMeisai:
+  ignored: value
+  selectors:
+    sokoKbn: kbn
+`
+	assert.Nil(t, os.WriteFile(path, []byte(yaml), 0644))
+
+	c, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "9090", c.Server.Port)
+	assert.Equal(t, "http://localhost:3000/login", c.TheEarth.LoginURL)
+	assert.Equal(t, "#btnDownload", c.TheEarth.Selectors.Csv)
+	assert.Equal(t, int32(120000), c.TheEarth.Timeouts.Download)
+	assert.Equal(t, "kbn", c.EtcMeisai.Selectors.SokoKbn)
+	// 設定ファイルにない項目は既定値のまま
+	assert.Equal(t, "#txtID2", c.TheEarth.Selectors.CompanyID)
+	assert.Equal(t, "./jobs", c.Dirs.Jobs)
+
+	assert.Nil(t, os.WriteFile(path, []byte("server: ["), 0644))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "の解析に失敗しました")
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("server:\n  port: \"9090\"\n"), 0644))
+
+	t.Setenv("SCRAPER_THEEARTH_LOGINURL", "http://localhost:3000/login")
+	t.Setenv("SCRAPER_ETCMEISAI_TIMEOUTS_AFTERSEARCH", "500")
+	t.Setenv("SCRAPER_THEEARTH_IGNOREDUSERS", "auto1, auto2")
+	t.Setenv("SCRAPER_BROWSER_HEADLESS", "false")
+	t.Setenv("PORT", "7070")
+
+	c, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:3000/login", c.TheEarth.LoginURL)
+	assert.Equal(t, int32(500), c.EtcMeisai.Timeouts.AfterSearch)
+	assert.Equal(t, []string{"auto1", "auto2"}, c.TheEarth.IgnoredUsers)
+	assert.False(t, c.Browser.Headless)
+	// 従来の環境変数名は設定ファイルより優先される
+	assert.Equal(t, "7070", c.Server.Port)
+
+	t.Setenv("SCRAPER_BROWSER_POOLSIZE", "many")
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "環境変数 SCRAPER_BROWSER_POOLSIZE の値 'many' が不正です")
+}
+
+func TestConfigExampleMatchesDefaults(t *testing.T) {
+	// config.example.yaml は既定値の一覧として README から参照している
+	c, err := LoadConfig("config.example.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentialsKeyEnv は保存ファイルを暗号化する鍵（32バイトをbase64エンコードしたもの）を指定する環境変数です
+// 鍵は設定ファイルには書かず、環境変数だけで指定します
+const credentialsKeyEnv = "CREDENTIALS_KEY"
+
+var (
+	errCredentialStoreDisabled = errors.New("アカウントの保存先が有効になっていません（環境変数 CREDENTIALS_KEY を設定してください）")
+	errCredentialNotFound      = errors.New("指定されたアカウントが登録されていません")
+	errCredentialExists        = errors.New("同じエイリアスのアカウントが既に登録されています")
+	errCredentialInvalid       = errors.New("アカウントの内容が不正です")
+)
+
+// aliasPattern はエイリアスに使える文字です（URLのパスやジョブのアカウント名に使うため）
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Credential はエイリアスで登録したアカウントのログイン情報です
+// GeneralCsv では txtID1/txtID2/txtPass、etc-meisai では risLoginId/risPassword を使います
+type Credential struct {
+	Alias       string    `json:"alias"`
+	Site        string    `json:"site"` // GeneralCsv / etc-meisai
+	TxtID1      string    `json:"txtID1,omitempty"`
+	TxtID2      string    `json:"txtID2,omitempty"`
+	TxtPass     string    `json:"txtPass,omitempty"`
+	RisLoginId  string    `json:"risLoginId,omitempty"`
+	RisPassword string    `json:"risPassword,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// CredentialInfo は API で返すアカウントの情報です（パスワードは含めません）
+type CredentialInfo struct {
+	Alias      string    `json:"alias"`
+	Site       string    `json:"site"`
+	TxtID1     string    `json:"txtID1,omitempty"`
+	TxtID2     string    `json:"txtID2,omitempty"`
+	RisLoginId string    `json:"risLoginId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Info はパスワードを除いたアカウントの情報を返します
+func (c Credential) Info() CredentialInfo {
+	return CredentialInfo{
+		Alias:      c.Alias,
+		Site:       c.Site,
+		TxtID1:     c.TxtID1,
+		TxtID2:     c.TxtID2,
+		RisLoginId: c.RisLoginId,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
+
+// Params はサイトのアダプターに渡すログイン情報を返します（空の項目は含めません）
+func (c Credential) Params() map[string]string {
+	params := make(map[string]string)
+	for key, value := range map[string]string{
+		"txtID1":      c.TxtID1,
+		"txtID2":      c.TxtID2,
+		"txtPass":     c.TxtPass,
+		"risLoginId":  c.RisLoginId,
+		"risPassword": c.RisPassword,
+	} {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+// Validate はエイリアスとサイトに必要なログイン情報が揃っているかを確認します
+func (c Credential) Validate() error {
+	if !aliasPattern.MatchString(c.Alias) {
+		return fmt.Errorf("%w: alias '%s' には英数字と _ . - のみ使用できます", errCredentialInvalid, c.Alias)
+	}
+	switch c.Site {
+	case jobTypeGeneralCsv:
+		if c.TxtID1 == "" || c.TxtID2 == "" || c.TxtPass == "" {
+			return fmt.Errorf("%w: txtID1, txtID2, txtPassのいずれかが空です", errCredentialInvalid)
+		}
+	case jobTypeEtcMeisai:
+		if c.RisLoginId == "" || c.RisPassword == "" {
+			return fmt.Errorf("%w: risLoginId, risPasswordのいずれかが空です", errCredentialInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: site '%s' は不正です（GeneralCsv または etc-meisai）", errCredentialInvalid, c.Site)
+	}
+	return nil
+}
+
+// CredentialStore はアカウントのログイン情報を AES-GCM で暗号化してファイルに保存します
+type CredentialStore struct {
+	mu       sync.RWMutex
+	path     string
+	aead     cipher.AEAD
+	accounts map[string]Credential
+}
+
+// credentials はサーバー起動時に作成するアカウントの保存先です（鍵が設定されていない場合は nil）
+var credentials *CredentialStore
+
+// ParseCredentialsKey は base64 でエンコードされた32バイトの鍵（AES-256）を復号します
+func ParseCredentialsKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("鍵のbase64デコードに失敗しました: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("鍵の長さが不正です（32バイトが必要ですが %d バイトです）", len(key))
+	}
+	return key, nil
+}
+
+// NewCredentialStore は path の暗号化ファイルを読み込んでアカウントの保存先を作成します
+// ファイルが存在しない場合は空の状態から始めます
+func NewCredentialStore(path string, key []byte) (*CredentialStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("暗号化の初期化に失敗しました: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("暗号化の初期化に失敗しました: %w", err)
+	}
+	s := &CredentialStore{path: path, aead: aead, accounts: make(map[string]Credential)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *CredentialStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("アカウントファイル '%s' の読み込みに失敗しました: %w", s.path, err)
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return fmt.Errorf("アカウントファイル '%s' が壊れています", s.path)
+	}
+	plain, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return fmt.Errorf("アカウントファイル '%s' の復号に失敗しました（鍵が違う可能性があります）: %w", s.path, err)
+	}
+	if err := json.Unmarshal(plain, &s.accounts); err != nil {
+		return fmt.Errorf("アカウントファイル '%s' の解析に失敗しました: %w", s.path, err)
+	}
+	return nil
+}
+
+// save は accounts を暗号化して一時ファイルに書き込み、置き換えます
+func (s *CredentialStore) save(accounts map[string]Credential) error {
+	plain, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("nonceの生成に失敗しました: %w", err)
+	}
+	data := s.aead.Seal(nonce, nonce, plain, nil)
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("アカウントファイルのディレクトリの作成に失敗しました: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("アカウントファイルの書き込みに失敗しました: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("アカウントファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// update は fn で変更したアカウント一覧を保存し、成功した場合だけメモリ上の状態を置き換えます
+func (s *CredentialStore) update(fn func(accounts map[string]Credential) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := make(map[string]Credential, len(s.accounts)+1)
+	for alias, c := range s.accounts {
+		accounts[alias] = c
+	}
+	if err := fn(accounts); err != nil {
+		return err
+	}
+	if err := s.save(accounts); err != nil {
+		return err
+	}
+	s.accounts = accounts
+	return nil
+}
+
+// Get はエイリアスのログイン情報を返します
+func (s *CredentialStore) Get(alias string) (Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.accounts[alias]
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: %s", errCredentialNotFound, alias)
+	}
+	return c, nil
+}
+
+// List は登録されているアカウントをエイリアス順に返します
+func (s *CredentialStore) List() []CredentialInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]CredentialInfo, 0, len(s.accounts))
+	for _, c := range s.accounts {
+		list = append(list, c.Info())
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].Alias < list[k].Alias })
+	return list
+}
+
+// Create はアカウントを新しく登録します
+func (s *CredentialStore) Create(c Credential) (Credential, error) {
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+	err := s.update(func(accounts map[string]Credential) error {
+		if _, ok := accounts[c.Alias]; ok {
+			return fmt.Errorf("%w: %s", errCredentialExists, c.Alias)
+		}
+		c.CreatedAt = time.Now()
+		c.UpdatedAt = c.CreatedAt
+		accounts[c.Alias] = c
+		return nil
+	})
+	return c, err
+}
+
+// Update は登録済みのアカウントのログイン情報を置き換えます
+func (s *CredentialStore) Update(alias string, c Credential) (Credential, error) {
+	c.Alias = alias
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+	err := s.update(func(accounts map[string]Credential) error {
+		old, ok := accounts[alias]
+		if !ok {
+			return fmt.Errorf("%w: %s", errCredentialNotFound, alias)
+		}
+		c.CreatedAt = old.CreatedAt
+		c.UpdatedAt = time.Now()
+		accounts[alias] = c
+		return nil
+	})
+	return c, err
+}
+
+// Delete はアカウントを削除します
+func (s *CredentialStore) Delete(alias string) error {
+	return s.update(func(accounts map[string]Credential) error {
+		if _, ok := accounts[alias]; !ok {
+			return fmt.Errorf("%w: %s", errCredentialNotFound, alias)
+		}
+		delete(accounts, alias)
+		return nil
+	})
+}
+
+// initCredentials は環境変数 CREDENTIALS_KEY が設定されていればアカウントの保存先を開きます
+func initCredentials() error {
+	encoded := os.Getenv(credentialsKeyEnv)
+	if encoded == "" {
+		log.Printf("環境変数 %s が設定されていないため、アカウントのエイリアスは使用できません。", credentialsKeyEnv)
+		return nil
+	}
+	key, err := ParseCredentialsKey(encoded)
+	if err != nil {
+		return err
+	}
+	store, err := NewCredentialStore(cfg.Credentials.File, key)
+	if err != nil {
+		return err
+	}
+	credentials = store
+	log.Printf("アカウントファイル '%s' を読み込みました（%d 件）", cfg.Credentials.File, len(store.List()))
+	return nil
+}
+
+// resolveCredential はエイリアスのログイン情報を取得し、サイトが一致するかを確認します
+func resolveCredential(alias string, site string) (Credential, error) {
+	if credentials == nil {
+		return Credential{}, errCredentialStoreDisabled
+	}
+	c, err := credentials.Get(alias)
+	if err != nil {
+		return c, err
+	}
+	if c.Site != site {
+		return c, fmt.Errorf("%w: アカウント '%s' は %s 用です", errCredentialInvalid, alias, c.Site)
+	}
+	return c, nil
+}
+
+// resolveEtcAccounts は data の中でエイリアスが指定されたものをログイン情報に置き換えます
+// 全てエイリアスで指定された場合は、ジョブのアカウント名としてエイリアスをカンマでつないだものを返します
+func resolveEtcAccounts(data []etcAccount) ([]etcAccount, string, error) {
+	resolved := make([]etcAccount, 0, len(data))
+	var aliases []string
+	for _, account := range data {
+		if account.Alias == "" {
+			resolved = append(resolved, account)
+			continue
+		}
+		c, err := resolveCredential(account.Alias, jobTypeEtcMeisai)
+		if err != nil {
+			return nil, "", err
+		}
+		resolved = append(resolved, etcAccount{RisLoginId: c.RisLoginId, RisPassword: c.RisPassword, Cards: account.Cards})
+		aliases = append(aliases, account.Alias)
+	}
+	if len(aliases) != len(data) {
+		return resolved, "", nil
+	}
+	return resolved, strings.Join(aliases, ","), nil
+}
+
+// credentialErrorStatus はアカウントの保存先のエラーに対応するHTTPステータスを返します
+func credentialErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errCredentialStoreDisabled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errCredentialNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errCredentialExists):
+		return http.StatusConflict
+	case errors.Is(err, errCredentialInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeCredentialJSON はアカウントの情報をJSONで返します
+func writeCredentialJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
+
+// handleAccounts は GET /accounts（一覧）と POST /accounts（登録）のハンドラーです
+func handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if credentials == nil {
+		http.Error(w, errCredentialStoreDisabled.Error(), credentialErrorStatus(errCredentialStoreDisabled))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeCredentialJSON(w, http.StatusOK, credentials.List())
+	case http.MethodPost:
+		var c Credential
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "リクエストボディのJSONデコードに失敗しました。", http.StatusBadRequest)
+			return
+		}
+		created, err := credentials.Create(c)
+		if err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		log.Printf("アカウント '%s' (%s) を登録しました。", created.Alias, created.Site)
+		writeCredentialJSON(w, http.StatusCreated, created.Info())
+	default:
+		http.Error(w, "GETまたはPOSTメソッドのみ許可されています", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccount は /accounts/{alias} の GET（取得）、PUT（更新）、DELETE（削除）のハンドラーです
+func handleAccount(w http.ResponseWriter, r *http.Request) {
+	if credentials == nil {
+		http.Error(w, errCredentialStoreDisabled.Error(), credentialErrorStatus(errCredentialStoreDisabled))
+		return
+	}
+	alias := r.PathValue("alias")
+	switch r.Method {
+	case http.MethodGet:
+		c, err := credentials.Get(alias)
+		if err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		writeCredentialJSON(w, http.StatusOK, c.Info())
+	case http.MethodPut:
+		var c Credential
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "リクエストボディのJSONデコードに失敗しました。", http.StatusBadRequest)
+			return
+		}
+		updated, err := credentials.Update(alias, c)
+		if err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		log.Printf("アカウント '%s' (%s) を更新しました。", updated.Alias, updated.Site)
+		writeCredentialJSON(w, http.StatusOK, updated.Info())
+	case http.MethodDelete:
+		if err := credentials.Delete(alias); err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		log.Printf("アカウント '%s' を削除しました。", alias)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "GET、PUTまたはDELETEメソッドのみ許可されています", http.StatusMethodNotAllowed)
+	}
+}
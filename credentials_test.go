@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCredentialsKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// useTestCredentials はテスト中だけ credentials を一時ディレクトリのストアに差し替えます
+func useTestCredentials(t *testing.T) *CredentialStore {
+	t.Helper()
+	store, err := NewCredentialStore(filepath.Join(t.TempDir(), "credentials.enc"), testCredentialsKey(1))
+	assert.Nil(t, err)
+	old := credentials
+	credentials = store
+	t.Cleanup(func() { credentials = old })
+	return store
+}
+
+func TestParseCredentialsKey(t *testing.T) {
+	key, err := ParseCredentialsKey(base64.StdEncoding.EncodeToString(testCredentialsKey(1)))
+	assert.Nil(t, err)
+	assert.Len(t, key, 32)
+
+	_, err = ParseCredentialsKey("not base64!")
+	assert.ErrorContains(t, err, "base64デコードに失敗しました")
+
+	_, err = ParseCredentialsKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "鍵の長さが不正です")
+}
+
+func TestCredentialStorePersistsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	store, err := NewCredentialStore(path, testCredentialsKey(1))
+	assert.Nil(t, err)
+
+	_, err = store.Create(Credential{Alias: "honsha", Site: jobTypeGeneralCsv, TxtID1: "user", TxtID2: "company", TxtPass: "secret-pass"})
+	assert.Nil(t, err)
+
+	// ファイルにはパスワードが平文で書き込まれない
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "secret-pass")
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// 同じ鍵で開き直すと読み込める
+	reopened, err := NewCredentialStore(path, testCredentialsKey(1))
+	assert.Nil(t, err)
+	c, err := reopened.Get("honsha")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-pass", c.TxtPass)
+
+	// 違う鍵では復号できない
+	_, err = NewCredentialStore(path, testCredentialsKey(2))
+	assert.ErrorContains(t, err, "復号に失敗しました")
+}
+
+func TestCredentialStoreCRUD(t *testing.T) {
+	store, err := NewCredentialStore(filepath.Join(t.TempDir(), "credentials.enc"), testCredentialsKey(1))
+	assert.Nil(t, err)
+
+	etc := Credential{Alias: "etc-honsha", Site: jobTypeEtcMeisai, RisLoginId: "ris", RisPassword: "pass"}
+	created, err := store.Create(etc)
+	assert.Nil(t, err)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	_, err = store.Create(etc)
+	assert.ErrorIs(t, err, errCredentialExists)
+
+	_, err = store.Create(Credential{Alias: "bad alias", Site: jobTypeEtcMeisai, RisLoginId: "ris", RisPassword: "pass"})
+	assert.ErrorIs(t, err, errCredentialInvalid)
+	_, err = store.Create(Credential{Alias: "tacho", Site: jobTypeGeneralCsv, TxtID1: "user"})
+	assert.ErrorIs(t, err, errCredentialInvalid)
+	_, err = store.Create(Credential{Alias: "other", Site: "unknown"})
+	assert.ErrorIs(t, err, errCredentialInvalid)
+
+	updated, err := store.Update("etc-honsha", Credential{Site: jobTypeEtcMeisai, RisLoginId: "ris2", RisPassword: "pass2"})
+	assert.Nil(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	c, _ := store.Get("etc-honsha")
+	assert.Equal(t, "ris2", c.RisLoginId)
+
+	_, err = store.Update("missing", etc)
+	assert.ErrorIs(t, err, errCredentialNotFound)
+
+	assert.Len(t, store.List(), 1)
+	assert.Nil(t, store.Delete("etc-honsha"))
+	assert.ErrorIs(t, store.Delete("etc-honsha"), errCredentialNotFound)
+	assert.Len(t, store.List(), 0)
+}
+
+func TestResolveEtcAccounts(t *testing.T) {
+	_, _, err := resolveEtcAccounts([]etcAccount{{Alias: "etc-honsha"}})
+	assert.ErrorIs(t, err, errCredentialStoreDisabled)
+
+	store := useTestCredentials(t)
+	_, err = store.Create(Credential{Alias: "etc-honsha", Site: jobTypeEtcMeisai, RisLoginId: "ris", RisPassword: "pass"})
+	assert.Nil(t, err)
+	_, err = store.Create(Credential{Alias: "honsha", Site: jobTypeGeneralCsv, TxtID1: "user", TxtID2: "company", TxtPass: "pass"})
+	assert.Nil(t, err)
+
+	data, account, err := resolveEtcAccounts([]etcAccount{{Alias: "etc-honsha"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "etc-honsha", account)
+	assert.Equal(t, []etcAccount{{RisLoginId: "ris", RisPassword: "pass"}}, data)
+
+	// ログイン情報を直接指定したものと混在する場合はアカウント名を付けない
+	data, account, err = resolveEtcAccounts([]etcAccount{{Alias: "etc-honsha"}, {RisLoginId: "raw", RisPassword: "raw-pass"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "", account)
+	assert.Len(t, data, 2)
+
+	_, _, err = resolveEtcAccounts([]etcAccount{{Alias: "honsha"}})
+	assert.ErrorContains(t, err, "アカウント 'honsha' は GeneralCsv 用です")
+	_, _, err = resolveEtcAccounts([]etcAccount{{Alias: "missing"}})
+	assert.ErrorIs(t, err, errCredentialNotFound)
+}
+
+func TestHandleAccounts(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAccounts(rec, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	useTestCredentials(t)
+	body := `{"alias":"honsha","site":"GeneralCsv","txtID1":"user","txtID2":"company","txtPass":"secret-pass"}`
+	rec = httptest.NewRecorder()
+	handleAccounts(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret-pass")
+
+	rec = httptest.NewRecorder()
+	handleAccounts(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handleAccounts(rec, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list []CredentialInfo
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+	assert.Equal(t, "company", list[0].TxtID2)
+	assert.NotContains(t, rec.Body.String(), "secret-pass")
+
+	// /accounts/{alias} は ServeMux を通してパスの値を取り出す
+	mux := http.NewServeMux()
+	mux.HandleFunc("/accounts/{alias}", handleAccount)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/honsha", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret-pass")
+
+	rec = httptest.NewRecorder()
+	update := `{"site":"GeneralCsv","txtID1":"user2","txtID2":"company","txtPass":"new-pass"}`
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/accounts/honsha", strings.NewReader(update)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"txtID1":"user2"`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/accounts/honsha", strings.NewReader(`{"site":"GeneralCsv"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/honsha", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/honsha", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
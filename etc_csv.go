@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/width"
+)
+
+// ETC利用明細のCSVを変換して出力する形式です
+const (
+	recordsJSON   = "json"   // レコードの配列
+	recordsNDJSON = "ndjson" // 1行に1レコード
+)
+
+// validateRecordsFormat はレコードの出力形式を検証します（空は変換しない）
+func validateRecordsFormat(format string) error {
+	switch format {
+	case "", recordsJSON, recordsNDJSON:
+		return nil
+	}
+	return fmt.Errorf("records '%s' は不正です（%s または %s を指定できます）", format, recordsJSON, recordsNDJSON)
+}
+
+// EtcRecord はETC利用明細のCSVの1行分です
+type EtcRecord struct {
+	EntryAt            time.Time `json:"entryAt,omitzero"` // 入口の利用日時（入口がない料金所の場合は空）
+	ExitAt             time.Time `json:"exitAt"`           // 出口の利用日時
+	EntryIC            string    `json:"entryIc,omitempty"`
+	ExitIC             string    `json:"exitIc"`
+	VehicleClass       string    `json:"vehicleClass,omitempty"` // 車種
+	VehicleNumber      string    `json:"vehicleNumber,omitempty"`
+	CardNumber         string    `json:"cardNumber"`
+	TollBeforeDiscount int       `json:"tollBeforeDiscount"` // 割引前料金
+	Discount           int       `json:"discount"`           // ETC割引額
+	Toll               int       `json:"toll"`               // 通行料金（割引後）
+	Note               string    `json:"note,omitempty"`     // 備考
+}
+
+// etcCsvColumns はCSVの見出し（全角を半角にして空白を除いたもの）と列の対応です
+var etcCsvColumns = map[string]string{
+	"利用年月日(自)": "entryDate",
+	"時刻(自)":    "entryTime",
+	"利用年月日(至)": "exitDate",
+	"時刻(至)":    "exitTime",
+	"利用IC(自)":  "entryIC",
+	"利用IC(至)":  "exitIC",
+	"割引前料金":    "tollBeforeDiscount",
+	"ETC割引額":   "discount",
+	"通行料金":     "toll",
+	"車種":       "vehicleClass",
+	"車両番号":     "vehicleNumber",
+	"ETCカード番号": "cardNumber",
+	"備考":       "note",
+}
+
+// etcCsvRequired は必須の列です
+var etcCsvRequired = []string{"exitDate", "toll"}
+
+// errEtcCsvHeader はCSVの見出しがETC利用明細の形式ではない場合のエラーです
+var errEtcCsvHeader = errors.New("ETC利用明細のCSVの見出しではありません")
+
+// decodeShiftJIS は Shift_JIS のCSVを UTF-8 に変換します。既に UTF-8 の場合はBOMを取り除いてそのまま返します
+func decodeShiftJIS(data []byte) ([]byte, error) {
+	if utf8.Valid(data) {
+		return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("Shift_JIS の変換に失敗しました: %w", err)
+	}
+	return decoded, nil
+}
+
+// normalizeCsvHeader は見出しの全角英数字・括弧を半角にし、空白を取り除きます
+func normalizeCsvHeader(s string) string {
+	return strings.Join(strings.Fields(width.Fold.String(s)), "")
+}
+
+// ParseEtcCsv はetc-meisai.jpからダウンロードしたCSV（Shift_JIS または UTF-8）をレコードに変換します
+// 列は見出しの名前で判断するため、列の順序や追加の列には影響されません
+func ParseEtcCsv(r io.Reader) ([]EtcRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decodeShiftJIS(data); err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errEtcCsvHeader
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSVの読み込みに失敗しました: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		if key, ok := etcCsvColumns[normalizeCsvHeader(name)]; ok {
+			columns[key] = i
+		}
+	}
+	for _, key := range etcCsvRequired {
+		if _, ok := columns[key]; !ok {
+			return nil, fmt.Errorf("%w（%v）", errEtcCsvHeader, header)
+		}
+	}
+
+	records := []EtcRecord{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSVの %d 行目の読み込みに失敗しました: %w", line, err)
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		record, err := parseEtcRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("CSVの %d 行目: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseEtcRow(row []string, columns map[string]int) (EtcRecord, error) {
+	field := func(key string) string {
+		i, ok := columns[key]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	var record EtcRecord
+	var err error
+	if record.EntryAt, err = parseEtcDateTime(field("entryDate"), field("entryTime")); err != nil {
+		return record, err
+	}
+	if record.ExitAt, err = parseEtcDateTime(field("exitDate"), field("exitTime")); err != nil {
+		return record, err
+	}
+	if record.ExitAt.IsZero() {
+		return record, errors.New("利用年月日（至）が空です")
+	}
+	if record.TollBeforeDiscount, err = parseEtcAmount(field("tollBeforeDiscount")); err != nil {
+		return record, err
+	}
+	if record.Discount, err = parseEtcAmount(field("discount")); err != nil {
+		return record, err
+	}
+	if record.Toll, err = parseEtcAmount(field("toll")); err != nil {
+		return record, err
+	}
+	record.EntryIC = field("entryIC")
+	record.ExitIC = field("exitIC")
+	record.VehicleClass = field("vehicleClass")
+	record.VehicleNumber = field("vehicleNumber")
+	record.CardNumber = field("cardNumber")
+	record.Note = field("note")
+	return record, nil
+}
+
+// parseEtcDateTime は利用年月日（26/09/01 または 2026/09/01）と時刻（08:00）を解析します。日付が空の場合はゼロ値です
+func parseEtcDateTime(date, clock string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	layout := "06/01/02"
+	if len(date) == len("2006/01/02") {
+		layout = "2006/01/02"
+	}
+	value := date
+	if clock != "" {
+		layout += " 15:04"
+		value += " " + clock
+	}
+	t, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("利用日時 '%s' の形式が不正です", strings.TrimSpace(date+" "+clock))
+	}
+	return t, nil
+}
+
+// parseEtcAmount は金額（1,230 や 1230円）を解析します。空の場合は0です
+func parseEtcAmount(s string) (int, error) {
+	n := strings.NewReplacer(",", "", "円", "", "￥", "", "\\", "").Replace(width.Fold.String(s))
+	if n == "" {
+		return 0, nil
+	}
+	amount, err := strconv.Atoi(n)
+	if err != nil {
+		return 0, fmt.Errorf("金額 '%s' の形式が不正です", s)
+	}
+	return amount, nil
+}
+
+// writeEtcRecords はレコードを format（json / ndjson）の形式で w に書き込みます
+func writeEtcRecords(w io.Writer, records []EtcRecord, format string) error {
+	if format == recordsNDJSON {
+		enc := json.NewEncoder(w)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// convertEtcCsv はダウンロードしたCSVをレコードに変換し、同じディレクトリに <CSVの名前>.json（または .ndjson）として保存します
+func convertEtcCsv(job *Job, csvPath string, format string) (string, error) {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return "", err
+	}
+	records, err := ParseEtcCsv(f)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("'%s' の変換に失敗しました: %w", filepath.Base(csvPath), err)
+	}
+	path := strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + "." + format
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(out)
+	if err := writeEtcRecords(w, records, format); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	job.Logf("'%s' を %d 件のレコードに変換しました: %s", filepath.Base(csvPath), len(records), path)
+	if fi, err := os.Stat(csvPath); err == nil {
+		job.AddManifest(ManifestEntry{File: filepath.Base(csvPath), Type: "etc", Rows: len(records), Size: fi.Size()})
+	}
+	return path, nil
+}
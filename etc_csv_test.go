@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testEtcCsv = "利用年月日（自）,時刻（自）,利用年月日（至）,時刻（至）,利用ＩＣ（自）,利用ＩＣ（至）,割引前料金,ＥＴＣ割引額,通行料金,車種,車両番号,ＥＴＣカード番号,備考\r\n" +
+	"26/09/01,08:00,26/09/01,08:30,東京,横浜青葉,\"1,320\",390,930,普通車,品川100あ1234,1234-5678-9012-3456,\r\n" +
+	",,26/09/02,17:45,,首都高速,,0,300,普通車,品川100あ1234,1234-5678-9012-3456,深夜割引\r\n" +
+	",,,,,,,,,,,,\r\n"
+
+func TestParseEtcCsv(t *testing.T) {
+	want := []EtcRecord{
+		{
+			EntryAt:            time.Date(2026, 9, 1, 8, 0, 0, 0, time.Local),
+			ExitAt:             time.Date(2026, 9, 1, 8, 30, 0, 0, time.Local),
+			EntryIC:            "東京",
+			ExitIC:             "横浜青葉",
+			VehicleClass:       "普通車",
+			VehicleNumber:      "品川100あ1234",
+			CardNumber:         "1234-5678-9012-3456",
+			TollBeforeDiscount: 1320,
+			Discount:           390,
+			Toll:               930,
+		},
+		{
+			ExitAt:        time.Date(2026, 9, 2, 17, 45, 0, 0, time.Local),
+			ExitIC:        "首都高速",
+			VehicleClass:  "普通車",
+			VehicleNumber: "品川100あ1234",
+			CardNumber:    "1234-5678-9012-3456",
+			Toll:          300,
+			Note:          "深夜割引",
+		},
+	}
+
+	// 実際のサイトは Shift_JIS
+	records, err := ParseEtcCsv(bytes.NewReader(fakeShiftJIS(t, testEtcCsv)))
+	assert.Nil(t, err)
+	assert.Equal(t, want, records)
+
+	// UTF-8（BOM付き）もそのまま読み込む
+	records, err = ParseEtcCsv(strings.NewReader("\xef\xbb\xbf" + testEtcCsv))
+	assert.Nil(t, err)
+	assert.Equal(t, want, records)
+
+	// 列の順序が違っても見出しで判断する
+	records, err = ParseEtcCsv(strings.NewReader("通行料金,利用年月日(至),時刻(至)\n1200,2026/09/03,09:15\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []EtcRecord{{ExitAt: time.Date(2026, 9, 3, 9, 15, 0, 0, time.Local), Toll: 1200}}, records)
+
+	records, err = ParseEtcCsv(strings.NewReader("利用年月日（至）,通行料金\n"))
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	_, err = ParseEtcCsv(strings.NewReader(""))
+	assert.ErrorIs(t, err, errEtcCsvHeader)
+	_, err = ParseEtcCsv(strings.NewReader("運行日,車両番号,乗務員\n2026/10/16,品川100あ1234,山田\n"))
+	assert.ErrorIs(t, err, errEtcCsvHeader)
+	_, err = ParseEtcCsv(strings.NewReader("利用年月日（至）,通行料金\n26/09/01,無料\n"))
+	assert.ErrorContains(t, err, "CSVの 2 行目: 金額 '無料' の形式が不正です")
+	_, err = ParseEtcCsv(strings.NewReader("利用年月日（至）,通行料金\n9月1日,100\n"))
+	assert.ErrorContains(t, err, "利用日時 '9月1日' の形式が不正です")
+}
+
+func TestConvertEtcCsv(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "")
+	csvPath, err := job.ArtifactPath(artifactDownloads, "ris01.csv")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(csvPath, fakeShiftJIS(t, testEtcCsv), 0644))
+
+	path, err := convertEtcCsv(job, csvPath, recordsJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(csvPath), "ris01.json"), path)
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	var records []EtcRecord
+	assert.Nil(t, json.Unmarshal(data, &records))
+	assert.Len(t, records, 2)
+	assert.NotContains(t, strings.Split(string(data), "},")[1], "entryAt", "入口がない場合は entryAt を出力しない")
+
+	path, err = convertEtcCsv(job, csvPath, recordsNDJSON)
+	assert.Nil(t, err)
+	data, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	var record EtcRecord
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, 300, record.Toll)
+
+	// 変換できない場合はエラー
+	assert.Nil(t, os.WriteFile(csvPath, []byte("a,b\n1,2\n"), 0644))
+	_, err = convertEtcCsv(job, csvPath, recordsJSON)
+	assert.ErrorContains(t, err, "'ris01.csv' の変換に失敗しました")
+}
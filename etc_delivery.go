@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ETC利用明細の resUrl への送信方法です
+const (
+	deliveryAccount   = "account"   // アカウントごとに1回 POST する（既定）
+	deliveryMultipart = "multipart" // 全てのアカウントのCSVを1回の POST に複数のパートとしてまとめる
+	deliveryZip       = "zip"       // 全てのアカウントのCSVを1つのzipにまとめて1回 POST する
+)
+
+// アカウントごとの送信結果です
+const (
+	deliverySent       = "sent"       // resUrl・sinks への送信に成功した
+	deliveryDownloaded = "downloaded" // ダウンロードに成功した（送信先の指定なし）
+	deliveryFailed     = "failed"     // ダウンロードまたは送信に失敗した
+	deliverySkipped    = "skipped"    // incremental で新しい期間がないためダウンロードしなかった
+)
+
+// etcBundleName は zip でまとめて送信する場合のファイル名です
+const etcBundleName = "etc-meisai.zip"
+
+// validateDelivery は送信方法の指定を検証します（空の場合はアカウントごと）
+func validateDelivery(delivery string) error {
+	switch delivery {
+	case "", deliveryAccount, deliveryMultipart, deliveryZip:
+		return nil
+	}
+	return fmt.Errorf("delivery '%s' は不正です（%s / %s / %s）", delivery, deliveryAccount, deliveryMultipart, deliveryZip)
+}
+
+// etcDownload は1アカウント分のダウンロード結果です
+type etcDownload struct {
+	params map[string]string
+	to     time.Time
+	files  []string
+}
+
+func (d etcDownload) account() string {
+	return d.params["risLoginId"]
+}
+
+// result はアカウントの送信結果を作成します
+func (d etcDownload) result(status string, err error) DeliveryResult {
+	r := DeliveryResult{Account: d.account(), Status: status}
+	for _, file := range d.files {
+		r.Files = append(r.Files, filepath.Base(file))
+	}
+	if err != nil {
+		r.Error = err.Error()
+		r.Outbox = queuedID(err)
+	}
+	return r
+}
+
+// finish はアカウントの送信結果を記録し、incremental の場合は同期日を進めます
+func (d etcDownload) finish(job *Job, site *Site, rng exportRange, sent bool) error {
+	status := deliveryDownloaded
+	if sent {
+		status = deliverySent
+	}
+	job.SetDelivery(d.result(status, nil))
+	return advanceSyncMark(job, site, d.params, rng, d.to)
+}
+
+// postEtcAccount はアカウントのCSV（と変換したファイル）を1回の multipart の POST で送信します
+// フォームの risLoginId にアカウントのログインIDを入れます
+// 送信に失敗した場合は送信待ちに追加します
+func postEtcAccount(ctx context.Context, job *Job, resUrl string, d etcDownload) error {
+	var parts []multipartFile
+	for _, file := range d.files {
+		parts = append(parts, multipartFile{Field: "file", Path: file, Name: filepath.Base(file)})
+	}
+	return postOrQueue(ctx, job, resUrl, url.Values{"risLoginId": {d.account()}}, parts)
+}
+
+// postEtcBundle は全てのアカウントのCSVを1回の POST で送信します
+// multipart の場合はファイル名を <risLoginId>_<ファイル名> としたパートを並べ、zip の場合は <risLoginId>/<ファイル名> のzipを1つ送信します
+// どちらの場合もフォームの risLoginId に全てのアカウントのログインIDを入れます。送信に失敗した場合は送信待ちに追加します
+func postEtcBundle(ctx context.Context, job *Job, resUrl, delivery string, downloads []etcDownload) error {
+	fields := url.Values{}
+	var parts []multipartFile
+	for _, d := range downloads {
+		fields.Add("risLoginId", d.account())
+		for _, file := range d.files {
+			parts = append(parts, multipartFile{Field: "file", Path: file, Name: d.account() + "_" + filepath.Base(file)})
+		}
+	}
+	if delivery == deliveryZip {
+		bundle, err := zipEtcDownloads(job, downloads)
+		if err != nil {
+			return err
+		}
+		parts = []multipartFile{{Field: "file", Path: bundle, Name: etcBundleName}}
+	}
+	return postOrQueue(ctx, job, resUrl, fields, parts)
+}
+
+// zipEtcDownloads は全てのアカウントのファイルを作業ディレクトリの downloads/etc-meisai.zip にまとめます
+func zipEtcDownloads(job *Job, downloads []etcDownload) (string, error) {
+	path, err := job.ArtifactPath(artifactDownloads, etcBundleName)
+	if err != nil {
+		return "", err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("zipファイルの作成に失敗しました: %w", err)
+	}
+	zw := zip.NewWriter(out)
+	for _, d := range downloads {
+		for _, file := range d.files {
+			if err := addFileToZip(zw, file, d.account()+"/"+filepath.Base(file)); err != nil {
+				out.Close()
+				os.Remove(path)
+				return "", fmt.Errorf("'%s' をzipにまとめられませんでした: %w", filepath.Base(file), err)
+			}
+		}
+	}
+	err = zw.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("zipファイルの作成に失敗しました: %w", err)
+	}
+	return path, nil
+}
+
+func addFileToZip(zw *zip.Writer, file, name string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// etcPost は resUrl が受け取った1回分の POST です
+type etcPost struct {
+	RisLoginIds []string
+	Files       map[string][]byte // パートのファイル名 → 内容
+}
+
+// newEtcReceiver は ETC のCSVを受け取るサーバーを起動します。failFor の risLoginId を含む POST には500を返します
+func newEtcReceiver(t *testing.T, failFor string) (*httptest.Server, func() []etcPost) {
+	t.Helper()
+	var mu sync.Mutex
+	var posts []etcPost
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); !assert.Nil(t, err) {
+			return
+		}
+		post := etcPost{RisLoginIds: r.MultipartForm.Value["risLoginId"], Files: map[string][]byte{}}
+		for _, header := range r.MultipartForm.File["file"] {
+			f, _ := header.Open()
+			post.Files[header.Filename], _ = io.ReadAll(f)
+			f.Close()
+		}
+		mu.Lock()
+		posts = append(posts, post)
+		mu.Unlock()
+		if slices.Contains(post.RisLoginIds, failFor) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []etcPost {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(posts)
+	}
+}
+
+func TestPostEtcDownloads(t *testing.T) {
+	downloads := []etcDownload{
+		{params: map[string]string{"risLoginId": "ris01"}, files: []string{writeTestFile(t, "meisai.csv", "a"), writeTestFile(t, "meisai.json", "[]")}},
+		{params: map[string]string{"risLoginId": "ris02"}, files: []string{writeTestFile(t, "meisai.csv", "b")}},
+	}
+	res, posts := newEtcReceiver(t, "")
+
+	assert.Nil(t, postEtcAccount(context.Background(), nil, res.URL, downloads[0]))
+	assert.Nil(t, postEtcBundle(context.Background(), nil, res.URL, deliveryMultipart, downloads))
+	sent := posts()
+	assert.Equal(t, []etcPost{
+		{RisLoginIds: []string{"ris01"}, Files: map[string][]byte{"meisai.csv": []byte("a"), "meisai.json": []byte("[]")}},
+		{RisLoginIds: []string{"ris01", "ris02"}, Files: map[string][]byte{
+			"ris01_meisai.csv": []byte("a"), "ris01_meisai.json": []byte("[]"), "ris02_meisai.csv": []byte("b"),
+		}},
+	}, sent)
+
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "")
+	assert.Nil(t, postEtcBundle(context.Background(), job, res.URL, deliveryZip, downloads))
+	sent = posts()
+	assert.Len(t, sent, 3)
+	assert.Equal(t, []string{"ris01", "ris02"}, sent[2].RisLoginIds)
+	content := sent[2].Files[etcBundleName]
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	assert.Nil(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{"ris01/meisai.csv": "a", "ris01/meisai.json": "[]", "ris02/meisai.csv": "b"}, files)
+
+	failing, _ := newEtcReceiver(t, "ris02")
+	assert.ErrorContains(t, postEtcBundle(context.Background(), job, failing.URL, deliveryMultipart, downloads), "ステータスコード 500")
+}
+
+func TestJobSetDelivery(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "")
+	d := etcDownload{params: map[string]string{"risLoginId": "ris01"}, to: time.Now(), files: []string{"/tmp/ris01.csv"}}
+	job.SetDelivery(DeliveryResult{Account: "ris02", Status: deliverySkipped})
+	job.SetDelivery(d.result(deliveryFailed, io.ErrUnexpectedEOF))
+	job.SetDelivery(d.result(deliverySent, nil))
+	assert.Equal(t, []DeliveryResult{
+		{Account: "ris02", Status: deliverySkipped},
+		{Account: "ris01", Status: deliverySent, Files: []string{"ris01.csv"}},
+	}, job.Info().Deliveries)
+
+	// 呼び出し元が結果を書き換えてもジョブの結果は変わらない
+	job.Info().Deliveries[0].Status = deliveryFailed
+	assert.Equal(t, deliverySkipped, job.Info().Deliveries[0].Status)
+
+	var nilJob *Job
+	nilJob.SetDelivery(DeliveryResult{Account: "ris01"})
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/playwright-community/playwright-go"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// useTestBrowserPool は実際の Chromium を使うブラウザプールを共有ブラウザプールとして設定します
+// Playwright のドライバーやブラウザがインストールされていない環境ではテストをスキップします
+func useTestBrowserPool(t *testing.T) {
+	t.Helper()
+	pw, err := playwright.Run()
+	if err != nil {
+		t.Skipf("Playwright のドライバーがないため、E2Eテストをスキップします: %v", err)
+	}
+	pool := NewBrowserPool(func() (playwright.Browser, error) {
+		return pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{Headless: playwright.Bool(true)})
+	}, 1, 0)
+	lease, err := pool.Acquire(t.Context())
+	if err != nil {
+		pool.Close()
+		pw.Stop()
+		t.Skipf("Chromium を起動できないため、E2Eテストをスキップします: %v", err)
+	}
+	lease.Release()
+
+	orig := browserPool
+	browserPool = pool
+	t.Cleanup(func() {
+		browserPool = orig
+		pool.Close()
+		pw.Stop()
+	})
+}
+
+// useFastTimeouts はテスト中だけ各サイトの待機時間を短くします
+func useFastTimeouts(t *testing.T) {
+	t.Helper()
+	origEarth, origEtc := cfg.TheEarth, cfg.EtcMeisai
+	t.Cleanup(func() { cfg.TheEarth, cfg.EtcMeisai = origEarth, origEtc })
+	cfg.TheEarth.Timeouts = TheEarthTimeouts{Click: 1000, Popup: 3000, PopupLoad: 200, Menu: 5000, AfterLogin: 100, DateForm: 5000, Download: 10000}
+	cfg.EtcMeisai.Timeouts = EtcMeisaiTimeouts{Wait: 3000, AfterLogin: 100, AfterSearch: 100, Download: 10000}
+}
+
+// fakeSession はフェイクサイトのログイン済みのセッションを表す Cookie です
+const fakeSession = "fake-session"
+
+func fakeLoggedIn(r *http.Request) bool {
+	c, err := r.Cookie(fakeSession)
+	return err == nil && c.Value == "ok"
+}
+
+func writeFakePage(w http.ResponseWriter, title string, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>%s</title></head><body>%s</body></html>", title, body)
+}
+
+// fakeTheEarth は theearth-np.com（デジタコ）の画面を模したテスト用のサイトです
+// ログイン画面、接続ユーザー確認のポップアップ（#popup_1）、メニューのボタン、日付の入力画面、CSV（zip）のダウンロードを再現します
+type fakeTheEarth struct {
+	*httptest.Server
+	CompanyID string
+	UserID    string
+	Password  string
+	// ConnectedUsers は接続ユーザー確認のポップアップに表示するユーザーです（空の場合はポップアップを表示しない）
+	ConnectedUsers []string
+	// Zip はダウンロードさせるファイルの内容です
+	Zip []byte
+
+	mu       sync.Mutex
+	requests []map[string]string // CSV出力のリクエストのフォームの値
+}
+
+// LoginURL は設定ファイルの theearth.loginUrl に指定するURLです
+func (s *fakeTheEarth) LoginURL() string {
+	return s.URL + "/F-OES1010[Login].aspx"
+}
+
+// CsvRequests は CSV出力のリクエストのフォームの値を返します
+func (s *fakeTheEarth) CsvRequests() []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]string(nil), s.requests...)
+}
+
+// newFakeTheEarth はフェイクの theearth-np.com を起動します
+func newFakeTheEarth(t *testing.T) *fakeTheEarth {
+	t.Helper()
+	s := &fakeTheEarth{
+		CompanyID:      "company",
+		UserID:         "user",
+		Password:       "pass",
+		ConnectedUsers: []string{"auto1", "yamada"},
+		Zip: fakeZip(t, map[string]string{
+			"unko.csv":   string(fakeShiftJIS(t, "運行日,車両番号,乗務員,出庫日時,帰庫日時,走行距離\r\n2026/10/16,品川100あ1234,山田,2026/10/16 06:00:00,2026/10/16 18:30:00,215.4\r\n")),
+			"event.csv":  string(fakeShiftJIS(t, "発生日時,車両番号,乗務員,イベント,速度\r\n2026/10/16 09:12:30,品川100あ1234,山田,速度超過,92\r\n")),
+			"teisha.csv": string(fakeShiftJIS(t, "停車開始日時,停車終了日時,車両番号,停車区分,場所\r\n2026/10/16 12:00:00,2026/10/16 12:45:00,品川100あ1234,休憩,足柄SA\r\n")),
+		}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeTheEarth) handle(w http.ResponseWriter, r *http.Request) {
+	// ブラウザによって [ ] がエスケープされる場合があるため、デコード済みのパスで振り分ける
+	switch r.URL.Path {
+	case "/F-OES1010[Login].aspx":
+		s.handleLogin(w, r)
+	case "/F-OES1011[Users].aspx":
+		s.handleUsers(w, r)
+	case "/F-OES2000[Menu].aspx":
+		s.handleMenu(w, r)
+	case "/F-OES3010[Csv].aspx":
+		s.handleCsv(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *fakeTheEarth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	message := ""
+	if r.Method == http.MethodPost {
+		if r.FormValue("txtID2") == s.CompanyID && r.FormValue("txtID1") == s.UserID && r.FormValue("txtPass") == s.Password {
+			http.SetCookie(w, &http.Cookie{Name: fakeSession, Value: "ok", Path: "/"})
+			if len(s.ConnectedUsers) == 0 {
+				http.Redirect(w, r, "/F-OES2000[Menu].aspx", http.StatusSeeOther)
+				return
+			}
+			// 同じユーザーが接続中の場合は、接続ユーザー確認のボタンを表示する
+			writeFakePage(w, "ログイン", `
+<p>他の端末で接続中のユーザーがいます。</p>
+<input type="button" id="popup_1" value="接続ユーザー確認"
+  onclick="window.open('/F-OES1011[Users].aspx', 'users'); location.href = '/F-OES2000[Menu].aspx';">`)
+			return
+		}
+		message = `<p class="error">ログインIDまたはパスワードが違います。</p>`
+	}
+	writeFakePage(w, "ログイン", message+`
+<form method="post" action="/F-OES1010[Login].aspx">
+  <input type="text" id="txtID2" name="txtID2">
+  <input type="text" id="txtID1" name="txtID1">
+  <input type="password" id="txtPass" name="txtPass">
+  <input type="submit" id="imgLogin" value="ログイン">
+</form>`)
+}
+
+func (s *fakeTheEarth) handleUsers(w http.ResponseWriter, r *http.Request) {
+	var rows strings.Builder
+	rows.WriteString("<tr><th>No</th><th>端末</th><th>ユーザー</th></tr>")
+	for i, user := range s.ConnectedUsers {
+		fmt.Fprintf(&rows, "<tr><td>%d</td><td>PC%d</td><td>%s</td></tr>", i+1, i+1, html.EscapeString(user))
+	}
+	writeFakePage(w, "接続ユーザー", "<table>"+rows.String()+"</table>")
+}
+
+func (s *fakeTheEarth) handleMenu(w http.ResponseWriter, r *http.Request) {
+	if !fakeLoggedIn(r) {
+		http.Redirect(w, r, "/F-OES1010[Login].aspx", http.StatusSeeOther)
+		return
+	}
+	// 1段目・2段目のメニューは押すと次の段のボタンが表示される
+	writeFakePage(w, "メニュー", `
+<input type="button" id="Button1st_2" value="帳票" onclick="document.getElementById('menu2').style.display = 'block';">
+<div id="menu2" style="display: none">
+  <input type="button" id="Button2nd_5" value="CSV出力" onclick="document.getElementById('menu3').style.display = 'block';">
+</div>
+<div id="menu3" style="display: none">
+  <input type="button" id="Button3rd_0" value="運行データ" onclick="location.href = '/F-OES3010[Csv].aspx';">
+</div>`)
+}
+
+func (s *fakeTheEarth) handleCsv(w http.ResponseWriter, r *http.Request) {
+	if !fakeLoggedIn(r) {
+		http.Redirect(w, r, "/F-OES1010[Login].aspx", http.StatusSeeOther)
+		return
+	}
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		values := map[string]string{}
+		for key := range r.PostForm {
+			values[key] = r.PostForm.Get(key)
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, values)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="CsvData.zip"`)
+		w.Write(s.Zip)
+		return
+	}
+	// 日付の入力欄は「期間を指定」を選ぶと入力できるようになる
+	writeFakePage(w, "CSV出力", `
+<form method="post" action="/F-OES3010[Csv].aspx">
+  <input type="radio" id="rdoSelect0" name="rdoSelect" value="all" checked>
+  <input type="radio" id="rdoSelect1" name="rdoSelect" value="select">
+  <input type="radio" id="rdoDate0" name="rdoDate" value="today" checked>
+  <input type="radio" id="rdoDate1" name="rdoDate" value="range" onclick="for (const el of document.querySelectorAll('.date')) el.disabled = false;">
+  <input type="text" class="date" disabled id="MainContent_ucStartDate_txtYear" name="startYear">
+  <input type="text" class="date" disabled id="MainContent_ucStartDate_txtMonth" name="startMonth">
+  <input type="text" class="date" disabled id="MainContent_ucStartDate_txtDay" name="startDay">
+  <input type="text" class="date" disabled id="MainContent_ucEndDate_txtYear" name="endYear">
+  <input type="text" class="date" disabled id="MainContent_ucEndDate_txtMonth" name="endMonth">
+  <input type="text" class="date" disabled id="MainContent_ucEndDate_txtDay" name="endDay">
+  <input type="submit" id="btnCsv" value="CSV出力">
+</form>`)
+}
+
+// fakeZip は files（ファイル名 → 内容）を zip にまとめます
+func fakeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zipの作成に失敗しました: %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zipの作成に失敗しました: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fakeEtcMeisai は etc-meisai.jp の画面を模したテスト用のサイトです
+// ログイン画面、submitPage によるメニューの移動、検索条件の入力（allSelected によるカードの全選択）、確認ダイアログ付きのCSVのダウンロードを再現します
+type fakeEtcMeisai struct {
+	*httptest.Server
+	// Accounts はログインできるアカウント（risLoginId → risPassword）です
+	Accounts map[string]string
+	// Cards は検索画面に表示するETCカードの番号です
+	Cards []string
+	// Csv はダウンロードさせるCSVの内容です（risLoginId ごとに作成します）
+	Csv func(risLoginId string) []byte
+
+	mu       sync.Mutex
+	searches []fakeEtcSearch
+}
+
+// fakeEtcSearch は検索条件の入力画面から送信された値です
+type fakeEtcSearch struct {
+	RisLoginId string
+	From       string // YYYY-MM-DD
+	To         string
+	SokoKbn    string
+	Cards      []string
+}
+
+// LoginURL は設定ファイルの etcMeisai.loginUrl に指定するURLです
+func (s *fakeEtcMeisai) LoginURL() string {
+	return s.URL + "/etc/R?funccode=1013000000&nextfunc=1013000000"
+}
+
+// Searches は検索条件の入力画面から送信された値を返します
+func (s *fakeEtcMeisai) Searches() []fakeEtcSearch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeEtcSearch(nil), s.searches...)
+}
+
+// fakeShiftJIS は s を Shift_JIS に変換します
+func fakeShiftJIS(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newFakeEtcMeisai はフェイクの etc-meisai.jp を起動します
+func newFakeEtcMeisai(t *testing.T) *fakeEtcMeisai {
+	t.Helper()
+	s := &fakeEtcMeisai{
+		Accounts: map[string]string{"ris01": "pass01", "ris02": "pass02"},
+		Cards:    []string{"1234-5678-9012-3456", "1234-5678-9012-0000"},
+		// 実際のサイトと同じ Shift_JIS のCSV（車両番号にログインIDを入れてアカウントを区別する）
+		Csv: func(risLoginId string) []byte {
+			return fakeShiftJIS(t, "利用年月日（自）,時刻（自）,利用年月日（至）,時刻（至）,利用ＩＣ（自）,利用ＩＣ（至）,割引前料金,ＥＴＣ割引額,通行料金,車種,車両番号,ＥＴＣカード番号,備考\r\n"+
+				"26/09/01,08:00,26/09/01,08:30,東京,横浜青葉,\"1,320\",390,930,普通車,"+risLoginId+",1234-5678-9012-3456,\r\n")
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// fakeEtcScript は実際のサイトと同じ名前の JavaScript の関数です
+const fakeEtcScript = `<script>
+function submitPage(form, url) {
+  const f = document.forms[form];
+  f.action = url;
+  f.submit();
+}
+function allSelected(name) {
+  for (const el of document.getElementsByName(name)) el.checked = true;
+}
+</script>`
+
+func (s *fakeEtcMeisai) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/etc/R" {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	switch r.URL.Query().Get("funccode") {
+	case "1013000000":
+		s.handleLogin(w, r)
+	case "1014000000":
+		c, err := r.Cookie(fakeSession)
+		if err != nil || s.Accounts[c.Value] == "" {
+			http.Redirect(w, r, s.LoginURL(), http.StatusSeeOther)
+			return
+		}
+		if r.URL.Query().Get("nextfunc") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="meisai.csv"`)
+			w.Write(s.Csv(c.Value))
+			return
+		}
+		if r.Method == http.MethodPost && r.PostForm.Has("focusTarget_Save") {
+			s.handleSearch(w, r, c.Value)
+			return
+		}
+		s.writeSearchForm(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *fakeEtcMeisai) handleLogin(w http.ResponseWriter, r *http.Request) {
+	message := ""
+	if r.Method == http.MethodPost && r.PostForm.Has("focusTarget") {
+		id := r.PostForm.Get("risLoginId")
+		if pass, ok := s.Accounts[id]; ok && pass == r.PostForm.Get("risPassword") {
+			http.SetCookie(w, &http.Cookie{Name: fakeSession, Value: id, Path: "/"})
+			// ログイン後のトップページ。検索画面へは submitPage で移動する
+			writeFakePage(w, "トップ", fakeEtcScript+`
+<form name="frm" method="post" action="/etc/R">
+  <a href="javascript:submitPage('frm','/etc/R?funccode=1014000000&nextfunc=1014000000')">利用明細の検索</a>
+</form>`)
+			return
+		}
+		message = `<p class="error">ログインできませんでした。</p>`
+	}
+	writeFakePage(w, "ログイン", message+`
+<form name="frm" method="post" action="/etc/R?funccode=1013000000&nextfunc=1013000000">
+  <input type="text" name="risLoginId">
+  <input type="password" name="risPassword">
+  <input type="submit" name="focusTarget" value="ログイン">
+</form>`)
+}
+
+func fakeOptions(from, to int, width int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&b, `<option value="%0*d">%d</option>`, width, i, i)
+	}
+	return b.String()
+}
+
+func (s *fakeEtcMeisai) writeSearchForm(w http.ResponseWriter) {
+	var cards strings.Builder
+	for _, card := range s.Cards {
+		fmt.Fprintf(&cards, `<label><input type="checkbox" name="hyojiCard" value="%s">%s</label>`, card, card)
+	}
+	years, months, days := fakeOptions(2020, 2030, 4), fakeOptions(1, 12, 2), fakeOptions(1, 31, 2)
+	writeFakePage(w, "利用明細の検索", fakeEtcScript+`
+<form name="frm" method="post" action="/etc/R?funccode=1014000000&nextfunc=1014000000">
+  <select name="fromYYYY">`+years+`</select><select name="fromMM">`+months+`</select><select name="fromDD">`+days+`</select>
+  <select name="toYYYY">`+years+`</select><select name="toMM">`+months+`</select><select name="toDD">`+days+`</select>
+  <input type="radio" name="sokoKbn" value="0">走行日
+  <input type="radio" name="sokoKbn" value="1" checked>請求月
+  `+cards.String()+`
+  <input type="submit" name="focusTarget_Save" value="検索">
+</form>`)
+}
+
+func (s *fakeEtcMeisai) handleSearch(w http.ResponseWriter, r *http.Request, risLoginId string) {
+	f := r.PostForm
+	s.mu.Lock()
+	s.searches = append(s.searches, fakeEtcSearch{
+		RisLoginId: risLoginId,
+		From:       f.Get("fromYYYY") + "-" + f.Get("fromMM") + "-" + f.Get("fromDD"),
+		To:         f.Get("toYYYY") + "-" + f.Get("toMM") + "-" + f.Get("toDD"),
+		SokoKbn:    f.Get("sokoKbn"),
+		Cards:      f["hyojiCard"],
+	})
+	s.mu.Unlock()
+	// CSV出力は確認ダイアログで OK を押すとダウンロードされる
+	writeFakePage(w, "利用明細", `
+<p>検索結果: 1件</p>
+<input type="button" value="利用明細ＣＳＶ出力"
+  onclick="if (confirm('CSVファイルを出力しますか？')) location.href = '/etc/R?funccode=1014000000&nextfunc=csv';">`)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	jobJanitorInterval  = time.Hour // 保持期間を過ぎたジョブを削除する間隔
+	artifactDownloads   = "downloads"
+	artifactScreenshots = "screenshots"
+	artifactTraces      = "traces"
+	jobLogName          = "job.log"
+)
+
+// Dir はジョブの作業ディレクトリを返します
+func (j *Job) Dir() string {
+	if j == nil {
+		return cfg.Dirs.Legacy
+	}
+	return j.dir
+}
+
+// ArtifactPath はジョブの作業ディレクトリ内の kind（downloads, screenshots など）に name を保存するためのパスを返します
+// ディレクトリが存在しない場合は作成します
+func (j *Job) ArtifactPath(kind string, name string) (string, error) {
+	dir := cfg.Dirs.Legacy
+	if j != nil {
+		dir = filepath.Join(j.dir, kind)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("作業ディレクトリ '%s' の作成に失敗しました: %w", dir, err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// ArtifactInfo は GET /jobs/{id}/artifacts で返す成果物の情報です
+type ArtifactInfo struct {
+	Path    string    `json:"path"` // 作業ディレクトリからの相対パス（例: traces/trace.zip）
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Artifacts はジョブの作業ディレクトリにある成果物（ダウンロード・スクリーンショット・トレース・ログ）の一覧を返します
+func (j *Job) Artifacts() ([]ArtifactInfo, error) {
+	artifacts := []ArtifactInfo{}
+	err := filepath.WalkDir(j.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(j.dir, path)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, ArtifactInfo{Path: filepath.ToSlash(rel), Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	return artifacts, err
+}
+
+// ArtifactFile は作業ディレクトリからの相対パスを実際のファイルのパスに変換します
+// 作業ディレクトリの外を指すパスはエラーにします
+func (j *Job) ArtifactFile(rel string) (string, error) {
+	local, err := filepath.Localize(rel)
+	if err != nil {
+		return "", fmt.Errorf("成果物のパス '%s' が不正です", rel)
+	}
+	return filepath.Join(j.dir, local), nil
+}
+
+// BundleDownloads はダウンロードしたファイルを作業ディレクトリの downloads/<name> の1つのzipにまとめ、そのパスを返します
+// ファイルが1つの場合は名前を変えるだけです。複数の場合は、zipの中身を元のファイル名のフォルダーに展開した形でまとめ、元のファイルは削除します
+func (j *Job) BundleDownloads(files []string, name string) (string, error) {
+	path, err := j.ArtifactPath(artifactDownloads, name)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 1 {
+		if err := os.Rename(files[0], path); err != nil {
+			return "", fmt.Errorf("ダウンロードファイルの名前の変更に失敗しました: %w", err)
+		}
+		return path, nil
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", fmt.Errorf("zipファイルの作成に失敗しました: %w", err)
+	}
+	zw := zip.NewWriter(out)
+	for _, file := range files {
+		if err := addToBundle(zw, file); err != nil {
+			out.Close()
+			os.Remove(tmp)
+			return "", fmt.Errorf("'%s' をzipにまとめられませんでした: %w", filepath.Base(file), err)
+		}
+	}
+	err = zw.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("zipファイルの作成に失敗しました: %w", err)
+	}
+	for _, file := range files {
+		if file != path {
+			os.Remove(file)
+		}
+	}
+	j.Logf("%d 個のファイルを '%s' にまとめました。", len(files), path)
+	return path, nil
+}
+
+// addToBundle は file を zw に追加します
+// file が zip の場合は、中のファイルを圧縮したまま <file の拡張子を除いた名前>/ の下にコピーします
+func addToBundle(zw *zip.Writer, file string) error {
+	base := filepath.Base(file)
+	if zr, err := zip.OpenReader(file); err == nil {
+		defer zr.Close()
+		prefix := strings.TrimSuffix(base, filepath.Ext(base)) + "/"
+		for _, f := range zr.File {
+			header := f.FileHeader
+			header.Name = prefix + header.Name
+			w, err := zw.CreateRaw(&header)
+			if err != nil {
+				return err
+			}
+			r, err := f.OpenRaw()
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := zw.Create(base)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// Logf は標準のログに加えて、ジョブの作業ディレクトリの job.log にも書き込みます
+func (j *Job) Logf(format string, args ...any) {
+	j.output(2, fmt.Sprintf(format, args...))
+}
+
+// Logln は Logf の log.Println 版です
+func (j *Job) Logln(args ...any) {
+	j.output(2, fmt.Sprintln(args...))
+}
+
+func (j *Job) output(calldepth int, msg string) {
+	log.Output(calldepth+1, msg)
+	if j == nil {
+		return
+	}
+	j.logMu.Lock()
+	defer j.logMu.Unlock()
+	if j.logClosed {
+		return
+	}
+	if j.logFile == nil {
+		if err := os.MkdirAll(j.dir, 0755); err != nil {
+			log.Printf("ジョブの作業ディレクトリの作成に失敗しました: %v", err)
+			j.logClosed = true
+			return
+		}
+		f, err := os.OpenFile(filepath.Join(j.dir, jobLogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("ジョブのログファイルのオープンに失敗しました: %v", err)
+			j.logClosed = true
+			return
+		}
+		j.logFile = f
+	}
+	if len(msg) == 0 || msg[len(msg)-1] != '\n' {
+		msg += "\n"
+	}
+	fmt.Fprintf(j.logFile, "%s %s", time.Now().Format("2006/01/02 15:04:05"), msg)
+}
+
+// closeLog はジョブのログファイルを閉じます
+func (j *Job) closeLog() {
+	j.logMu.Lock()
+	defer j.logMu.Unlock()
+	j.logClosed = true
+	if j.logFile != nil {
+		j.logFile.Close()
+		j.logFile = nil
+	}
+}
+
+// Cleanup は終了してから retention 以上経過したジョブをストアと作業ディレクトリから削除します
+// サーバーの再起動前に作成され、ストアに残っていない作業ディレクトリも更新日時を見て削除します
+func (s *JobStore) Cleanup(retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+
+	s.mu.Lock()
+	var expired []*Job
+	for id, job := range s.jobs {
+		info := job.Info()
+		if info.EndedAt != nil && info.EndedAt.Before(cutoff) {
+			expired = append(expired, job)
+			delete(s.jobs, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range expired {
+		if err := os.RemoveAll(job.dir); err != nil {
+			log.Printf("ジョブ %s の作業ディレクトリの削除に失敗しました: %v", job.info.ID, err)
+			continue
+		}
+		log.Printf("保持期間を過ぎたジョブ %s を削除しました。", job.info.ID)
+	}
+
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ジョブディレクトリの読み取りに失敗しました: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, ok := s.Get(entry.Name()); ok {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil || fi.ModTime().After(cutoff) {
+			continue
+		}
+		path := filepath.Join(s.baseDir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("作業ディレクトリ '%s' の削除に失敗しました: %v", path, err)
+			continue
+		}
+		log.Printf("保持期間を過ぎた作業ディレクトリ '%s' を削除しました。", path)
+	}
+}
+
+// StartJanitor は保持期間を過ぎたジョブを定期的に削除するゴルーチンを開始します
+func (s *JobStore) StartJanitor(retention time.Duration, interval time.Duration) {
+	log.Printf("ジョブの保持期間: %s（%s ごとに削除を実行します）", retention, interval)
+	go func() {
+		s.Cleanup(retention)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Cleanup(retention)
+		}
+	}()
+}
+
+// handleJobArtifacts は GET /jobs/{id}/artifacts のハンドラーです
+func handleJobArtifacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := jobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "指定されたジョブが見つかりません。", http.StatusNotFound)
+		return
+	}
+	artifacts, err := job.Artifacts()
+	if err != nil {
+		log.Printf("ジョブ %s の成果物の一覧の取得に失敗しました: %v", job.Info().ID, err)
+		http.Error(w, "成果物の一覧の取得に失敗しました。", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(artifacts); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
+
+// handleJobArtifact は GET /jobs/{id}/artifacts/{path...} のハンドラーです
+// トレース（traces/*.zip）は https://trace.playwright.dev や npx playwright show-trace で開けます
+func handleJobArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := jobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "指定されたジョブが見つかりません。", http.StatusNotFound)
+		return
+	}
+	path, err := job.ArtifactFile(r.PathValue("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		http.Error(w, "指定された成果物が見つかりません。", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
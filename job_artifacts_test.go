@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobArtifactPath(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New("GeneralCsv", "")
+
+	path, err := job.ArtifactPath(artifactDownloads, "downloaded_file.zip")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(job.Dir(), artifactDownloads, "downloaded_file.zip"), path)
+	fi, err := os.Stat(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.True(t, fi.IsDir(), "Artifact directory should be created")
+
+	// 別のジョブとは作業ディレクトリが分かれている
+	other := store.New("GeneralCsv", "")
+	otherPath, err := other.ArtifactPath(artifactDownloads, "downloaded_file.zip")
+	assert.Nil(t, err)
+	assert.NotEqual(t, path, otherPath)
+}
+
+func TestJobLogWritesToJobDir(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.Start("GeneralCsv", "", func(ctx context.Context, job *Job) error {
+		job.SetStep("ログイン")
+		job.Logf("ページのタイトル: %s", "テスト")
+		return nil
+	})
+	waitForJob(t, job)
+
+	content, err := os.ReadFile(filepath.Join(job.Dir(), jobLogName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "ステップ 'ログイン' を開始します。")
+	assert.Contains(t, string(content), "ページのタイトル: テスト")
+	assert.Contains(t, string(content), "が完了しました。")
+}
+
+func TestJobStoreCleanup(t *testing.T) {
+	baseDir := t.TempDir()
+	store := NewJobStore(baseDir)
+
+	finished := store.Start("GeneralCsv", "", func(ctx context.Context, job *Job) error {
+		job.Logln("完了したジョブ")
+		return nil
+	})
+	waitForJob(t, finished)
+
+	running := store.New("etc-meisai", "")
+	running.Logln("実行中のジョブ")
+
+	// 再起動前に作られたストアにない作業ディレクトリ
+	orphan := filepath.Join(baseDir, "orphan")
+	assert.Nil(t, os.MkdirAll(orphan, 0755))
+	old := time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, os.Chtimes(orphan, old, old))
+
+	// 保持期間内なので何も削除されない
+	store.Cleanup(3 * time.Hour)
+	_, ok := store.Get(finished.Info().ID)
+	assert.True(t, ok)
+	assert.DirExists(t, orphan)
+
+	// 保持期間を過ぎた終了済みジョブと作業ディレクトリだけが削除される
+	time.Sleep(10 * time.Millisecond)
+	store.Cleanup(time.Millisecond)
+	_, ok = store.Get(finished.Info().ID)
+	assert.False(t, ok, "Expired job should be removed from the store")
+	assert.NoDirExists(t, finished.Dir())
+	assert.NoDirExists(t, orphan)
+
+	_, ok = store.Get(running.Info().ID)
+	assert.True(t, ok, "Running job should be kept")
+	assert.DirExists(t, running.Dir())
+}
+
+func TestJobArtifacts(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New("GeneralCsv", "")
+
+	// 作業ディレクトリがまだない場合は空
+	artifacts, err := job.Artifacts()
+	assert.Nil(t, err)
+	assert.Empty(t, artifacts)
+
+	path, err := job.ArtifactPath(artifactTraces, "theearth-user.zip")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, []byte("trace"), 0644))
+	artifacts, err = job.Artifacts()
+	assert.Nil(t, err)
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, "traces/theearth-user.zip", artifacts[0].Path)
+	assert.Equal(t, int64(5), artifacts[0].Size)
+
+	file, err := job.ArtifactFile("traces/theearth-user.zip")
+	assert.Nil(t, err)
+	assert.Equal(t, path, file)
+	for _, rel := range []string{"../other/job.log", "/etc/passwd", ""} {
+		_, err = job.ArtifactFile(rel)
+		assert.Error(t, err, rel)
+	}
+}
+
+func TestHandleJobArtifacts(t *testing.T) {
+	orig := jobs
+	t.Cleanup(func() { jobs = orig })
+	jobs = NewJobStore(t.TempDir())
+	job := jobs.New("GeneralCsv", "")
+	path, err := job.ArtifactPath(artifactTraces, "theearth-user.zip")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, []byte("trace"), 0644))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs/{id}/artifacts", handleJobArtifacts)
+	mux.HandleFunc("/jobs/{id}/artifacts/{path...}", handleJobArtifact)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	id := job.Info().ID
+
+	rec := get("/jobs/" + id + "/artifacts")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var artifacts []ArtifactInfo
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &artifacts))
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, "traces/theearth-user.zip", artifacts[0].Path)
+
+	rec = get("/jobs/" + id + "/artifacts/traces/theearth-user.zip")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "trace", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "theearth-user.zip")
+
+	assert.Equal(t, http.StatusNotFound, get("/jobs/"+id+"/artifacts/traces/missing.zip").Code)
+	assert.Equal(t, http.StatusNotFound, get("/jobs/"+id+"/artifacts/traces").Code)
+	assert.Equal(t, http.StatusNotFound, get("/jobs/unknown/artifacts").Code)
+}
+
+func TestJobBundleDownloads(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New("GeneralCsv", "")
+	write := func(name string, content []byte) string {
+		path, err := job.ArtifactPath(artifactDownloads, name)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(path, content, 0644))
+		return path
+	}
+
+	// 1つの場合は名前を変えるだけ
+	single := write("theearth_20261016-20261017.zip", fakeZip(t, map[string]string{"unko.csv": "a"}))
+	bundle, err := job.BundleDownloads([]string{single}, "downloaded_file.zip")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(job.Dir(), artifactDownloads, "downloaded_file.zip"), bundle)
+	_, err = os.Stat(single)
+	assert.True(t, os.IsNotExist(err))
+
+	// 複数の場合は元のファイル名のフォルダーにまとめる
+	files := []string{
+		write("theearth_20260801-20260831.zip", fakeZip(t, map[string]string{"unko.csv": "8月"})),
+		write("theearth_20260901-20260930.zip", fakeZip(t, map[string]string{"unko.csv": "9月"})),
+		write("memo.csv", []byte("csv")),
+	}
+	bundle, err = job.BundleDownloads(files, "downloaded_file.zip")
+	assert.Nil(t, err)
+	zr, err := zip.OpenReader(bundle)
+	assert.Nil(t, err)
+	defer zr.Close()
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		assert.Nil(t, err)
+		b, _ := io.ReadAll(r)
+		r.Close()
+		contents[f.Name] = string(b)
+	}
+	assert.Equal(t, map[string]string{
+		"theearth_20260801-20260831/unko.csv": "8月",
+		"theearth_20260901-20260930/unko.csv": "9月",
+		"memo.csv":                            "csv",
+	}, contents)
+	artifacts, err := job.Artifacts()
+	assert.Nil(t, err)
+	var downloads []string
+	for _, a := range artifacts {
+		if strings.HasPrefix(a.Path, artifactDownloads+"/") {
+			downloads = append(downloads, a.Path)
+		}
+	}
+	assert.Equal(t, []string{"downloads/downloaded_file.zip"}, downloads)
+}
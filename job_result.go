@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// エラーの分類です。受け取る側がエラーの文言を解析しなくても対処を決められるようにします
+const (
+	errorLogin    = "login"    // ログインに失敗した（ログイン情報の誤りなど）
+	errorScrape   = "scrape"   // ログイン後の画面の操作・ダウンロードに失敗した
+	errorData     = "data"     // ダウンロードしたファイルの内容が不正
+	errorDelivery = "delivery" // resUrl・sinks への送信に失敗した
+	errorBrowser  = "browser"  // ブラウザを準備できなかった
+	errorTimeout  = "timeout"  // 画面の表示などの待機がタイムアウトした
+	errorCanceled = "canceled" // ジョブがキャンセルされた
+	errorUnknown  = "unknown"
+)
+
+// callbackMaxRetryDelay は結果を送り直すまでの時間の上限です
+const callbackMaxRetryDelay = 5 * time.Minute
+
+// 結果の送信の署名に使うヘッダーです
+const (
+	callbackSignatureHeader = "X-Signature-256"       // sha256=<HMAC-SHA256 の16進数>
+	callbackTimestampHeader = "X-Signature-Timestamp" // 署名した時刻（Unix時間の秒）
+)
+
+// categorizedError はエラーの分類を付けたエラーです。エラーの文言は元のエラーと同じです
+type categorizedError struct {
+	category string
+	err      error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+// withCategory は err にエラーの分類を付けます（err が nil の場合は nil）
+// 既に分類が付いている場合は内側の分類を優先します
+func withCategory(category string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+// errorCategory はジョブのエラーの分類を返します
+func errorCategory(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled) || errors.Is(err, errJobCanceled):
+		return errorCanceled
+	case errors.Is(err, playwright.ErrTimeout) || errors.Is(err, context.DeadlineExceeded):
+		return errorTimeout
+	case errors.Is(err, errTachoEmpty) || errors.Is(err, errTachoTruncated) || errors.Is(err, errEtcCsvHeader):
+		return errorData
+	}
+	// 最も内側の分類を使う（送信のエラーをまとめたエラーなど）
+	category := errorUnknown
+	for e := err; e != nil; {
+		var c *categorizedError
+		if !errors.As(e, &c) {
+			break
+		}
+		category = c.category
+		e = c.err
+	}
+	return category
+}
+
+// JobResult は callbackUrl に送信するジョブの結果です
+type JobResult struct {
+	JobID         string           `json:"jobId"`
+	Type          string           `json:"type"`
+	Site          string           `json:"site,omitempty"`
+	Account       string           `json:"account,omitempty"` // エイリアス・スケジュールのアカウント名
+	Range         *Range           `json:"range,omitempty"`
+	Status        JobStatus        `json:"status"`
+	Error         string           `json:"error,omitempty"`
+	ErrorCategory string           `json:"errorCategory,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	StartedAt     *time.Time       `json:"startedAt,omitempty"`
+	EndedAt       *time.Time       `json:"endedAt,omitempty"`
+	Steps         []StepTiming     `json:"steps"`
+	Artifacts     []ResultArtifact `json:"artifacts"`
+	Manifest      []ManifestEntry  `json:"manifest,omitempty"`
+	Deliveries    []DeliveryResult `json:"deliveries,omitempty"`
+}
+
+// ResultArtifact は結果に含める成果物のサイズとチェックサムです
+type ResultArtifact struct {
+	Path   string `json:"path"` // 作業ディレクトリからの相対パス（GET /jobs/{id}/artifacts/{path} で取得できます）
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// CallbackStatus は callbackUrl への結果の送信の状態です
+type CallbackStatus struct {
+	Status   string `json:"status"` // sent / failed
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BuildResult はジョブの結果を作成します。成果物は SHA-256 を計算します
+func (j *Job) BuildResult() (JobResult, error) {
+	info := j.Info()
+	result := JobResult{
+		JobID:         info.ID,
+		Type:          info.Type,
+		Site:          info.Site,
+		Account:       info.Account,
+		Range:         info.Range,
+		Status:        info.Status,
+		Error:         info.Error,
+		ErrorCategory: info.ErrorCategory,
+		CreatedAt:     info.CreatedAt,
+		StartedAt:     info.StartedAt,
+		EndedAt:       info.EndedAt,
+		Steps:         info.Steps,
+		Artifacts:     []ResultArtifact{},
+		Manifest:      info.Manifest,
+		Deliveries:    info.Deliveries,
+	}
+	if result.Steps == nil {
+		result.Steps = []StepTiming{}
+	}
+	artifacts, err := j.Artifacts()
+	if err != nil {
+		return result, fmt.Errorf("成果物の一覧の取得に失敗しました: %w", err)
+	}
+	for _, a := range artifacts {
+		sum, err := fileSHA256(filepath.Join(j.dir, filepath.FromSlash(a.Path)))
+		if err != nil {
+			return result, fmt.Errorf("成果物 '%s' のチェックサムの計算に失敗しました: %w", a.Path, err)
+		}
+		result.Artifacts = append(result.Artifacts, ResultArtifact{Path: a.Path, Size: a.Size, SHA256: sum})
+	}
+	return result, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signCallback は "<timestamp>.<body>" の HMAC-SHA256 を返します
+// 受け取る側は X-Signature-Timestamp と本文から同じ値を計算し、X-Signature-256 と比較します
+func signCallback(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL は callbackUrl を検証します（空の場合は送信しない）
+// 結果には署名が必要なため、署名の鍵を設定していない場合はエラーにします
+func validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callbackUrl '%s' は不正です", callbackURL)
+	}
+	if cfg.Callback.Secret == "" {
+		return errors.New("callbackUrl を使うには環境変数 CALLBACK_SECRET（設定ファイルの callback.secret）を設定してください")
+	}
+	return nil
+}
+
+// initCallback は設定ファイルの callback を検証します
+// タイムアウトが0以下だと全ての送信が失敗するため、起動時にエラーにします
+func initCallback() error {
+	c := cfg.Callback
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"callback.timeoutSeconds", c.TimeoutSeconds},
+		{"callback.maxAttempts", c.MaxAttempts},
+		{"callback.retryDelaySeconds", c.RetryDelaySeconds},
+	} {
+		if v.value <= 0 {
+			return fmt.Errorf("%s %d は不正です（1以上を指定してください）", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+// sendJobCallback はジョブの結果を署名して callbackURL に POST します
+// 失敗した場合は callback.maxAttempts 回まで間隔を空けて送り直し、結果をジョブの callback に記録します
+// ctx が Done になった場合（サーバーの停止）は送り直しを打ち切ります
+func sendJobCallback(ctx context.Context, job *Job, callbackURL string) {
+	result, err := job.BuildResult()
+	if err != nil {
+		// チェックサムを計算できなかった成果物があっても結果は送る
+		log.Printf("ジョブ %s の結果の作成に失敗しました: %v", result.JobID, err)
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("ジョブ %s の結果のJSONエンコードに失敗しました: %v", result.JobID, err)
+		return
+	}
+	status := &CallbackStatus{}
+	delay := time.Duration(cfg.Callback.RetryDelaySeconds) * time.Second
+	for status.Attempts < max(cfg.Callback.MaxAttempts, 1) {
+		if status.Attempts > 0 {
+			if werr := sleepContext(ctx, delay); werr != nil {
+				log.Printf("ジョブ %s の結果の送り直しを中止しました: %v", result.JobID, werr)
+				break
+			}
+			delay = min(delay*2, callbackMaxRetryDelay)
+		}
+		status.Attempts++
+		err = postCallback(ctx, callbackURL, body)
+		if err == nil {
+			break
+		}
+		log.Printf("ジョブ %s の結果の送信に失敗しました（%d 回目）: %v", result.JobID, status.Attempts, err)
+	}
+	if err != nil {
+		status.Status = "failed"
+		status.Error = err.Error()
+	} else {
+		status.Status = "sent"
+		log.Printf("ジョブ %s の結果を %s に送信しました。", result.JobID, callbackURL)
+	}
+	job.mu.Lock()
+	job.info.Callback = status
+	job.mu.Unlock()
+}
+
+// postCallback は署名した結果を1回 POST します。2xx 以外のステータスコードはエラーにします
+func postCallback(ctx context.Context, callbackURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Callback.TimeoutSeconds)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackTimestampHeader, timestamp)
+	req.Header.Set(callbackSignatureHeader, signCallback(cfg.Callback.Secret, timestamp, body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ステータスコード %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestCallback はテスト用の署名の鍵を設定し、テスト終了時に元に戻します
+func useTestCallback(t *testing.T, secret string) {
+	t.Helper()
+	orig := cfg.Callback
+	t.Cleanup(func() { cfg.Callback = orig })
+	cfg.Callback = CallbackConfig{Secret: secret, TimeoutSeconds: 5, MaxAttempts: 2, RetryDelaySeconds: 0}
+}
+
+func TestErrorCategory(t *testing.T) {
+	login := withCategory(errorLogin, fmt.Errorf("ログインに失敗しました: %w", errors.New("パスワードが違います")))
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{errors.New("その他"), errorUnknown},
+		{login, errorLogin},
+		{fmt.Errorf("ジョブ: %w", login), errorLogin},
+		{withCategory(errorScrape, fmt.Errorf("待機: %w", playwright.ErrTimeout)), errorTimeout},
+		{fmt.Errorf("zip: %w", errTachoEmpty), errorData},
+		{context.Canceled, errorCanceled},
+		// 送信のエラーをまとめた場合は内側の分類を使う
+		{withCategory(errorDelivery, errors.Join(withCategory(errorBrowser, errors.New("a")))), errorBrowser},
+		{errors.Join(errors.New("a"), withCategory(errorDelivery, errors.New("b"))), errorDelivery},
+	} {
+		assert.Equal(t, tc.want, errorCategory(tc.err), "%v", tc.err)
+	}
+	// 分類を付けてもエラーの文言は変わらない
+	assert.Equal(t, "ログインに失敗しました: パスワードが違います", login.Error())
+	assert.Nil(t, withCategory(errorLogin, nil))
+}
+
+func TestJobStepsAndTarget(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "etc-honsha")
+	job.SetStep("ログイン")
+	job.SetStep("ダウンロード")
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 0, 0, 0, 0, time.Local) }
+	job.SetTarget(siteEtcMeisai, day(10), day(20))
+	job.SetTarget(siteEtcMeisai, day(1), day(15))
+
+	info := job.Info()
+	assert.Equal(t, siteEtcMeisai, info.Site)
+	assert.Equal(t, &Range{From: "2026-09-01", To: "2026-09-20"}, info.Range)
+	assert.Len(t, info.Steps, 2)
+	assert.Equal(t, "ログイン", info.Steps[0].Name)
+	assert.NotNil(t, info.Steps[0].EndedAt)
+	assert.Nil(t, info.Steps[1].EndedAt)
+
+	job.finish(context.Background(), withCategory(errorLogin, errors.New("ログインに失敗しました")))
+	info = job.Info()
+	assert.NotNil(t, info.Steps[1].EndedAt)
+	assert.Equal(t, info.Steps[1].EndedAt.Sub(info.Steps[1].StartedAt).Milliseconds(), info.Steps[1].DurationMs)
+	assert.Equal(t, JobFailed, info.Status)
+	assert.Equal(t, errorLogin, info.ErrorCategory)
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	useTestCallback(t, "")
+	assert.Nil(t, validateCallbackURL(""))
+	assert.ErrorContains(t, validateCallbackURL("http://receiver/callback"), "CALLBACK_SECRET")
+
+	useTestCallback(t, "secret")
+	assert.Nil(t, validateCallbackURL("https://receiver/callback"))
+	assert.ErrorContains(t, validateCallbackURL("ftp://receiver/callback"), "は不正です")
+	assert.ErrorContains(t, validateCallbackURL("/callback"), "は不正です")
+}
+
+func TestJobCallback(t *testing.T) {
+	useTestCallback(t, "secret")
+	var mu sync.Mutex
+	var calls int
+	var body []byte
+	var signature, timestamp string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			// 1回目は失敗させ、送り直すことを確認する
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature, timestamp = r.Header.Get(callbackSignatureHeader), r.Header.Get(callbackTimestampHeader)
+	}))
+	defer receiver.Close()
+
+	store := NewJobStore(t.TempDir())
+	job := store.StartWithCallback(jobTypeGeneralCsv, "honsha", receiver.URL, func(ctx context.Context, job *Job) error {
+		job.SetStep("ダウンロード")
+		job.SetTarget(siteTheEarth, time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local), time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local))
+		path, err := job.ArtifactPath(artifactDownloads, "downloaded_file.zip")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte("PK"), 0644); err != nil {
+			return err
+		}
+		job.SetStep("ファイル送信")
+		return withCategory(errorDelivery, errors.New("ファイル送信失敗: ステータスコード 500"))
+	})
+	assert.Eventually(t, func() bool { return job.Info().Callback != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, &CallbackStatus{Status: "sent", Attempts: 2}, job.Info().Callback)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 受け取る側は X-Signature-Timestamp と本文から署名を検証できる
+	assert.Equal(t, signCallback("secret", timestamp, body), signature)
+	assert.NotEqual(t, signCallback("other", timestamp, body), signature)
+
+	var result JobResult
+	assert.Nil(t, json.Unmarshal(body, &result))
+	assert.Equal(t, job.Info().ID, result.JobID)
+	assert.Equal(t, jobTypeGeneralCsv, result.Type)
+	assert.Equal(t, siteTheEarth, result.Site)
+	assert.Equal(t, "honsha", result.Account)
+	assert.Equal(t, &Range{From: "2026-10-16", To: "2026-10-17"}, result.Range)
+	assert.Equal(t, JobFailed, result.Status)
+	assert.Equal(t, errorDelivery, result.ErrorCategory)
+	assert.Equal(t, "ファイル送信失敗: ステータスコード 500", result.Error)
+	assert.Len(t, result.Steps, 2)
+	assert.Equal(t, "ファイル送信", result.Steps[1].Name)
+	assert.NotNil(t, result.Steps[1].EndedAt)
+
+	sum := sha256.Sum256([]byte("PK"))
+	var zip *ResultArtifact
+	for i := range result.Artifacts {
+		if result.Artifacts[i].Path == "downloads/downloaded_file.zip" {
+			zip = &result.Artifacts[i]
+		}
+	}
+	if assert.NotNil(t, zip) {
+		assert.Equal(t, int64(2), zip.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), zip.SHA256)
+	}
+}
+
+func TestJobCallbackFailed(t *testing.T) {
+	useTestCallback(t, "secret")
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store := NewJobStore(t.TempDir())
+	job := store.StartWithCallback(jobTypeGeneralCsv, "", receiver.URL, func(ctx context.Context, job *Job) error { return nil })
+	assert.Eventually(t, func() bool { return job.Info().Callback != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, &CallbackStatus{Status: "failed", Attempts: 2, Error: "ステータスコード 500"}, job.Info().Callback)
+	assert.Equal(t, JobSucceeded, job.Info().Status)
+}
+
+func TestJobCallbackShutdown(t *testing.T) {
+	useTestCallback(t, "secret")
+	cfg.Callback.MaxAttempts, cfg.Callback.RetryDelaySeconds = 100, 3600
+	var requests atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	job := NewJobStore(t.TempDir()).New(jobTypeGeneralCsv, "")
+
+	// サーバーを停止した場合は送り直しを待たずに打ち切る
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sendJobCallback(ctx, job, receiver.URL)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("結果の送り直しが打ち切られませんでした")
+	}
+	assert.Equal(t, &CallbackStatus{Status: "failed", Attempts: 1, Error: "ステータスコード 500"}, job.Info().Callback)
+}
+
+func TestInitCallback(t *testing.T) {
+	useTestCallback(t, "secret")
+	cfg.Callback = DefaultConfig().Callback
+	assert.Nil(t, initCallback())
+
+	// 0以下のタイムアウトでは全ての送信が失敗するため、起動時にエラーにする
+	cfg.Callback.TimeoutSeconds = 0
+	assert.ErrorContains(t, initCallback(), "callback.timeoutSeconds 0 は不正です")
+	cfg.Callback = DefaultConfig().Callback
+	cfg.Callback.MaxAttempts = -1
+	assert.ErrorContains(t, initCallback(), "callback.maxAttempts -1 は不正です")
+	cfg.Callback = DefaultConfig().Callback
+	cfg.Callback.RetryDelaySeconds = 0
+	assert.ErrorContains(t, initCallback(), "callback.retryDelaySeconds 0 は不正です")
+}
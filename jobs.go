@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus はジョブの状態を表します
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"    // 受付済み（未実行）
+	JobRunning   JobStatus = "running"   // 実行中
+	JobSucceeded JobStatus = "succeeded" // 正常終了
+	JobFailed    JobStatus = "failed"    // 異常終了
+	JobCanceled  JobStatus = "canceled"  // DELETE /jobs/{id} によりキャンセル
+)
+
+// ジョブの種類
+const (
+	jobTypeGeneralCsv = "GeneralCsv" // theearth-np.com のデジタコCSV
+	jobTypeEtcMeisai  = "etc-meisai" // etc-meisai.jp の利用明細CSV
+)
+
+// errJobCanceled はキャンセルされたジョブの最終的なエラーです
+var errJobCanceled = errors.New("ジョブがキャンセルされました")
+
+// JobInfo は GET /jobs/{id} で返すジョブの状態です
+type JobInfo struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`              // GeneralCsv / etc-meisai
+	Account   string     `json:"account,omitempty"` // スケジュールなどで指定されたアカウント名
+	Status    JobStatus  `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Step      string     `json:"step"`            // 現在実行中のステップ
+	Error     string     `json:"error,omitempty"` // 最終的なエラー
+	// ErrorCategory はエラーの分類です（login / scrape / data / delivery / browser / timeout / canceled / unknown）
+	ErrorCategory string `json:"errorCategory,omitempty"`
+	Site          string `json:"site,omitempty"`  // スクレイピングしたサイト
+	Range         *Range `json:"range,omitempty"` // ダウンロードした期間（複数のアカウントの場合は全体）
+	// Steps はステップごとの開始・終了時刻です
+	Steps []StepTiming `json:"steps,omitempty"`
+	// Callback は callbackUrl への結果の送信の状態です
+	Callback *CallbackStatus `json:"callback,omitempty"`
+	// Manifest はダウンロードしたファイルに含まれるCSVとその行数です
+	Manifest []ManifestEntry `json:"manifest,omitempty"`
+	// Deliveries はアカウントごとの送信結果です（etc-meisai のみ）
+	Deliveries []DeliveryResult `json:"deliveries,omitempty"`
+}
+
+// DeliveryResult は1アカウント分の送信結果です
+type DeliveryResult struct {
+	Account string   `json:"account"`         // risLoginId
+	Status  string   `json:"status"`          // sent / downloaded / failed / skipped
+	Files   []string `json:"files,omitempty"` // ダウンロードしたファイルの名前
+	Error   string   `json:"error,omitempty"`
+	Outbox  string   `json:"outbox,omitempty"` // 送信に失敗したファイルを追加した送信待ちのID
+}
+
+// Range はジョブでダウンロードした期間です（2006-01-02 形式）
+type Range struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// StepTiming は1つのステップの開始・終了時刻です
+type StepTiming struct {
+	Name       string     `json:"name"`
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+}
+
+// ManifestEntry はダウンロードしたファイルに含まれる1つのCSVの情報です
+type ManifestEntry struct {
+	File string `json:"file"` // ダウンロードしたファイルの名前（zipの場合は zip 内のパスを "/" でつなげたもの）
+	Type string `json:"type"` // CSVの種類（operations / events / stops など。判別できない場合は unknown）
+	Rows int    `json:"rows"` // 見出しを除いた行数
+	Size int64  `json:"size"` // バイト数
+}
+
+// Job は1回のスクレイピング実行を表します
+// nil の Job に対してもメソッドを呼び出せるようにしているため、
+// テストなどジョブ管理の外から getPage / getEtcMeisai を呼ぶ場合は nil を渡せます
+type Job struct {
+	mu     sync.Mutex
+	info   JobInfo
+	cancel context.CancelFunc
+	done   chan struct{} // ジョブが終了すると閉じる
+	dir    string        // ジョブ専用の作業ディレクトリ（スクリーンショット・ダウンロード・ログ）
+
+	logMu     sync.Mutex
+	logFile   *os.File
+	logClosed bool
+}
+
+// SetStep は現在のステップを更新し、前のステップの終了時刻を記録します
+func (j *Job) SetStep(step string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	now := time.Now()
+	j.endStepLocked(now)
+	j.info.Step = step
+	j.info.Steps = append(j.info.Steps, StepTiming{Name: step, StartedAt: now})
+	j.mu.Unlock()
+	j.output(2, fmt.Sprintf("ジョブ %s: ステップ '%s' を開始します。", j.info.ID, step))
+}
+
+// Info はジョブの状態のコピーを返します
+func (j *Job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.Manifest = slices.Clone(j.info.Manifest)
+	info.Deliveries = slices.Clone(j.info.Deliveries)
+	info.Steps = slices.Clone(j.info.Steps)
+	if j.info.Range != nil {
+		r := *j.info.Range
+		info.Range = &r
+	}
+	if j.info.Callback != nil {
+		c := *j.info.Callback
+		info.Callback = &c
+	}
+	return info
+}
+
+// endStepLocked は実行中のステップの終了時刻を記録します
+func (j *Job) endStepLocked(now time.Time) {
+	n := len(j.info.Steps)
+	if n == 0 || j.info.Steps[n-1].EndedAt != nil {
+		return
+	}
+	last := &j.info.Steps[n-1]
+	last.EndedAt = &now
+	last.DurationMs = now.Sub(last.StartedAt).Milliseconds()
+}
+
+// SetTarget はスクレイピングするサイトと期間を記録します
+// 複数のアカウントで期間が異なる場合は、全ての期間を含むように広げます
+func (j *Job) SetTarget(site string, from, to time.Time) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.Site = site
+	r := Range{From: from.Format(rangeDateLayout), To: to.Format(rangeDateLayout)}
+	if j.info.Range != nil {
+		r.From = min(r.From, j.info.Range.From)
+		r.To = max(r.To, j.info.Range.To)
+	}
+	j.info.Range = &r
+}
+
+// AddManifest はジョブのマニフェストにCSVの情報を追加します
+func (j *Job) AddManifest(entries ...ManifestEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.Manifest = append(j.info.Manifest, entries...)
+}
+
+// SetDelivery はアカウントの送信結果を記録します。同じアカウントの結果が既にある場合は置き換えます
+func (j *Job) SetDelivery(result DeliveryResult) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := slices.IndexFunc(j.info.Deliveries, func(d DeliveryResult) bool { return d.Account == result.Account })
+	if i < 0 {
+		j.info.Deliveries = append(j.info.Deliveries, result)
+		return
+	}
+	j.info.Deliveries[i] = result
+}
+
+func (j *Job) start() {
+	now := time.Now()
+	j.mu.Lock()
+	j.info.Status = JobRunning
+	j.info.StartedAt = &now
+	j.mu.Unlock()
+}
+
+// Cancel は実行中または受付済みのジョブをキャンセルします
+// 既に終了しているジョブの場合は false を返します
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.info.EndedAt != nil || j.cancel == nil {
+		return false
+	}
+	log.Printf("ジョブ %s のキャンセルを要求しました。", j.info.ID)
+	j.cancel()
+	return true
+}
+
+// Done は Start で実行したジョブが終了すると閉じるチャネルを返します
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+func (j *Job) finish(ctx context.Context, err error) {
+	defer j.closeLog()
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.EndedAt = &now
+	j.endStepLocked(now)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// キャンセル後のエラーはブラウザを閉じたことによるものなので、キャンセルとして記録する
+		j.info.Status = JobCanceled
+		j.info.Error = errJobCanceled.Error()
+		j.info.ErrorCategory = errorCanceled
+		return
+	}
+	if err != nil {
+		j.info.Status = JobFailed
+		j.info.Error = err.Error()
+		j.info.ErrorCategory = errorCategory(err)
+		return
+	}
+	j.info.Status = JobSucceeded
+}
+
+// JobStore は実行中・実行済みのジョブをメモリ上で管理します
+// 各ジョブの作業ディレクトリは baseDir/<ジョブID> に作成します
+type JobStore struct {
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	baseDir string
+}
+
+// NewJobStore は空の JobStore を作成します
+func NewJobStore(baseDir string) *JobStore {
+	return &JobStore{jobs: make(map[string]*Job), baseDir: baseDir}
+}
+
+// serverCtx はサーバーの停止（SIGINT・SIGTERM）で Done になるコンテキストです
+// ジョブの終了後も続く処理（結果の送り直しなど）を停止時に打ち切るために使います
+var serverCtx = context.Background()
+
+// jobs はサーバー全体で共有するジョブストアです
+var jobs = NewJobStore(cfg.Dirs.Jobs)
+
+// New は queued 状態のジョブを作成して登録します
+func (s *JobStore) New(jobType string, account string) *Job {
+	id := newJobID()
+	job := &Job{info: JobInfo{
+		ID:        id,
+		Type:      jobType,
+		Account:   account,
+		Status:    JobQueued,
+		CreatedAt: time.Now(),
+	}, done: make(chan struct{}), dir: filepath.Join(s.baseDir, id)}
+	s.mu.Lock()
+	s.jobs[job.info.ID] = job
+	s.mu.Unlock()
+	return job
+}
+
+// Get は ID に対応するジョブを返します
+func (s *JobStore) Get(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// List は登録済みのジョブを作成日時の古い順に返します
+func (s *JobStore) List() []*Job {
+	s.mu.RLock()
+	list := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		list = append(list, job)
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].info.CreatedAt.Before(list[b].info.CreatedAt)
+	})
+	return list
+}
+
+// Latest は指定した種類・状態のジョブのうち最も新しいものを返します
+func (s *JobStore) Latest(jobType string, status JobStatus) (*Job, bool) {
+	list := s.List()
+	for i := len(list) - 1; i >= 0; i-- {
+		info := list[i].Info()
+		if info.Type == jobType && info.Status == status {
+			return list[i], true
+		}
+	}
+	return nil, false
+}
+
+// Active は同じ種類・アカウントのジョブが受付済みまたは実行中かどうかを返します
+func (s *JobStore) Active(jobType string, account string) bool {
+	for _, job := range s.List() {
+		info := job.Info()
+		if info.Type == jobType && info.Account == account && info.EndedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Start はジョブを作成し、fn をバックグラウンドで実行します
+// fn に渡す ctx はジョブがキャンセルされると Done になります
+// fn の戻り値がジョブの最終的な状態になります
+func (s *JobStore) Start(jobType string, account string, fn func(ctx context.Context, job *Job) error) *Job {
+	return s.StartWithCallback(jobType, account, "", fn)
+}
+
+// StartWithCallback は Start と同じようにジョブを実行し、終了後に callbackURL が空でなければ結果を送信します
+func (s *JobStore) StartWithCallback(jobType string, account string, callbackURL string, fn func(ctx context.Context, job *Job) error) *Job {
+	job := s.New(jobType, account)
+	ctx, cancel := context.WithCancel(context.Background())
+	job.mu.Lock()
+	job.cancel = cancel
+	job.mu.Unlock()
+	n := notifiers
+	go func() {
+		defer cancel()
+		job.start()
+		notifyJobStarted(n, job)
+		err := fn(ctx, job)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			job.Logf("ジョブ %s (%s) はキャンセルされました。", job.info.ID, jobType)
+		} else if err != nil {
+			job.Logf("ジョブ %s (%s) が失敗しました: %v", job.info.ID, jobType, err)
+		} else {
+			job.Logf("ジョブ %s (%s) が完了しました。", job.info.ID, jobType)
+		}
+		job.finish(ctx, err)
+		close(job.done)
+		notifyJobFinished(n, job)
+		if callbackURL != "" {
+			sendJobCallback(serverCtx, job, callbackURL)
+		}
+	}()
+	return job
+}
+
+// newJobID はランダムなジョブIDを生成します
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand が失敗することは通常ないが、念のため時刻で代用する
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForJob はジョブが終了状態になるまで待機します
+func waitForJob(t *testing.T, job *Job) JobInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info := job.Info()
+		if info.EndedAt != nil {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", job.Info().ID)
+	return JobInfo{}
+}
+
+func TestJobStoreStart(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+
+	release := make(chan struct{})
+	job := store.Start("GeneralCsv", "", func(ctx context.Context, job *Job) error {
+		job.SetStep("ログイン")
+		<-release
+		return nil
+	})
+	info := job.Info()
+	assert.NotEmpty(t, info.ID)
+	assert.Equal(t, "GeneralCsv", info.Type)
+
+	got, ok := store.Get(info.ID)
+	assert.True(t, ok, "Job should be registered in the store")
+	assert.Same(t, job, got)
+
+	close(release)
+	info = waitForJob(t, job)
+	assert.Equal(t, JobSucceeded, info.Status)
+	assert.Equal(t, "ログイン", info.Step)
+	assert.NotNil(t, info.StartedAt)
+	assert.NotNil(t, info.EndedAt)
+	assert.Empty(t, info.Error)
+}
+
+func TestJobStoreStartFailed(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.Start("etc-meisai", "", func(ctx context.Context, job *Job) error {
+		return errors.New("ダウンロードに失敗しました")
+	})
+	info := waitForJob(t, job)
+	assert.Equal(t, JobFailed, info.Status)
+	assert.Equal(t, "ダウンロードに失敗しました", info.Error)
+}
+
+func TestJobStoreCancel(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	started := make(chan struct{})
+	job := store.Start("GeneralCsv", "", func(ctx context.Context, job *Job) error {
+		close(started)
+		// キャンセルされるまで待機する
+		return sleepContext(ctx, time.Minute)
+	})
+	<-started
+	assert.True(t, job.Cancel(), "Running job should be cancelable")
+
+	info := waitForJob(t, job)
+	assert.Equal(t, JobCanceled, info.Status)
+	assert.Equal(t, errJobCanceled.Error(), info.Error)
+	assert.False(t, job.Cancel(), "Finished job should not be cancelable")
+}
+
+func TestJobStoreGetUnknown(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	_, ok := store.Get("unknown")
+	assert.False(t, ok)
+}
+
+func TestNilJobSetStep(t *testing.T) {
+	var job *Job
+	assert.NotPanics(t, func() { job.SetStep("ログイン") })
+}
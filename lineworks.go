@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LINE WORKS の Bot API の既定のURLです
+const (
+	lineWorksAuthURL = "https://auth.worksmobile.com/oauth2/v2.0/token"
+	lineWorksAPIURL  = "https://www.worksapis.com/v1.0"
+)
+
+// lineWorksTokenMargin はアクセストークンの有効期限のどれだけ前に取得し直すかです
+const lineWorksTokenMargin = 5 * time.Minute
+
+// LineWorksTarget はメッセージの送信先です。ChannelID（トークルーム）か UserID のどちらかを指定します
+type LineWorksTarget struct {
+	UserID    string
+	ChannelID string
+}
+
+func (t LineWorksTarget) path() string {
+	if t.ChannelID != "" {
+		return "channels/" + url.PathEscape(t.ChannelID)
+	}
+	return "users/" + url.PathEscape(t.UserID)
+}
+
+func (t LineWorksTarget) String() string {
+	if t.ChannelID != "" {
+		return "channel:" + t.ChannelID
+	}
+	return "user:" + t.UserID
+}
+
+// LineWorksClient は LINE WORKS の Bot API のクライアントです
+// サービスアカウントの JWT でアクセストークンを取得し、有効期限まで使い回します
+type LineWorksClient struct {
+	clientID       string
+	clientSecret   string
+	serviceAccount string
+	key            *rsa.PrivateKey
+	botID          string
+	defaultTo      LineWorksTarget // 設定ファイルの lineworks.channelId・userId
+	authURL        string
+	apiURL         string
+	httpClient     *http.Client
+	now            func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// lineWorksBotConfigured は Bot API を直接呼び出す設定があるかどうかを返します
+func lineWorksBotConfigured(c LineWorksConfig) bool {
+	return c.ClientID != "" || c.BotID != ""
+}
+
+// NewLineWorksClient は設定から Bot API のクライアントを作成します
+func NewLineWorksClient(c LineWorksConfig) (*LineWorksClient, error) {
+	var missing []string
+	for _, f := range []struct{ name, value string }{
+		{"clientId", c.ClientID}, {"clientSecret", c.ClientSecret}, {"serviceAccount", c.ServiceAccount},
+		{"privateKeyFile", c.PrivateKeyFile}, {"botId", c.BotID},
+	} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("LINE WORKS の Bot API には lineworks.%s が必要です", strings.Join(missing, "・"))
+	}
+	key, err := loadRSAPrivateKey(c.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("LINE WORKS の秘密鍵 '%s' の読み込みに失敗しました: %w", c.PrivateKeyFile, err)
+	}
+	client := &LineWorksClient{
+		clientID:       c.ClientID,
+		clientSecret:   c.ClientSecret,
+		serviceAccount: c.ServiceAccount,
+		key:            key,
+		botID:          c.BotID,
+		defaultTo:      LineWorksTarget{UserID: c.UserID, ChannelID: c.ChannelID},
+		authURL:        c.AuthURL,
+		apiURL:         strings.TrimSuffix(c.APIURL, "/"),
+		httpClient:     &http.Client{Timeout: time.Minute},
+		now:            time.Now,
+	}
+	if client.authURL == "" {
+		client.authURL = lineWorksAuthURL
+	}
+	if client.apiURL == "" {
+		client.apiURL = lineWorksAPIURL
+	}
+	return client, nil
+}
+
+// loadRSAPrivateKey は PEM の RSA 秘密鍵（PKCS#8 または PKCS#1）を読み込みます
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("PEM の形式ではありません")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("RSA の秘密鍵ではありません")
+	}
+	return key, nil
+}
+
+func (c *LineWorksClient) String() string {
+	return "LINE WORKS bot " + c.botID
+}
+
+// assertion はアクセストークンの取得に使うサービスアカウントの JWT（RS256）を作成します
+func (c *LineWorksClient) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss": c.clientID,
+		"sub": c.serviceAccount,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// accessToken はアクセストークンを返します。有効期限が近い場合は取得し直します
+func (c *LineWorksClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.token != "" && now.Before(c.expires.Add(-lineWorksTokenMargin)) {
+		return c.token, nil
+	}
+	assertion, err := c.assertion(now)
+	if err != nil {
+		return "", fmt.Errorf("JWT の署名に失敗しました: %w", err)
+	}
+	form := url.Values{
+		"assertion":     {assertion},
+		"grant_type":    {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"client_id":     {c.clientID},
+		"client_secret": {c.clientSecret},
+		"scope":         {"bot"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.authURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("アクセストークンの取得に失敗しました: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("アクセストークンの取得に失敗しました: ステータスコード %d, レスポンス: %s", resp.StatusCode, body)
+	}
+	// expires_in は文字列で返ることがある
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("アクセストークンのレスポンスが不正です: %s", body)
+	}
+	seconds, err := token.ExpiresIn.Int64()
+	if err != nil {
+		seconds = int64(time.Hour / time.Second)
+	}
+	c.token = token.AccessToken
+	c.expires = now.Add(time.Duration(seconds) * time.Second)
+	return c.token, nil
+}
+
+// invalidate はアクセストークンを破棄し、次の呼び出しで取得し直します
+func (c *LineWorksClient) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// do はアクセストークンを付けて API を呼び出します
+// 401 が返った場合はアクセストークンを取得し直して1回だけ呼び出し直します
+func (c *LineWorksClient) do(ctx context.Context, newRequest func() (*http.Request, error)) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			c.invalidate(token)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return body, fmt.Errorf("ステータスコード %d, レスポンス: %s", resp.StatusCode, body)
+		}
+		return body, nil
+	}
+}
+
+// postJSON は API に JSON を POST します
+func (c *LineWorksClient) postJSON(ctx context.Context, target string, payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// send はメッセージの content を送信先に送信します
+func (c *LineWorksClient) send(ctx context.Context, to LineWorksTarget, content map[string]any) error {
+	if to.ChannelID == "" && to.UserID == "" {
+		return errors.New("LINE WORKS の送信先（channelId または userId）が指定されていません")
+	}
+	target := c.apiURL + "/bots/" + url.PathEscape(c.botID) + "/" + to.path() + "/messages"
+	if _, err := c.postJSON(ctx, target, map[string]any{"content": content}); err != nil {
+		return fmt.Errorf("LINE WORKS の %s へのメッセージ送信に失敗しました: %w", to, err)
+	}
+	return nil
+}
+
+// SendText はテキストのメッセージを送信します
+func (c *LineWorksClient) SendText(ctx context.Context, to LineWorksTarget, text string) error {
+	return c.send(ctx, to, map[string]any{"type": "text", "text": text})
+}
+
+// SendLink はリンク付きのメッセージを送信します
+func (c *LineWorksClient) SendLink(ctx context.Context, to LineWorksTarget, text, linkText, link string) error {
+	return c.send(ctx, to, map[string]any{"type": "link", "contentText": text, "linkText": linkText, "link": link})
+}
+
+// SendFile はファイルをアップロードしてファイルのメッセージを送信します
+func (c *LineWorksClient) SendFile(ctx context.Context, to LineWorksTarget, file string) error {
+	fileID, err := c.upload(ctx, file)
+	if err != nil {
+		return fmt.Errorf("LINE WORKS へのファイル '%s' のアップロードに失敗しました: %w", filepath.Base(file), err)
+	}
+	return c.send(ctx, to, map[string]any{"type": "file", "fileId": fileID})
+}
+
+// upload はファイルのアップロード先を作成してファイルをアップロードし、ファイルIDを返します
+func (c *LineWorksClient) upload(ctx context.Context, file string) (string, error) {
+	body, err := c.postJSON(ctx, c.apiURL+"/bots/"+url.PathEscape(c.botID)+"/attachments", map[string]string{"fileName": filepath.Base(file)})
+	if err != nil {
+		return "", err
+	}
+	var attachment struct {
+		FileID    string `json:"fileId"`
+		UploadURL string `json:"uploadUrl"`
+	}
+	if err := json.Unmarshal(body, &attachment); err != nil || attachment.FileID == "" || attachment.UploadURL == "" {
+		return "", fmt.Errorf("アップロード先のレスポンスが不正です: %s", body)
+	}
+	_, err = c.do(ctx, func() (*http.Request, error) {
+		var b bytes.Buffer
+		writer := multipart.NewWriter(&b)
+		if err := writeFilePart(writer, multipartFile{Field: "Filedata", Path: file, Name: filepath.Base(file)}); err != nil {
+			return nil, err
+		}
+		writer.Close()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, attachment.UploadURL, &b)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return attachment.FileID, nil
+}
+
+// lineWorksBotNotifier は Bot API で LINE WORKS に直接通知します
+type lineWorksBotNotifier struct {
+	client *LineWorksClient
+	to     LineWorksTarget
+}
+
+func (n *lineWorksBotNotifier) Notify(ctx context.Context, note Notification) error {
+	return n.client.SendText(ctx, n.to, note.Message)
+}
+
+func (n *lineWorksBotNotifier) String() string {
+	return notifierLineWorksBot + " " + n.to.String()
+}
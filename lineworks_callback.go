@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// lineWorksSignatureHeader は LINE WORKS がボットへのメッセージに付ける署名のヘッダーです
+const lineWorksSignatureHeader = "X-WORKS-Signature"
+
+// lineWorksReplyTimeout はコマンドの結果の返信のタイムアウトです
+const lineWorksReplyTimeout = 30 * time.Second
+
+// lineWorksStatusJobs は status コマンドで返すジョブの数です
+const lineWorksStatusJobs = 5
+
+// lineWorksCommandSites はコマンドで指定するサイトの名前とジョブの種類です
+var lineWorksCommandSites = map[string]string{
+	"etc":   jobTypeEtcMeisai,
+	"tacho": jobTypeGeneralCsv,
+}
+
+// lineWorksCommandHelp はコマンドの使い方です
+const lineWorksCommandHelp = `使えるコマンド:
+etc 再取得 <エイリアス> [2026-09]: ETC利用明細を再取得します（月を省略した場合は既定の期間）
+tacho 再取得 <エイリアス> [2026-09]: デジタコのCSVを再取得します
+etc status / tacho status: 最近のジョブの状態
+jobs: 実行中のジョブ`
+
+// lineWorksEvent は LINE WORKS からボットに届くイベントです（使う項目のみ）
+type lineWorksEvent struct {
+	Type   string `json:"type"`
+	Source struct {
+		UserID    string `json:"userId"`
+		ChannelID string `json:"channelId"`
+	} `json:"source"`
+	Content struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+// lineWorksCommand は解析したボットへのコマンドです
+type lineWorksCommand struct {
+	action  string // rerun / status / jobs / help
+	jobType string
+	alias   string
+	month   string // 2006-01 形式（省略時は空）
+}
+
+// parseLineWorksCommand はボットへのメッセージからコマンドを解析します
+func parseLineWorksCommand(text string) (lineWorksCommand, error) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return lineWorksCommand{action: "help"}, nil
+	}
+	switch name := strings.ToLower(words[0]); name {
+	case "help", "ヘルプ":
+		return lineWorksCommand{action: "help"}, nil
+	case "jobs", "ジョブ":
+		return lineWorksCommand{action: "jobs"}, nil
+	}
+	jobType, ok := lineWorksCommandSites[strings.ToLower(words[0])]
+	if !ok {
+		return lineWorksCommand{}, fmt.Errorf("コマンド '%s' は使えません", words[0])
+	}
+	if len(words) < 2 {
+		return lineWorksCommand{}, fmt.Errorf("%s の後に 再取得 または status を指定してください", words[0])
+	}
+	switch strings.ToLower(words[1]) {
+	case "status", "状態":
+		return lineWorksCommand{action: "status", jobType: jobType}, nil
+	case "再取得", "rerun":
+		if len(words) < 3 || len(words) > 4 {
+			return lineWorksCommand{}, errors.New("再取得するアカウントのエイリアスと月（省略可）を指定してください（例: etc 再取得 honsha 2026-09）")
+		}
+		c := lineWorksCommand{action: "rerun", jobType: jobType, alias: words[2]}
+		if len(words) == 4 {
+			c.month = words[3]
+		}
+		return c, nil
+	}
+	return lineWorksCommand{}, fmt.Errorf("コマンド '%s %s' は使えません", words[0], words[1])
+}
+
+// monthRange は 2006-01 形式の月の初日と末日（今月の場合は今日）を 2006-01-02 形式で返します
+// month が空の場合は空を返します（サイトの既定の期間）
+func monthRange(month string, now time.Time) (string, string, error) {
+	if month == "" {
+		return "", "", nil
+	}
+	from, err := time.ParseInLocation("2006-01", month, now.Location())
+	if err != nil {
+		return "", "", fmt.Errorf("月 '%s' の形式が不正です（2006-01）", month)
+	}
+	to := from.AddDate(0, 1, -1)
+	if today := startOfDay(now); to.After(today) {
+		to = today
+	}
+	return from.Format(rangeDateLayout), to.Format(rangeDateLayout), nil
+}
+
+// verifyLineWorksSignature は本文の HMAC-SHA256（Bot Secret）を base64 エンコードしたものが署名と一致するかどうかを返します
+func verifyLineWorksSignature(secret string, body []byte, signature string) bool {
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// LineWorksCommands は LINE WORKS のボットへのメッセージのコマンドでジョブを開始・確認し、結果をボットで返信します
+type LineWorksCommands struct {
+	bot    *LineWorksClient
+	secret string
+	users  []string     // コマンドを実行できるユーザー（空の場合は全員）
+	sinks  []SinkConfig // コマンドで開始したジョブのファイルの送信先
+	store  *JobStore
+	now    func() time.Time
+
+	// startEtcMeisai・startGeneralCsv は /etc-meisai・/GeneralCsv と同じ処理でジョブを開始します（テストで差し替えます）
+	startEtcMeisai  func(account string, requestData requestData) *Job
+	startGeneralCsv func(account, txtID2, txtID1, txtPass string, sinks []Sink, rng exportRange, callbackUrl string) *Job
+}
+
+// NewLineWorksCommands は設定ファイルの lineworks からボットのコマンドの受け付けを作成します
+// botSecret が空の場合はコマンドを受け付けないため nil を返します
+func NewLineWorksCommands(c LineWorksConfig, bot *LineWorksClient, store *JobStore) (*LineWorksCommands, error) {
+	if c.BotSecret == "" {
+		return nil, nil
+	}
+	if bot == nil {
+		return nil, errors.New("lineworks.botSecret を指定した場合は Bot API の設定（clientId など）も必要です")
+	}
+	var sinks []SinkConfig
+	for _, name := range c.CommandSinks {
+		sinks = append(sinks, SinkConfig{Name: name})
+	}
+	if _, err := resolveSinks("", sinks); err != nil {
+		return nil, fmt.Errorf("lineworks.commandSinks: %w", err)
+	}
+	return &LineWorksCommands{
+		bot:             bot,
+		secret:          c.BotSecret,
+		users:           c.CommandUsers,
+		sinks:           sinks,
+		store:           store,
+		now:             time.Now,
+		startEtcMeisai:  startEtcMeisaiJob,
+		startGeneralCsv: startGeneralCsvJob,
+	}, nil
+}
+
+// ServeHTTP は POST /lineworks/callback のハンドラーです
+// 署名を検証してすぐに 200 を返し、コマンドの結果はボットで返信します
+func (c *LineWorksCommands) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "リクエストボディの読み込みに失敗しました。", http.StatusBadRequest)
+		return
+	}
+	if !verifyLineWorksSignature(c.secret, body, r.Header.Get(lineWorksSignatureHeader)) {
+		log.Printf("LINE WORKS のコールバックの署名が一致しません")
+		http.Error(w, "署名が一致しません。", http.StatusUnauthorized)
+		return
+	}
+	var event lineWorksEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "リクエストボディのJSONデコードに失敗しました。", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	// テキストのメッセージ以外（参加・退出など）は無視する
+	if event.Type != "message" || event.Content.Type != "text" {
+		return
+	}
+	to := LineWorksTarget{ChannelID: event.Source.ChannelID}
+	if to.ChannelID == "" {
+		to.UserID = event.Source.UserID
+	}
+	log.Printf("LINE WORKS のボットへのコマンド（%s）: %s", event.Source.UserID, event.Content.Text)
+	if len(c.users) > 0 && !slices.Contains(c.users, event.Source.UserID) {
+		log.Printf("ユーザー %s はボットのコマンドを実行できません", event.Source.UserID)
+		go c.reply(to, "コマンドを実行する権限がありません。", nil)
+		return
+	}
+	text, job := c.run(event.Content.Text)
+	go c.reply(to, text, job)
+}
+
+// reply はコマンドの結果を返信します。ジョブを開始した場合は終了後に結果も返信します
+func (c *LineWorksCommands) reply(to LineWorksTarget, text string, job *Job) {
+	send := func(text string) {
+		ctx, cancel := context.WithTimeout(context.Background(), lineWorksReplyTimeout)
+		defer cancel()
+		if err := c.bot.SendText(ctx, to, text); err != nil {
+			log.Printf("LINE WORKS のボットの返信（%s）に失敗しました: %v", to, err)
+		}
+	}
+	send(text)
+	if job == nil {
+		return
+	}
+	<-job.Done()
+	send(jobResultText(job.Info()))
+}
+
+// run はコマンドを実行し、返信するメッセージと開始したジョブ（開始しなかった場合は nil）を返します
+func (c *LineWorksCommands) run(text string) (string, *Job) {
+	cmd, err := parseLineWorksCommand(text)
+	if err != nil {
+		return err.Error() + "\n\n" + lineWorksCommandHelp, nil
+	}
+	switch cmd.action {
+	case "rerun":
+		job, err := c.rerun(cmd)
+		if err != nil {
+			return fmt.Sprintf("%s のジョブ（%s）を開始できませんでした: %v", cmd.jobType, cmd.alias, err), nil
+		}
+		info := job.Info()
+		period := ""
+		if cmd.month != "" {
+			from, to, _ := monthRange(cmd.month, c.now())
+			period = "、" + from + "〜" + to
+		}
+		return fmt.Sprintf("%s のジョブを開始しました（%s%s）。ジョブID: %s", info.Type, cmd.alias, period, info.ID), job
+	case "status":
+		return c.status(cmd.jobType), nil
+	case "jobs":
+		return c.activeJobs(), nil
+	}
+	return lineWorksCommandHelp, nil
+}
+
+// rerun は登録済みのアカウントのログイン情報で /etc-meisai・/GeneralCsv と同じ処理のジョブを開始します
+func (c *LineWorksCommands) rerun(cmd lineWorksCommand) (*Job, error) {
+	now := c.now()
+	from, to, err := monthRange(cmd.month, now)
+	if err != nil {
+		return nil, err
+	}
+	if c.store.Active(cmd.jobType, cmd.alias) {
+		return nil, errors.New("同じアカウントのジョブが実行中です")
+	}
+	if cmd.jobType == jobTypeEtcMeisai {
+		data, account, err := resolveEtcAccounts([]etcAccount{{Alias: cmd.alias}})
+		if err != nil {
+			return nil, err
+		}
+		requestData := requestData{Data: data, From: from, To: to, Sinks: c.sinks}
+		if err := requestData.validate(now); err != nil {
+			return nil, err
+		}
+		return c.startEtcMeisai(account, requestData), nil
+	}
+	credential, err := resolveCredential(cmd.alias, jobTypeGeneralCsv)
+	if err != nil {
+		return nil, err
+	}
+	site, _ := LookupSite(siteTheEarth)
+	rng, err := site.parseExportRange("", from, to, now)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := resolveSinks("", c.sinks)
+	if err != nil {
+		return nil, err
+	}
+	return c.startGeneralCsv(cmd.alias, credential.TxtID2, credential.TxtID1, credential.TxtPass, sinks, rng, ""), nil
+}
+
+// status はジョブの種類の最近のジョブの状態を返します
+func (c *LineWorksCommands) status(jobType string) string {
+	var lines []string
+	for _, job := range c.store.List() {
+		if info := job.Info(); info.Type == jobType {
+			lines = append(lines, jobStatusLine(info))
+		}
+	}
+	if len(lines) == 0 {
+		return jobType + " のジョブはありません。"
+	}
+	lines = lines[max(0, len(lines)-lineWorksStatusJobs):]
+	return jobType + " の最近のジョブ:\n" + strings.Join(lines, "\n")
+}
+
+// activeJobs は受付済み・実行中のジョブを返します
+func (c *LineWorksCommands) activeJobs() string {
+	var lines []string
+	for _, job := range c.store.List() {
+		if info := job.Info(); info.EndedAt == nil {
+			lines = append(lines, jobStatusLine(info))
+		}
+	}
+	if len(lines) == 0 {
+		return "実行中のジョブはありません。"
+	}
+	return "実行中のジョブ:\n" + strings.Join(lines, "\n")
+}
+
+// jobStatusLine はジョブの状態を1行で返します
+func jobStatusLine(info JobInfo) string {
+	line := fmt.Sprintf("- %s %s %s", info.CreatedAt.Format("01/02 15:04"), info.ID, info.Type)
+	if info.Account != "" {
+		line += " " + info.Account
+	}
+	line += ": " + string(info.Status)
+	switch {
+	case info.Error != "":
+		line += "（" + info.Error + "）"
+	case info.Status == JobRunning && info.Step != "":
+		line += "（" + info.Step + "）"
+	}
+	return line
+}
+
+// jobResultText はコマンドで開始したジョブの終了を知らせるメッセージです
+func jobResultText(info JobInfo) string {
+	name := info.Type
+	if info.Account != "" {
+		name += " " + info.Account
+	}
+	switch info.Status {
+	case JobSucceeded:
+		return fmt.Sprintf("ジョブ %s（%s）が完了しました。", info.ID, name)
+	case JobCanceled:
+		return fmt.Sprintf("ジョブ %s（%s）はキャンセルされました。", info.ID, name)
+	}
+	return fmt.Sprintf("ジョブ %s（%s）が失敗しました: %s", info.ID, name, info.Error)
+}
+
+// lineWorksCommands はサーバー起動時に設定から作成するボットのコマンドの受け付けです（無効の場合は nil）
+var lineWorksCommands *LineWorksCommands
+
+// initLineWorksCommands は設定ファイルの lineworks.botSecret があればボットのコマンドを受け付けます
+// 通知先と同じ Bot API のクライアントで返信するため、initNotifiers の後に呼び出します
+func initLineWorksCommands() error {
+	var bot *LineWorksClient
+	if notifiers != nil {
+		bot = notifiers.bot
+	}
+	c, err := NewLineWorksCommands(cfg.LineWorks, bot, jobs)
+	if err != nil {
+		return err
+	}
+	lineWorksCommands = c
+	if c != nil {
+		log.Printf("LINE WORKS のボットのコマンドを /lineworks/callback で受け付けます")
+	}
+	return nil
+}
+
+// handleLineWorksCallback は POST /lineworks/callback のハンドラーです
+func handleLineWorksCallback(w http.ResponseWriter, r *http.Request) {
+	c := lineWorksCommands
+	if c == nil {
+		http.Error(w, "LINE WORKS のボットのコマンドが有効になっていません（lineworks.botSecret を設定してください）", http.StatusServiceUnavailable)
+		return
+	}
+	c.ServeHTTP(w, r)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineWorksCommand(t *testing.T) {
+	for text, want := range map[string]lineWorksCommand{
+		"etc 再取得 honsha 2026-09": {action: "rerun", jobType: jobTypeEtcMeisai, alias: "honsha", month: "2026-09"},
+		"ETC　再取得　honsha":         {action: "rerun", jobType: jobTypeEtcMeisai, alias: "honsha"},
+		"tacho rerun honsha":     {action: "rerun", jobType: jobTypeGeneralCsv, alias: "honsha"},
+		"tacho status":           {action: "status", jobType: jobTypeGeneralCsv},
+		"jobs":                   {action: "jobs"},
+		" ":                      {action: "help"},
+		"ヘルプ":                    {action: "help"},
+	} {
+		cmd, err := parseLineWorksCommand(text)
+		assert.Nil(t, err, text)
+		assert.Equal(t, want, cmd, text)
+	}
+	for text, message := range map[string]string{
+		"kintone status": "コマンド 'kintone' は使えません",
+		"etc":            "再取得 または status を指定してください",
+		"etc 削除 honsha":  "コマンド 'etc 削除' は使えません",
+		"etc 再取得":        "エイリアスと月（省略可）を指定してください",
+		"etc 再取得 honsha 2026-09 多すぎる": "エイリアスと月（省略可）を指定してください",
+	} {
+		_, err := parseLineWorksCommand(text)
+		assert.ErrorContains(t, err, message, text)
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local)
+	from, to, err := monthRange("2026-09", now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2026-09-01", "2026-09-30"}, []string{from, to})
+
+	// 今月は今日まで
+	from, to, err = monthRange("2026-10", now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2026-10-01", "2026-10-17"}, []string{from, to})
+
+	from, to, err = monthRange("", now)
+	assert.Nil(t, err)
+	assert.Empty(t, from+to)
+
+	_, _, err = monthRange("2026/09", now)
+	assert.ErrorContains(t, err, "月 '2026/09' の形式が不正です")
+}
+
+// postLineWorksEvent は Bot Secret で署名したイベントを /lineworks/callback に送信します
+func postLineWorksEvent(c *LineWorksCommands, secret, body string) *httptest.ResponseRecorder {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/lineworks/callback", bytes.NewBufferString(body))
+	req.Header.Set(lineWorksSignatureHeader, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	return w
+}
+
+func lineWorksTextEvent(userID, text string) string {
+	return `{"type":"message","source":{"userId":"` + userID + `","domainId":1},"content":{"type":"text","text":"` + text + `"}}`
+}
+
+func TestLineWorksCommands(t *testing.T) {
+	standIn := newLineWorksStandIn(t)
+	bot, err := NewLineWorksClient(standIn.config())
+	assert.Nil(t, err)
+	credentialStore := useTestCredentials(t)
+	_, err = credentialStore.Create(Credential{Alias: "etc-honsha", Site: jobTypeEtcMeisai, RisLoginId: "ris-user", RisPassword: "ris-pass"})
+	assert.Nil(t, err)
+	_, err = credentialStore.Create(Credential{Alias: "honsha", Site: jobTypeGeneralCsv, TxtID1: "user", TxtID2: "company", TxtPass: "pass"})
+	assert.Nil(t, err)
+
+	store := NewJobStore(t.TempDir())
+	c, err := NewLineWorksCommands(LineWorksConfig{BotSecret: "bot-secret", CommandUsers: []string{"user-1"}}, bot, store)
+	assert.Nil(t, err)
+	c.now = func() time.Time { return time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local) }
+	release := make(chan struct{})
+	var etcRequest requestData
+	c.startEtcMeisai = func(account string, requestData requestData) *Job {
+		etcRequest = requestData
+		return store.Start(jobTypeEtcMeisai, account, func(ctx context.Context, job *Job) error {
+			<-release
+			return nil
+		})
+	}
+	var tachoRange exportRange
+	c.startGeneralCsv = func(account, txtID2, txtID1, txtPass string, sinks []Sink, rng exportRange, callbackUrl string) *Job {
+		tachoRange = rng
+		assert.Equal(t, []string{"company", "user", "pass"}, []string{txtID2, txtID1, txtPass})
+		return store.Start(jobTypeGeneralCsv, account, func(ctx context.Context, job *Job) error { return errTachoEmpty })
+	}
+	texts := func() []string {
+		var texts []string
+		for _, m := range standIn.received() {
+			assert.Equal(t, "users/user-1", m.Path)
+			texts = append(texts, m.Content["text"].(string))
+		}
+		return texts
+	}
+
+	// 登録済みのアカウントで /etc-meisai と同じ処理のジョブを開始し、終了したら結果を返信する
+	w := postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "etc 再取得 etc-honsha 2026-09"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Eventually(t, func() bool { return len(texts()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	job, _ := store.Latest(jobTypeEtcMeisai, JobRunning)
+	assert.Equal(t, "etc-meisai のジョブを開始しました（etc-honsha、2026-09-01〜2026-09-30）。ジョブID: "+job.Info().ID, texts()[0])
+	assert.Equal(t, []etcAccount{{RisLoginId: "ris-user", RisPassword: "ris-pass"}}, etcRequest.Data)
+	assert.Equal(t, []string{"2026-09-01", "2026-09-30"}, []string{etcRequest.From, etcRequest.To})
+
+	// 実行中のジョブは重複して開始しない
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "etc 再取得 etc-honsha"))
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "jobs"))
+	assert.Eventually(t, func() bool { return len(texts()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, texts(), "etc-meisai のジョブ（etc-honsha）を開始できませんでした: 同じアカウントのジョブが実行中です")
+	assert.Contains(t, texts(), "実行中のジョブ:\n- "+job.Info().CreatedAt.Format("01/02 15:04")+" "+job.Info().ID+" etc-meisai etc-honsha: running")
+
+	close(release)
+	assert.Eventually(t, func() bool { return len(texts()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "ジョブ "+job.Info().ID+"（etc-meisai etc-honsha）が完了しました。", texts()[3])
+
+	// デジタコの再取得は /GeneralCsv と同じ処理を開始する
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "tacho 再取得 honsha"))
+	assert.Eventually(t, func() bool { return len(texts()) == 6 }, 5*time.Second, 10*time.Millisecond)
+	// 月を省略した場合はサイトの既定の期間（昨日〜今日）
+	assert.Equal(t, []string{"2026-10-16", "2026-10-17"}, []string{tachoRange.From.Format(rangeDateLayout), tachoRange.To.Format(rangeDateLayout)})
+	tacho, _ := store.Latest(jobTypeGeneralCsv, JobFailed)
+	assert.Equal(t, "ジョブ "+tacho.Info().ID+"（GeneralCsv honsha）が失敗しました: "+errTachoEmpty.Error(), texts()[5])
+
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "tacho status"))
+	assert.Eventually(t, func() bool { return len(texts()) == 7 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "GeneralCsv の最近のジョブ:\n- "+tacho.Info().CreatedAt.Format("01/02 15:04")+" "+tacho.Info().ID+" GeneralCsv honsha: failed（"+errTachoEmpty.Error()+"）", texts()[6])
+
+	// 登録されていないアカウント・不正なコマンドはエラーを返信する
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "tacho 再取得 etc-honsha"))
+	assert.Eventually(t, func() bool { return len(texts()) == 8 }, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, texts()[7], "アカウント 'etc-honsha' は etc-meisai 用です")
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-1", "kintone"))
+	assert.Eventually(t, func() bool { return len(texts()) == 9 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "コマンド 'kintone' は使えません\n\n"+lineWorksCommandHelp, texts()[8])
+
+	// commandUsers にないユーザーのコマンドは実行しない
+	postLineWorksEvent(c, "bot-secret", lineWorksTextEvent("user-2", "etc 再取得 etc-honsha"))
+	assert.Eventually(t, func() bool { return len(standIn.received()) == 10 }, 5*time.Second, 10*time.Millisecond)
+	last := standIn.received()[9]
+	assert.Equal(t, "users/user-2", last.Path)
+	assert.Equal(t, "コマンドを実行する権限がありません。", last.Content["text"])
+	assert.Len(t, store.List(), 2)
+}
+
+func TestLineWorksCallbackSignature(t *testing.T) {
+	standIn := newLineWorksStandIn(t)
+	bot, err := NewLineWorksClient(standIn.config())
+	assert.Nil(t, err)
+	c, err := NewLineWorksCommands(LineWorksConfig{BotSecret: "bot-secret"}, bot, NewJobStore(t.TempDir()))
+	assert.Nil(t, err)
+
+	// 署名が一致しない場合は 401 を返してコマンドを実行しない
+	w := postLineWorksEvent(c, "other-secret", lineWorksTextEvent("user-1", "jobs"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	req := httptest.NewRequest(http.MethodPost, "/lineworks/callback", bytes.NewBufferString(lineWorksTextEvent("user-1", "jobs")))
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// テキスト以外のメッセージには返信しない
+	w = postLineWorksEvent(c, "bot-secret", `{"type":"join","source":{"channelId":"channel-1"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// トークルームのメッセージにはトークルームに返信する
+	w = postLineWorksEvent(c, "bot-secret", `{"type":"message","source":{"userId":"user-1","channelId":"channel-1"},"content":{"type":"text","text":"jobs"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Eventually(t, func() bool { return len(standIn.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, lineWorksPosted{Path: "channels/channel-1", Content: map[string]any{"type": "text", "text": "実行中のジョブはありません。"}}, standIn.received()[0])
+}
+
+func TestLineWorksCommandsConfig(t *testing.T) {
+	c, err := NewLineWorksCommands(LineWorksConfig{}, nil, jobs)
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+
+	_, err = NewLineWorksCommands(LineWorksConfig{BotSecret: "bot-secret"}, nil, jobs)
+	assert.ErrorContains(t, err, "Bot API の設定")
+
+	standIn := newLineWorksStandIn(t)
+	bot, err := NewLineWorksClient(standIn.config())
+	assert.Nil(t, err)
+	_, err = NewLineWorksCommands(LineWorksConfig{BotSecret: "bot-secret", CommandSinks: []string{"unknown"}}, bot, jobs)
+	assert.ErrorContains(t, err, "lineworks.commandSinks")
+
+	// 無効の場合は 503 を返す
+	orig := lineWorksCommands
+	t.Cleanup(func() { lineWorksCommands = orig })
+	lineWorksCommands = nil
+	w := httptest.NewRecorder()
+	handleLineWorksCallback(w, httptest.NewRequest(http.MethodPost, "/lineworks/callback", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
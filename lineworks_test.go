@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lineWorksStandIn は LINE WORKS の認証サーバーと Bot API の代わりにローカルで受信するサーバーです
+type lineWorksStandIn struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	keyFile  string
+	mu       sync.Mutex
+	tokens   int               // アクセストークンを発行した回数
+	revoked  map[string]bool   // 401 を返すアクセストークン
+	messages []lineWorksPosted // 受け取ったメッセージ
+	uploads  map[string]string // アップロードされたファイル（ファイルID → 内容）
+}
+
+// lineWorksPosted は lineWorksStandIn が受け取ったメッセージです
+type lineWorksPosted struct {
+	Path    string
+	Content map[string]any
+}
+
+func newLineWorksStandIn(t *testing.T) *lineWorksStandIn {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	s := &lineWorksStandIn{key: key, keyFile: keyFile, revoked: map[string]bool{}, uploads: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+		assert.Equal(t, "client-id", r.FormValue("client_id"))
+		assert.Equal(t, "client-secret", r.FormValue("client_secret"))
+		assert.Equal(t, "bot", r.FormValue("scope"))
+		claims, err := verifyTestJWT(r.FormValue("assertion"), &key.PublicKey)
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "client-id", claims["iss"])
+		assert.Equal(t, "bot@example.serviceaccount", claims["sub"])
+		s.mu.Lock()
+		s.tokens++
+		token := fmt.Sprintf("token-%d", s.tokens)
+		s.mu.Unlock()
+		// LINE WORKS は expires_in を文字列で返す
+		json.NewEncoder(w).Encode(map[string]string{"access_token": token, "token_type": "Bearer", "expires_in": "86400"})
+	})
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !ok || token == "" || s.revoked[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("POST /v1.0/bots/bot-1/{kind}/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		var body struct {
+			Content map[string]any `json:"content"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		s.mu.Lock()
+		s.messages = append(s.messages, lineWorksPosted{Path: r.PathValue("kind") + "/" + r.PathValue("id"), Content: body.Content})
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /v1.0/bots/bot-1/attachments", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		id := "file-" + body["fileName"]
+		json.NewEncoder(w).Encode(map[string]string{"fileId": id, "uploadUrl": s.server.URL + "/upload/" + id})
+	})
+	mux.HandleFunc("POST /upload/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		f, _, err := r.FormFile("Filedata")
+		if !assert.Nil(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		s.mu.Lock()
+		s.uploads[r.PathValue("id")] = string(data)
+		s.mu.Unlock()
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// config は lineWorksStandIn に接続する設定です
+func (s *lineWorksStandIn) config() LineWorksConfig {
+	return LineWorksConfig{
+		ClientID:       "client-id",
+		ClientSecret:   "client-secret",
+		ServiceAccount: "bot@example.serviceaccount",
+		PrivateKeyFile: s.keyFile,
+		BotID:          "bot-1",
+		ChannelID:      "channel-1",
+		AuthURL:        s.server.URL + "/oauth2/v2.0/token",
+		APIURL:         s.server.URL + "/v1.0",
+	}
+}
+
+func (s *lineWorksStandIn) received() []lineWorksPosted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]lineWorksPosted(nil), s.messages...)
+}
+
+func (s *lineWorksStandIn) tokenCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens
+}
+
+func (s *lineWorksStandIn) revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[token] = true
+}
+
+// verifyTestJWT は RS256 の JWT の署名を検証してクレームを返します
+func verifyTestJWT(token string, key *rsa.PublicKey) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWT の形式ではありません: %s", token)
+	}
+	var header map[string]string
+	data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(data, &header); err != nil || header["alg"] != "RS256" {
+		return nil, fmt.Errorf("ヘッダーが不正です: %s", data)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	data, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	return claims, json.Unmarshal(data, &claims)
+}
+
+func TestLineWorksClient(t *testing.T) {
+	standIn := newLineWorksStandIn(t)
+	client, err := NewLineWorksClient(standIn.config())
+	assert.Nil(t, err)
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.Nil(t, client.SendText(ctx, LineWorksTarget{ChannelID: "channel-1"}, "スクレイピング中にエラーが発生しました"))
+	assert.Nil(t, client.SendLink(ctx, LineWorksTarget{UserID: "user@example.com"}, "ジョブが失敗しました", "ジョブを開く", "http://scraper/jobs/1"))
+	file := writeTestFile(t, "etc-honsha.csv", "利用年月日,金額\n")
+	assert.Nil(t, client.SendFile(ctx, LineWorksTarget{ChannelID: "channel-1"}, file))
+
+	// アクセストークンは有効期限まで使い回す
+	assert.Equal(t, 1, standIn.tokenCount())
+	assert.Equal(t, []lineWorksPosted{
+		{Path: "channels/channel-1", Content: map[string]any{"type": "text", "text": "スクレイピング中にエラーが発生しました"}},
+		{Path: "users/user@example.com", Content: map[string]any{"type": "link", "contentText": "ジョブが失敗しました", "linkText": "ジョブを開く", "link": "http://scraper/jobs/1"}},
+		{Path: "channels/channel-1", Content: map[string]any{"type": "file", "fileId": "file-etc-honsha.csv"}},
+	}, standIn.received())
+	assert.Equal(t, map[string]string{"file-etc-honsha.csv": "利用年月日,金額\n"}, standIn.uploads)
+
+	// 有効期限が近づいたら取得し直す
+	now = now.Add(24*time.Hour - time.Minute)
+	assert.Nil(t, client.SendText(ctx, LineWorksTarget{ChannelID: "channel-1"}, "2"))
+	assert.Equal(t, 2, standIn.tokenCount())
+
+	// アクセストークンが無効になった場合（401）は取得し直して送り直す
+	standIn.revoke("token-2")
+	assert.Nil(t, client.SendText(ctx, LineWorksTarget{ChannelID: "channel-1"}, "3"))
+	assert.Equal(t, 3, standIn.tokenCount())
+	assert.Len(t, standIn.received(), 5)
+
+	assert.ErrorContains(t, client.SendText(ctx, LineWorksTarget{}, "宛先なし"), "送信先（channelId または userId）が指定されていません")
+	// 送信先のIDはパスとしてエスケープする
+	assert.Nil(t, client.SendText(ctx, LineWorksTarget{ChannelID: "channel-1/../x"}, "エスケープ"))
+	assert.Equal(t, "channels/channel-1/../x", standIn.received()[5].Path)
+}
+
+func TestLineWorksClientConfig(t *testing.T) {
+	standIn := newLineWorksStandIn(t)
+	c := standIn.config()
+	c.ClientSecret, c.PrivateKeyFile = "", ""
+	_, err := NewLineWorksClient(c)
+	assert.ErrorContains(t, err, "lineworks.clientSecret・privateKeyFile が必要です")
+
+	c = standIn.config()
+	c.PrivateKeyFile = writeTestFile(t, "private.key", "not a key")
+	_, err = NewLineWorksClient(c)
+	assert.ErrorContains(t, err, "PEM の形式ではありません")
+
+	// 誤ったクライアントシークレットなどでアクセストークンを取得できない場合
+	c = standIn.config()
+	c.AuthURL = standIn.server.URL + "/v1.0/bots/bot-1/users/x/messages"
+	client, err := NewLineWorksClient(c)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, client.SendText(context.Background(), client.defaultTo, "x"), "アクセストークンの取得に失敗しました: ステータスコード 401")
+}
+
+func TestLineWorksBotNotifier(t *testing.T) {
+	standIn := newLineWorksStandIn(t)
+
+	// 通知先を登録していない場合は、lineworks の既定の送信先に Bot API で送信する（プロキシは使わない）
+	lw := standIn.config()
+	lw.URL = "http://proxy.invalid/api/tasks"
+	n, err := NewNotifiers(NotifyConfig{}, lw)
+	assert.Nil(t, err)
+	assert.Equal(t, "lineworks-bot channel:channel-1", n.channels[notifierLineWorks].String())
+	assert.Nil(t, n.Notify(context.Background(), Notification{Severity: severityError, Message: "スクレイピング中にエラーが発生しました"}))
+
+	// 通知先ごとに送信先を指定できる
+	n, err = NewNotifiers(NotifyConfig{Channels: map[string]NotifierConfig{
+		"dispatch": {Type: notifierLineWorksBot, UserID: "dispatch@example.com"},
+	}}, lw)
+	assert.Nil(t, err)
+	assert.Nil(t, n.Notify(context.Background(), Notification{Severity: severityError, Message: "ETC"}))
+	assert.Equal(t, []lineWorksPosted{
+		{Path: "channels/channel-1", Content: map[string]any{"type": "text", "text": "スクレイピング中にエラーが発生しました"}},
+		{Path: "users/dispatch@example.com", Content: map[string]any{"type": "text", "text": "ETC"}},
+	}, standIn.received())
+
+	// /sendMessage は プロキシのURLが空の場合に Bot API で送信する
+	old := notifiers
+	t.Cleanup(func() { notifiers = old })
+	notifiers = n
+	origURL := cfg.LineWorks.URL
+	t.Cleanup(func() { cfg.LineWorks.URL = origURL })
+	cfg.LineWorks.URL = ""
+	assert.Nil(t, postErrorToLineWorksBot("メッセージ"))
+	assert.Len(t, standIn.received(), 3)
+
+	_, err = NewNotifiers(NotifyConfig{Channels: map[string]NotifierConfig{"bot": {Type: notifierLineWorksBot}}}, LineWorksConfig{})
+	assert.ErrorContains(t, err, "lineworks に Bot API の設定が必要です")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json" // JSONのエンコード/デコード用パッケージ
 	"errors"
 	"fmt"
@@ -11,6 +12,11 @@ import (
 	"net/http"
 	"net/textproto"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/natefinch/lumberjack"               // ログローテーションライブラリ
@@ -20,24 +26,118 @@ import (
 var defaultHTTPClient = &http.Client{}
 
 type Message struct {
-	Message string `json:"Message"` // JSONのフィールド名を指定
+	Message string `json:"Message"`         // JSONのフィールド名を指定
+	JobID   string `json:"jobId,omitempty"` // 非同期で開始したジョブのID
 }
 
 type requestData struct {
-	Data []struct {
-		RisLoginId  string `json:"risLoginId"`
-		RisPassword string `json:"risPassword"`
-	} `json:"data"`
-	ResUrl string `json:"resUrl"`
+	Data    []etcAccount `json:"data"`
+	ResUrl  string       `json:"resUrl"`
+	From    string       `json:"from,omitempty"` // 2006-01-02 形式（省略時は先月1日〜今日）
+	To      string       `json:"to,omitempty"`
+	Cards   []string     `json:"cards,omitempty"`   // 選択するETCカードの番号（省略時は設定ファイルの etcMeisai.cards。空なら全てのカード）
+	SokoKbn *int         `json:"sokoKbn,omitempty"` // 利用区分（省略時は設定ファイルの etcMeisai.sokoKbn）
+	Mode    string       `json:"mode,omitempty"`    // incremental の場合はアカウントごとに前回の同期日からの期間
+	Records string       `json:"records,omitempty"` // json / ndjson を指定するとCSVをレコードに変換したファイルも作成する
+	Sinks   []SinkConfig `json:"sinks,omitempty"`   // ダウンロードしたファイルの送信先
+	// Delivery は resUrl への送信方法です（account: アカウントごと / multipart・zip: 全てのアカウントをまとめて1回）
+	Delivery string `json:"delivery,omitempty"`
+	// CallbackUrl を指定するとジョブの終了時に結果（JSON）を送信する
+	CallbackUrl string `json:"callbackUrl,omitempty"`
+}
+
+// etcAccount は etc-meisai.jp のログイン情報です
+// alias を指定した場合は登録済みのアカウントのログイン情報を使います
+type etcAccount struct {
+	Alias       string   `json:"alias,omitempty"`
+	RisLoginId  string   `json:"risLoginId"`
+	RisPassword string   `json:"risPassword"`
+	Cards       []string `json:"cards,omitempty"` // このアカウントで選択するETCカードの番号（リクエストの cards より優先）
+}
+
+// exportRange はリクエストの期間を解析します。省略された場合は etc-meisai の既定の期間（先月1日〜今日）です
+func (d requestData) exportRange(now time.Time) (exportRange, error) {
+	site, _ := LookupSite(siteEtcMeisai)
+	return site.parseExportRange(d.Mode, d.From, d.To, now)
+}
+
+// validate はリクエストの期間・カード番号・利用区分を検証します
+func (d requestData) validate(now time.Time) error {
+	if _, err := d.exportRange(now); err != nil {
+		return err
+	}
+	if err := validateRecordsFormat(d.Records); err != nil {
+		return err
+	}
+	if err := validateDelivery(d.Delivery); err != nil {
+		return err
+	}
+	if err := validateCallbackURL(d.CallbackUrl); err != nil {
+		return err
+	}
+	if _, err := resolveSinks("", d.Sinks); err != nil {
+		return err
+	}
+	if d.SokoKbn != nil && *d.SokoKbn < 0 {
+		return fmt.Errorf("sokoKbn %d は不正です", *d.SokoKbn)
+	}
+	if _, err := normalizeCardNumbers(d.Cards); err != nil {
+		return err
+	}
+	for _, account := range d.Data {
+		if _, err := normalizeCardNumbers(account.Cards); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// params は1アカウント分のシナリオのパラメータ（ログイン情報・カード番号・利用区分）を作成します
+// 指定されていない項目は設定ファイルの値（シナリオの変数の既定値）を使います
+func (d requestData) params(account etcAccount) map[string]string {
+	params := map[string]string{"risLoginId": account.RisLoginId, "risPassword": account.RisPassword}
+	cards := d.Cards
+	if len(account.Cards) > 0 {
+		cards = account.Cards
+	}
+	if len(cards) > 0 {
+		normalized, _ := normalizeCardNumbers(cards)
+		params["cards"] = strings.Join(normalized, ",")
+	}
+	if d.SokoKbn != nil {
+		params["sokoKbn"] = strconv.Itoa(*d.SokoKbn)
+	}
+	return params
+}
+
+// normalizeCardNumbers はカード番号から区切り（- や空白）を取り除きます。数字以外を含む場合はエラーです
+func normalizeCardNumbers(cards []string) ([]string, error) {
+	normalized := make([]string, 0, len(cards))
+	for _, card := range cards {
+		n := strings.NewReplacer("-", "", " ", "", "　", "").Replace(card)
+		if n == "" || strings.Trim(n, "0123456789") != "" {
+			return nil, fmt.Errorf("カード番号 '%s' は不正です", card)
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
 }
 
 func main() {
+	// 設定ファイルを読み込む（URL・セレクター・待機時間・ディレクトリなど）
+	loaded, err := LoadConfig(configPath())
+	if err != nil {
+		log.Fatalf("設定の読み込みに失敗しました: %v", err)
+	}
+	cfg = loaded
+	jobs = NewJobStore(cfg.Dirs.Jobs)
+
 	logFile := &lumberjack.Logger{
-		Filename:   "./logs/my_application.log", // ログファイルのパス
-		MaxSize:    1,                           // MB単位。この例では1MBを超えるとローテーション
-		MaxBackups: 3,                           // 保持するバックアップログファイルの最大数
-		MaxAge:     28,                          // 日単位。ログファイルを保持する最大日数
-		Compress:   true,                        // ローテーションされたファイルをgzipで圧縮するかどうか
+		Filename:   filepath.Join(cfg.Dirs.Logs, "my_application.log"), // ログファイルのパス
+		MaxSize:    cfg.Dirs.LogMaxSizeMB,                              // MB単位。この例では1MBを超えるとローテーション
+		MaxBackups: cfg.Dirs.LogMaxBackups,                             // 保持するバックアップログファイルの最大数
+		MaxAge:     cfg.Dirs.LogMaxAgeDays,                             // 日単位。ログファイルを保持する最大日数
+		Compress:   true,                                               // ローテーションされたファイルをgzipで圧縮するかどうか
 	}
 
 	// 標準のロガーの出力を設定
@@ -51,13 +151,51 @@ func main() {
 
 	log.Println("サーバー起動中...")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // デフォルトのポート
-		log.Printf("環境変数PORTが設定されていないため、デフォルトポート %s を使用します。", port)
-	} else {
-		log.Printf("環境変数PORTからポート %s を取得しました。", port)
+	// 保持期間を過ぎたジョブの作業ディレクトリを定期的に削除する
+	jobs.StartJanitor(time.Duration(cfg.Jobs.RetentionHours)*time.Hour, jobJanitorInterval)
+
+	// Playwrightのランタイムとブラウザプールはサーバー起動時に1度だけ準備する
+	if err := initBrowserPool(); err != nil {
+		log.Fatalf("ブラウザプールの初期化に失敗しました: %v", err)
 	}
+
+	// エイリアスで登録したアカウントの保存先を開く（スケジュールからも参照するため先に開く）
+	if err := initCredentials(); err != nil {
+		log.Fatalf("アカウントの保存先の初期化に失敗しました: %v", err)
+	}
+
+	// incremental で使う同期日を読み込む（スケジュールからも参照するため先に開く）
+	if err := initSyncStore(); err != nil {
+		log.Fatalf("同期日の読み込みに失敗しました: %v", err)
+	}
+
+	// 通知先を作成する（設定ファイルの notify。ない場合は LINE WORKS のボットのプロキシ）
+	if err := initNotifiers(); err != nil {
+		log.Fatalf("通知先の初期化に失敗しました: %v", err)
+	}
+
+	// LINE WORKS のボットへのメッセージのコマンドを受け付ける（返信に通知先の Bot API のクライアントを使うため通知先の後に作成する）
+	if err := initLineWorksCommands(); err != nil {
+		log.Fatalf("LINE WORKS のボットのコマンドの初期化に失敗しました: %v", err)
+	}
+
+	// 送信に失敗したファイルの再送を開始する（スケジュールのジョブからも追加するため先に開く）
+	if err := initOutbox(); err != nil {
+		log.Fatalf("送信待ちの初期化に失敗しました: %v", err)
+	}
+
+	// ジョブの結果の送信の設定を検証する
+	if err := initCallback(); err != nil {
+		log.Fatalf("結果の送信の設定が不正です: %v", err)
+	}
+
+	// スケジュール定義ファイルがあれば定期実行を開始する
+	if err := initScheduler(); err != nil {
+		log.Fatalf("スケジューラーの初期化に失敗しました: %v", err)
+	}
+
+	port := cfg.Server.Port // 環境変数PORTが設定されていればその値
+	log.Printf("ポート %s を使用します。", port)
 	// httpサーバーを起動
 	// ここではバックグラウンドでHTTPサーバーを起動して、後で値を取得するためのエンドポイントを提供します
 
@@ -73,23 +211,50 @@ func main() {
 		txtPass := r.FormValue("txtPass")
 		resUrl := r.FormValue("resUrl")
 		w.Header().Set("Content-Type", "application/json")
+		// aliasが指定された場合は登録済みのアカウントのログイン情報を使う
+		alias := r.FormValue("alias")
+		if alias != "" {
+			c, err := resolveCredential(alias, jobTypeGeneralCsv)
+			if err != nil {
+				w.WriteHeader(credentialErrorStatus(err))
+				returnJson(w, Message{Message: err.Error()})
+				return
+			}
+			txtID2, txtID1, txtPass = c.TxtID2, c.TxtID1, c.TxtPass
+		}
 		if txtID2 == "" || txtID1 == "" || txtPass == "" { // いずれかの値が空の場合,responseにエラーメッセージを返す
 			returnJson(w, Message{Message: "txtID2, txtID1, txtPassのいずれかが空です。"})
 			return
 		}
-		go func() {
-			// Playwrightを使ってウェブサイトをスクレイピング
-			err := getPage(txtID2, txtID1, txtPass, resUrl)
-			if err != nil {
-				log.Printf("スクレイピング中にエラーが発生しました: %v", err)
-				postErrorToLineWorksBot("スクレイピング中にエラーが発生しました")
-				postErrorToLineWorksBot(fmt.Sprintf("スクレイピング中にエラーが発生しました: %v", err))
-
-			}
-
-		}()
+		// from・to（2006-01-02 形式）を省略した場合は昨日〜今日、mode=incremental の場合は前回の同期日から今日まで
+		site, _ := LookupSite(siteTheEarth)
+		rng, err := site.parseExportRange(r.FormValue("mode"), r.FormValue("from"), r.FormValue("to"), time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			returnJson(w, Message{Message: err.Error()})
+			return
+		}
+		// resUrl に加えて、設定ファイルの sinks に登録した送信先を sink で指定できる（複数可）
+		var sinkConfigs []SinkConfig
+		for _, name := range r.Form["sink"] {
+			sinkConfigs = append(sinkConfigs, SinkConfig{Name: name})
+		}
+		sinks, err := resolveSinks(resUrl, sinkConfigs)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			returnJson(w, Message{Message: err.Error()})
+			return
+		}
+		// callbackUrl を指定するとジョブの終了時に結果（JSON）を送信する
+		callbackUrl := r.FormValue("callbackUrl")
+		if err := validateCallbackURL(callbackUrl); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			returnJson(w, Message{Message: err.Error()})
+			return
+		}
+		job := startGeneralCsvJob(alias, txtID2, txtID1, txtPass, sinks, rng, callbackUrl)
 		w.WriteHeader(http.StatusOK)
-		returnJson(w, Message{Message: "スクレイピングを開始しました。"})
+		returnJson(w, Message{Message: "スクレイピングを開始しました。", JobID: job.Info().ID})
 
 	})
 	http.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
@@ -103,15 +268,38 @@ func main() {
 			return
 		}
 		// ファイルをアップロードするためのエンドポイント
-		filePath := "./file/downloaded_file.zip" // ここでダウンロードしたファイルのパスを指定
+		// jobIdが指定されていない場合は、最後に成功したGeneralCsvジョブのファイルを送信する
+		var job *Job
+		if jobId := r.FormValue("jobId"); jobId != "" {
+			found, ok := jobs.Get(jobId)
+			if !ok {
+				http.Error(w, "指定されたジョブが見つかりません。", http.StatusNotFound)
+				return
+			}
+			job = found
+		} else {
+			latest, ok := jobs.Latest(jobTypeGeneralCsv, JobSucceeded)
+			if !ok {
+				http.Error(w, "ダウンロードしたファイルが存在しません。", http.StatusNotFound)
+				return
+			}
+			job = latest
+		}
+		filePath := filepath.Join(job.Dir(), artifactDownloads, "downloaded_file.zip") // ここでダウンロードしたファイルのパスを指定
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
 			http.Error(w, "ダウンロードしたファイルが存在しません。", http.StatusNotFound)
 			return
 		}
 		// ファイルを指定されたURLにPOSTリクエストで送信
-		err := postFileToServer(filePath, resUrl)
+		err := postFileToServer(r.Context(), filePath, resUrl)
 		if err != nil {
 			log.Printf("ファイルのPOST送信に失敗しました: %v", err)
+			// 受信側が停止している場合に備えて送信待ちに追加し、後で再送する
+			sink := &httpSink{URL: resUrl}
+			if id := queueFailedFiles(job, sink, []multipartFile{{Path: filePath, Name: filepath.Base(filePath)}}, err); id != "" {
+				http.Error(w, fmt.Sprintf("ファイルのPOST送信に失敗しました。送信待ち %s に追加しました。", id), http.StatusInternalServerError)
+				return
+			}
 			http.Error(w, "ファイルのPOST送信に失敗しました。", http.StatusInternalServerError)
 			return
 		}
@@ -138,18 +326,20 @@ func main() {
 			http.Error(w, "リクエストボディのJSONデコードに失敗しました。", http.StatusBadRequest)
 			return
 		}
-		go func() {
-
-			err := getEtcMeisai(requestData)
-			if err != nil {
-				log.Printf("etc-meisai.jpからのデータ取得中にエラーが発生しました: %v", err)
-				postErrorToLineWorksBot(fmt.Sprintf("etc-meisai.jpからのデータ取得中にエラーが発生しました: %v", err))
-				http.Error(w, "etc-meisai.jpからのデータ取得に失敗しました。", http.StatusInternalServerError)
-				return
-			}
-		}()
+		// aliasが指定されたアカウントは登録済みのログイン情報に置き換える
+		data, account, err := resolveEtcAccounts(requestData.Data)
+		if err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		requestData.Data = data
+		if err := requestData.validate(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job := startEtcMeisaiJob(account, requestData)
 		log.Println("etc-meisai.jpからのデータ取得を開始しました。")
-		returnJson(w, Message{Message: "etc-meisai.jpからのデータ取得を開始しました。"})
+		returnJson(w, Message{Message: "etc-meisai.jpからのデータ取得を開始しました。", JobID: job.Info().ID})
 
 	})
 	http.HandleFunc("/sendMessage", func(w http.ResponseWriter, r *http.Request) {
@@ -172,8 +362,72 @@ func main() {
 		returnJson(w, Message{Message: "LINE WORKSのボットへのメッセージ送信に成功しました。"})
 	})
 
+	// LINE WORKS のボットへのメッセージ（etc 再取得 <エイリアス> 2026-09 など）でジョブを開始・確認するためのエンドポイント
+	http.HandleFunc("/lineworks/callback", handleLineWorksCallback)
+
+	// ジョブの状態を取得するためのエンドポイント
+	// GETでジョブの状態を取得し、DELETEで実行中のジョブをキャンセルする
+	http.HandleFunc("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := jobs.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "指定されたジョブが見つかりません。", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(job.Info()); err != nil {
+				log.Printf("JSONエンコードエラー: %v", err)
+			}
+		case http.MethodDelete:
+			if !job.Cancel() {
+				http.Error(w, "ジョブは既に終了しています。", http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			returnJson(w, Message{Message: "ジョブのキャンセルを要求しました。", JobID: job.Info().ID})
+		default:
+			http.Error(w, "GETまたはDELETEメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ジョブの成果物（ダウンロードしたファイル・スクリーンショット・トレース・ログ）を取得するためのエンドポイント
+	http.HandleFunc("/jobs/{id}/artifacts", handleJobArtifacts)
+	http.HandleFunc("/jobs/{id}/artifacts/{path...}", handleJobArtifact)
+
+	// スケジュールの次回・前回の実行時刻を取得するためのエンドポイント
+	http.HandleFunc("/schedules", handleSchedules)
+
+	// incremental の同期日（アカウント・サイトごとの最後に送信まで成功した日）を取得するためのエンドポイント
+	http.HandleFunc("/sync", handleSyncMarks)
+
+	// 送信に失敗したファイルの送信待ちを取得・再送するためのエンドポイント
+	http.HandleFunc("/deliveries", handleDeliveries)
+	http.HandleFunc("/deliveries/{id}/retry", handleDeliveryRetry)
+
+	// アカウントをエイリアスで登録・取得・更新・削除するためのエンドポイント
+	http.HandleFunc("/accounts", handleAccounts)
+	http.HandleFunc("/accounts/{alias}", handleAccount)
+
+	// 登録されているサイトのアダプターでスクレイピングを開始するためのエンドポイント
+	http.HandleFunc("/scrape/{site}", handleScrape)
+
+	// SIGINT・SIGTERM を受け取ったら新しいリクエストの受け付けを止め、結果の送り直しなどを打ち切る
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverCtx = ctx
+	server := &http.Server{Addr: ":" + port}
+	go func() {
+		<-ctx.Done()
+		log.Println("サーバーを停止します...")
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Printf("HTTPサーバーの停止に失敗しました: %v", err)
+		}
+	}()
+
 	log.Printf("HTTPサーバーを :%s で起動します", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("HTTPサーバーの起動に失敗しました: %v", err)
 	}
 
@@ -183,233 +437,146 @@ func main() {
 	// ...
 }
 
-func getEtcMeisai(requestData requestData) error {
+// startGeneralCsvJob は /GeneralCsv と同じ処理をジョブとしてバックグラウンドで開始します
+// account はスケジュールなどでアカウント名が分かっている場合に指定します（HTTPから直接呼ぶ場合は空）
+// 期間がゼロ値の場合は、ジョブの実行時にサイトの既定の期間（昨日〜今日）を使います
+// callbackUrl が空でなければ、ジョブの終了時に結果を送信します
+func startGeneralCsvJob(account, txtID2, txtID1, txtPass string, sinks []Sink, rng exportRange, callbackUrl string) *Job {
+	return jobs.StartWithCallback(jobTypeGeneralCsv, account, callbackUrl, func(ctx context.Context, job *Job) error {
+		// Playwrightを使ってウェブサイトをスクレイピング
+		err := getPage(ctx, job, txtID2, txtID1, txtPass, sinks, rng)
+		if err != nil {
+			log.Printf("スクレイピング中にエラーが発生しました: %v", err)
+			notifyJobError(job, fmt.Sprintf("スクレイピング中にエラーが発生しました: %v", err), err)
+		}
+		return err
+	})
+}
 
-	// ここでは、risLoginIdとrisPasswordを使ってetc-meisai.jpからCSVを取得する処理を実装します
-	// Playwrightを使ってウェブサイトにアクセスし、ログインしてCSVをダウンロードするなどの処理を行います
-	err := playwright.Install()
-	if err != nil {
-		log.Fatalf("Playwright のインストールに失敗しました: %v", err)
-	}
-	log.Println("Playwright ブラウザがインストールされました！")
+// startEtcMeisaiJob は /etc-meisai と同じ処理をジョブとしてバックグラウンドで開始します
+// account はスケジュールなどでアカウント名が分かっている場合に指定します（HTTPから直接呼ぶ場合は空）
+func startEtcMeisaiJob(account string, requestData requestData) *Job {
+	return jobs.StartWithCallback(jobTypeEtcMeisai, account, requestData.CallbackUrl, func(ctx context.Context, job *Job) error {
+		err := getEtcMeisai(ctx, job, requestData)
+		if err != nil {
+			log.Printf("etc-meisai.jpからのデータ取得中にエラーが発生しました: %v", err)
+			notifyJobError(job, fmt.Sprintf("etc-meisai.jpからのデータ取得中にエラーが発生しました: %v", err), err)
+		}
+		return err
+	})
+}
 
-	err = os.MkdirAll("./etc-file", 0755)
-	if err != nil {
-		log.Fatalf("etc-fileディレクトリの作成に失敗しました: %v", err)
-	} else {
-		log.Println("etc-fileディレクトリが作成されました。")
-	}
+func getEtcMeisai(ctx context.Context, job *Job, requestData requestData) error {
 
-	files, err := os.ReadDir("./etc-file")
+	// ここでは、risLoginIdとrisPasswordを使ってetc-meisai.jpからCSVを取得する処理を実装します
+	// Playwrightを使ってウェブサイトにアクセスし、ログインしてCSVをダウンロードするなどの処理を行います
+	// ダウンロードしたCSVはジョブごとの作業ディレクトリに保存するため、既存のファイルの削除は不要
+	rng, err := requestData.exportRange(time.Now())
 	if err != nil {
-		log.Fatalf("fileディレクトリの読み取りに失敗しました: %v", err)
-	} else {
-		if len(files) > 0 {
-			log.Println("fileディレクトリに既存のファイルがあります。")
-			// 既存のファイルを削除
-			for _, file := range files {
-				err := os.Remove("./etc-file/" + file.Name())
-				if err != nil {
-					log.Printf("ファイル '%s' の削除に失敗しました: %v", file.Name(), err)
-				} else {
-					log.Printf("ファイル '%s' を削除しました。\n", file.Name())
-				}
-			}
-			log.Println("fileディレクトリの既存のファイルを削除しました。")
-		} else {
-			log.Println("fileディレクトリは空です。")
-		}
+		return err
 	}
-
-	// Playwrightの起動
-	// pw, err := playwright.Run()
-	pw, err := playwright.Run()
-	// ここでPlaywrightのオプションを設定できます
+	sinks, err := resolveSinks("", requestData.Sinks)
 	if err != nil {
-		log.Fatalf("Playwright の起動に失敗しました: %v", err)
+		return err
 	}
-	defer pw.Stop()
-
+	bundled := requestData.ResUrl != "" && (requestData.Delivery == deliveryMultipart || requestData.Delivery == deliveryZip)
+	site, _ := LookupSite(siteEtcMeisai)
+	var downloads []etcDownload
+	var errs []error
 	for _, data := range requestData.Data {
-		risLoginId := data.RisLoginId
-		risPassword := data.RisPassword
-		log.Printf("処理対象: risLoginId=%s", risLoginId)
-
-		// browser, err := pw.Chromium.Launch()
-		browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-			Headless: playwright.Bool(true), // ヘッドレスモードを有効にする場合はtrue、GUIを表示したい場合はfalseに設定
-		})
-		if err != nil {
-			log.Fatalf("ブラウザの起動に失敗しました: %v", err)
-		}
-		defer browser.Close() // プログラム終了時にブラウザを確実に閉じる
-		log.Printf("etc-meisai.jpにログイン中: %s", risLoginId)
-		page, err := browser.NewPage()
+		// incremental の場合はアカウントごとに同期日が異なる
+		params := requestData.params(data)
+		from, to, ok, err := rng.resolve(site, params, time.Now())
 		if err != nil {
-			log.Fatalf("ページの作成に失敗しました: %v", err)
-		}
-
-		// 目的のURLに移動
-		targetURL := "https://www2.etc-meisai.jp/etc/R?funccode=1013000000&nextfunc=1013000000" // スクレイピングしたいウェブサイトのURLに変更してください
-		log.Printf("URLにアクセス中: %s", targetURL)
-		_, err = page.Goto(targetURL)
-		if err != nil {
-			log.Fatalf("URLへの移動に失敗しました: %v", err)
-		}
-		title, err := page.Title()
-		if err != nil {
-			log.Printf("タイトル取得中にエラー: %v", err)
-			title = "取得できませんでした"
 			return err
 		}
-
-		log.Printf("ページのタイトル: %s\n", title)
-		// ここでPlaywrightを使ってログイン処理やCSVダウンロード処理を実装します
-		log.Println("ログイン処理を開始します。")
-		err = waitForSelectorWithName(page, "focusTarget", 10000) // ログインIDの入力フィールドが表示されるまで待機
-		if err != nil {
-			log.Printf("ログインIDの入力フィールドの表示待機中にエラーが発生しました: %v", err)
+		if !ok {
+			job.Logf("risLoginId=%s は前回の同期日以降にダウンロードする期間がないため、スキップします。", data.RisLoginId)
+			job.SetDelivery(DeliveryResult{Account: data.RisLoginId, Status: deliverySkipped})
+			continue
 		}
-		// ログインIDの入力フィールドに値を入力
-		err = inputSelectorWithName(page, "risLoginId", risLoginId)
+		files, err := downloadEtcMeisaiCsv(ctx, job, params, from, to, requestData.Records)
 		if err != nil {
-			log.Printf("ログインIDの入力中にエラーが発生しました: %v", err)
+			job.SetDelivery(DeliveryResult{Account: data.RisLoginId, Status: deliveryFailed, Error: err.Error()})
+			errs = append(errs, fmt.Errorf("risLoginId=%s: %w", data.RisLoginId, err))
+			if ctx.Err() != nil {
+				// キャンセルされた場合は残りのアカウントを処理しない
+				return errors.Join(errs...)
+			}
+			// ダウンロードに失敗しても残りのアカウントは処理し、まとめて送信する場合は成功したアカウントだけを送信する
+			job.Logf("risLoginId=%s のダウンロードに失敗しました: %v", data.RisLoginId, err)
+			continue
 		}
-		err = inputSelectorWithName(page, "risPassword", risPassword) // パスワードの入力フィールドが表示されるまで待機
-		if err != nil {
-			return err
+		d := etcDownload{params: params, to: to, files: files}
+		// sinks にはアカウントごとに送信する
+		err = deliverFiles(ctx, job, sinks, files)
+		if err == nil && requestData.ResUrl != "" && !bundled {
+			job.Logf("risLoginId=%s のファイルを送信します: %s", data.RisLoginId, requestData.ResUrl)
+			err = postEtcAccount(ctx, job, requestData.ResUrl, d)
 		}
-		err = clickSelectorWithName(page, "focusTarget", 10000)
 		if err != nil {
-			log.Printf("ログインボタンのクリック中にエラーが発生しました: %v", err)
+			// 送信に失敗しても残りのアカウントは処理する
+			job.Logf("risLoginId=%s のファイルの送信に失敗しました: %v", data.RisLoginId, err)
+			job.SetDelivery(d.result(deliveryFailed, err))
+			errs = append(errs, withCategory(errorDelivery, fmt.Errorf("risLoginId=%s: %w", data.RisLoginId, err)))
+			continue
 		}
-
-		//3秒待機
-		log.Println("ログインボタンをクリックしました。3秒待機します。")
-		time.Sleep(3 * time.Second)
-
-		//pageの情報を取得
-		log.Println("ログインボタンをクリックした後のページ情報を取得します。")
-		// ページのURLを取得
-		currentURL := page.URL()
-		log.Printf("現在のURL: %s\n", currentURL)
-		//https://www2.etc-meisai.jp/etc/R?funccode=1013000000&nextfunc=1013000000
-		//https://www2.etc-meisai.jp/etc/R?funccode=1013000000&nextfunc=1013000000
-
-		//page に1014000000が含まれているか確認
-		content, err := page.Content()
-
-		if err != nil {
-			log.Printf("ページの内容取得中にエラーが発生しました: %v", err)
+		if bundled {
+			downloads = append(downloads, d)
+			continue
+		}
+		if err := d.finish(job, site, rng, len(sinks) > 0 || requestData.ResUrl != ""); err != nil {
 			return err
-
 		}
-		if contains(content, "1014000000") {
+	}
 
-			// javascript submitPage('frm','/etc/R?funccode=1014000000&nextfunc=1014000000');の実行
-			_, err = page.Evaluate("submitPage('frm','/etc/R?funccode=1014000000&nextfunc=1014000000')", nil)
-			if err != nil {
-				log.Printf("JavaScriptの実行中にエラーが発生しました: %v", err)
+	if len(downloads) > 0 {
+		job.SetStep("ファイル送信")
+		job.Logf("%d アカウント分のファイルをまとめて送信します（%s）: %s", len(downloads), requestData.Delivery, requestData.ResUrl)
+		if err := postEtcBundle(ctx, job, requestData.ResUrl, requestData.Delivery, downloads); err != nil {
+			job.Logf("ファイルの送信に失敗しました: %v", err)
+			for _, d := range downloads {
+				job.SetDelivery(d.result(deliveryFailed, err))
 			}
+			return errors.Join(append(errs, withCategory(errorDelivery, err))...)
 		}
-
-		// ログインボタンをクリックした後、3秒待機
-		err = waitForSelectorWithName(page, "focusTarget_Save", 10000) // ログインボタンが表示されるまで待機
-		if err != nil {
-			log.Printf("ログインボタンの表示待機中にエラーが発生しました: %v", err)
-			return err
-		}
-		//2か月前の日付を作成
-		lastmonth := time.Now().AddDate(0, -1, 0) // 2か月前の日付を取得
-		//年を4桁で取得
-		lastmonthYY := fmt.Sprintf("%04d", lastmonth.Year()) // 年を4桁で取得
-		lastmonthMM := fmt.Sprintf("%02d", int(lastmonth.Month()))
-		// last2monthDD := fmt.Sprintf("%02d", last2month.Day()) // 日を2桁で取得
-		// 今日の日付を取得
-		today := time.Now()
-		todayYY := fmt.Sprintf("%04d", today.Year()) // 年を4桁で取得
-		todayMM := fmt.Sprintf("%02d", int(today.Month()))
-		todayDD := fmt.Sprintf("%02d", today.Day())          // 日を2桁で取得
-		selectSlectorwithName(page, "fromYYYY", lastmonthYY) // 開始年を2か月前の年に設定
-		selectSlectorwithName(page, "fromMM", lastmonthMM)   // 開始年を2か月前の年に設定
-		selectSlectorwithName(page, "fromDD", "01")          // 開始年を2か月前の年に設定
-		selectSlectorwithName(page, "toYYYY", todayYY)       // 終了年を今日の年に設定
-		selectSlectorwithName(page, "toMM", todayMM)         // 終了月を今日の月に設定
-		selectSlectorwithName(page, "toDD", todayDD)         // 終了日を今日の日に設定
-		// 日付を入力
-		clickRadioButtonByNameByValue(page, "sokoKbn", 0) // ラジオボタンをクリック
-
-		//javascript allSelected('hyojiCard')の実行
-		_, err = page.Evaluate("allSelected('hyojiCard')", nil)
-		if err != nil {
-			log.Printf("JavaScriptの実行中にエラーが発生しました: %v", err)
-		}
-
-		clickSelectorWithName(page, "focusTarget_Save", 10000) // ログインボタンをクリック
-		clickSelectorWithName(page, "focusTarget", 10000)      // ログインボタンをクリック
-		// 3秒待機
-		log.Println("3秒待機します。")
-		time.Sleep(7 * time.Second) // ログインボタンをクリックした後、3秒待機
-		page.On("dialog", func(dialog playwright.Dialog) {
-			fmt.Printf("Dialog type: %s\n", dialog.Type())
-			fmt.Printf("Dialog message: %s\n", dialog.Message())
-
-			if dialog.Type() == "alert" {
-				dialog.Accept() // alertはOKしかないのでaccept
-				log.Println("アラートダイアログを受け入れました。")
-			} else if dialog.Type() == "confirm" {
-				dialog.Accept() // OKをクリック
-				log.Printf("確認ダイアログを受け入れました。")
-			} else if dialog.Type() == "prompt" {
-				dialog.Accept("これはプロンプトの応答です")
-			} else {
-				log.Printf("Unknown dialog type: %s", dialog.Type())
+		for _, d := range downloads {
+			if err := d.finish(job, site, rng, true); err != nil {
+				return err
 			}
-		})
-		//javascript goOutput(false, 'hakkoMeisai', 'frm', '/etc/R?funccode=1032000000&nextfunc=1032500000', '_blank')の実行
-		// _, err = page.Evaluate("goOutput(false, 'hakkoMeisai', 'frm', '/etc/R?funccode=1032000000&nextfunc=1032500000', '_blank')", nil)
-		err = clickInputByValeue(page, "利用明細ＣＳＶ出力") // hakkoMeisaiのラジオボタンをクリック
-		log.Println("CSVダウンロードのためのJavaScriptを実行しました。")
-		if err != nil {
-			log.Printf("JavaScriptの実行中にエラーが発生しました: %v", err)
 		}
+	}
+	return errors.Join(errs...) // エラーがない場合はnilを返す
+}
 
-		//selector を確認
-		//fileディレクトリにダウンロードしたファイルが存在するか確認
-		download, err := page.ExpectDownload(func() error {
-			return nil // 既にクリック済みなので何もしない
-		}, playwright.PageExpectDownloadOptions{
-			Timeout: playwright.Float(60000), // 60秒待機
-		})
-		if err != nil {
-			log.Printf("ダウンロードの待機中にエラーが発生しました: %v", err)
-			return err
-		} else {
-			log.Printf("ダウンロードが完了しました: %s", download.URL())
-		}
-		downloadPath := "etc-file/" + risLoginId + ".csv" // 保存するファイル名
-		err = download.SaveAs(downloadPath)
-		if err != nil {
-			log.Printf("ダウンロードファイルの保存に失敗しました: %v", err)
-			return err
-		} else {
-			log.Printf("ダウンロードファイルを '%s' に保存しました。\n", downloadPath)
-		}
-		if requestData.ResUrl != "" {
-			// resUrlが指定されている場合は、ファイルをPOSTリクエストで送信
-			log.Printf("resUrlが指定されているため、ファイルをPOSTリクエストで送信します: %s", requestData.ResUrl)
-			// err = postFileToServer(downloadPath, requestData.ResUrl)
-			// if err != nil {
-			// 	log.Printf("ファイルのPOST送信に失敗しました: %v", err)
-			// 	return err
-			// } else {
-			// 	log.Println("ファイルのPOST送信に成功しました。")
-			// }
-		}
-		// ここでrisLoginId, risPasswordを使った処理を行う
+// downloadEtcMeisaiCsv は1アカウント分の from〜to のCSVをetc-meisai.jpからダウンロードし、ファイルのパスを返します
+// params は requestData.params で作成したログイン情報・カード番号・利用区分です
+// records（json / ndjson）を指定した場合は、CSVをレコードに変換したファイルをCSVと同じディレクトリに作成します
+// アカウントごとにブラウザプールから新しい BrowserContext を借りて実行します
+func downloadEtcMeisaiCsv(ctx context.Context, job *Job, params map[string]string, from, to time.Time, records string) ([]string, error) {
+	job.Logf("処理対象: risLoginId=%s", params["risLoginId"])
+	if params["cards"] != "" {
+		job.Logf("選択するカード: %s", params["cards"])
 	}
 
-	return nil // エラーがない場合はnilを返す
+	// ログインからダウンロードまではサイトのアダプター（site_etc_meisai.go）で行う
+	site, _ := LookupSite(siteEtcMeisai)
+	files, err := runSite(ctx, job, site, params, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if records != "" {
+		job.SetStep("レコードへの変換")
+		for _, file := range files {
+			converted, err := convertEtcCsv(job, file, records)
+			if err != nil {
+				return nil, withCategory(errorData, err)
+			}
+			files = append(files, converted)
+		}
+	}
+	job.Logf("ダウンロードしたファイル: %v", files)
+	return files, nil
 }
 
 // contains checks if the content contains the specified string
@@ -419,7 +586,10 @@ func contains(content, s string) bool {
 	// panic("unimplemented")
 }
 
-func clickRadioButtonByNameByValue(page playwright.Page, name string, value int) error {
+func clickRadioButtonByNameByValue(ctx context.Context, page playwright.Page, name string, value int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// ラジオボタンをクリックするための関数
 	// name: ラジオボタンのname属性
 	// timeout: 待機時間（ミリ秒）
@@ -439,28 +609,27 @@ func clickRadioButtonByNameByValue(page playwright.Page, name string, value int)
 		err = fmt.Errorf("ラジオボタン %s の表示待機中にエラーが発生しました: %w", name, err)
 		return err
 	}
-	return clickSelector(page, selector, 3000) // ラジオボタンをクリック
+	return clickSelector(ctx, page, selector, 3000) // ラジオボタンをクリック
 }
 
-const url = "https://hono-lineworks-bot.mtamaramu.com/api/tasks"
-
 // coverage:ignore
 func postErrorToLineWorksBot(message string, inputUrl ...string) error {
 	// ここでは、エラーをLINE WORKSのボットに通知するためのHTTP POSTリクエストを送信します
-	// 例: エラーをLINE WORKSのボットに通知
-	// Goでfetchの代わりにHTTP POSTリクエストを送信
-	payload := map[string]string{
-		"test":    "sendTextMessageLine",
-		"message": message,
-	}
+	// ルールによる振り分けはせず、LINE WORKSのボットのプロキシにだけ送信します（ジョブの通知は notify を使います）
+	// プロキシのURLが空で Bot API の設定がある場合は、Bot API で lineworks.channelId・userId に送信します
 
-	// URLを決定（入力があればそれを使用、なければデフォルトのconst urlを使用）
-	targetUrl := url
+	// URLを決定（入力があればそれを使用、なければ設定ファイルのURLを使用）
+	targetUrl := cfg.LineWorks.URL
 	if len(inputUrl) > 0 && inputUrl[0] != "" {
 		targetUrl = inputUrl[0]
 	}
 
-	err := postJson(payload, targetUrl)
+	var bot Notifier = &lineWorksProxyNotifier{URL: targetUrl}
+	if targetUrl == "" && notifiers != nil && notifiers.bot != nil {
+		// プロキシを使わない場合は Bot API で既定の送信先に送信する
+		bot = &lineWorksBotNotifier{client: notifiers.bot, to: notifiers.bot.defaultTo}
+	}
+	err := bot.Notify(context.Background(), Notification{Severity: severityError, Message: message})
 	if err != nil {
 		log.Printf("LINE WORKSのボットへのメッセージ送信に失敗しました: %v", err)
 		return fmt.Errorf("LINE WORKSのボットへのメッセージ送信に失敗しました: %v", err)
@@ -470,11 +639,23 @@ func postErrorToLineWorksBot(message string, inputUrl ...string) error {
 }
 
 func postJson(payload interface{}, url string) error {
-	// JSONをPOSTリクエストで送信する関数
-	jsonData, _ := json.Marshal(payload)
+	return postJsonContext(context.Background(), payload, url)
+}
+
+// postJsonContext はJSONをPOSTリクエストで送信します。200以外のステータスコードはエラーにします
+func postJsonContext(ctx context.Context, payload interface{}, url string) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("JSONエンコードエラー: %w", err)
+	}
 	log.Printf("POSTリクエストを送信: URL=%s, データ=%s", url, string(jsonData))
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("HTTP POSTリクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		// log.Printf("HTTP POSTリクエスト送信エラー: URL=%s, エラー: %v", url, err)
 		return fmt.Errorf("HTTP POSTリクエスト送信エラー: %v", err)
@@ -496,365 +677,43 @@ func returnJson(w http.ResponseWriter, msg Message) {
 	}
 }
 
-func getPage(txtID2 string, txtID1 string, txtPass string, resUrl string) error {
+// getPage は theearth-np.com から rng の期間のCSV（zip）をダウンロードし、sinks の全ての送信先に送信します
+// 期間がゼロ値の場合はサイトの既定の期間を使います。incremental の場合は全ての送信に成功してから同期日を進めます
+func getPage(ctx context.Context, job *Job, txtID2 string, txtID1 string, txtPass string, sinks []Sink, rng exportRange) error {
 
 	if txtID2 == "" || txtID1 == "" || txtPass == "" {
 		return errors.New("txtID2, txtID1, txtPassのいずれかが空です。")
 	}
-	// Playwrightのインストール（初回のみ、またはCI/CDなどで）
-	err := playwright.Install()
-	if err != nil {
-		log.Fatalf("Playwright のインストールに失敗しました: %v", err)
-	}
-	log.Println("Playwright ブラウザがインストールされました！")
-
-	err = os.MkdirAll("./file", 0755)
-	if err != nil {
-		log.Fatalf("fileディレクトリの作成に失敗しました: %v", err)
-	} else {
-		log.Println("fileディレクトリが作成されました。")
-	}
-
-	// 環境変数またはhttp経由で値を取得する例
-	// ここでは http://localhost:8080/value から値を取得して変数に格納
-
-	//fileディレクトリになにかfileが存在するか確認
-	files, err := os.ReadDir("./file")
-	if err != nil {
-		log.Fatalf("fileディレクトリの読み取りに失敗しました: %v", err)
-	} else {
-		if len(files) > 0 {
-			log.Println("fileディレクトリに既存のファイルがあります。")
-			// 既存のファイルを削除
-			for _, file := range files {
-				err := os.Remove("./file/" + file.Name())
-				if err != nil {
-					log.Printf("ファイル '%s' の削除に失敗しました: %v", file.Name(), err)
-				} else {
-					log.Printf("ファイル '%s' を削除しました。\n", file.Name())
-				}
-			}
-			log.Println("fileディレクトリの既存のファイルを削除しました。")
-		} else {
-			log.Println("fileディレクトリは空です。")
-		}
-	}
-
-	// Playwrightの起動
-	pw, err := playwright.Run()
-	if err != nil {
-		log.Fatalf("Playwright の起動に失敗しました: %v", err)
-	}
-	defer pw.Stop() // プログラム終了時にPlaywrightを確実に停止
-
-	// ブラウザの起動 (ヘッドレスモードがデフォルト)
-	// GUIを表示したい場合は Launch(playwright.BrowserTypeLaunchOptions{Headless: playwright.Bool(false)}) を使う
-	//gui を表示
-	// ブラウザの起動
-	log.Println("ブラウザを起動しています...")
-	// ヘッドレスモードを無効にしてGUIを表示する場合は、Headless: playwright.Bool(false) を指定
-	// browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{Headless: playwright.Bool(false)})
-	browser, err := pw.Chromium.Launch()
-	if err != nil {
-		log.Fatalf("ブラウザの起動に失敗しました: %v", err)
-	}
-	defer browser.Close() // プログラム終了時にブラウザを確実に閉じる
-
-	// 新しいページ (タブ) の作成
-	page, err := browser.NewPage()
-	if err != nil {
-		log.Fatalf("ページの作成に失敗しました: %v", err)
-	}
-
-	// 目的のURLに移動
-	targetURL := "http://theearth-np.com/F-OES1010[Login].aspx" // スクレイピングしたいウェブサイトのURLに変更してください
-	log.Printf("URLにアクセス中: %s", targetURL)
-	_, err = page.Goto(targetURL)
-	if err != nil {
-		log.Fatalf("URLへの移動に失敗しました: %v", err)
-	}
-
-	// ページのタイトルを取得
-	title, err := page.Title()
-	if err != nil {
-		log.Printf("タイトル取得中にエラー: %v", err)
-		title = "取得できませんでした"
-		return err
-	}
-	log.Printf("ページのタイトル: %s\n", title)
-
-	//#popup_1を探してクリック
-	clickSelector(page, "#popup_1", 3000) // ポップアップを閉じるためのセレクターをクリック
-	clickSelector(page, "#txtID2")
-	inputSelector(page, "#txtID2", txtID2) // ユーザー名を入力
-	clickSelector(page, "#txtID1")
-	inputSelector(page, "#txtID1", txtID1) // ユーザー名を入力
-	clickSelector(page, "#txtPass")
-	inputSelector(page, "#txtPass", txtPass) // ユーザー名を入力
-
-	takeScreenshot(page, "screenshot.png") // スクリーンショットを撮る
-	clickSelector(page, "#imgLogin")       // ログインボタンをクリック
-	// 3秒待機してからポップアップを閉じる
-	//表示されなかった場合はそのまま次の処理に進む
-	log.Println("ログインボタンをクリックしました。3秒待機します。")
-	// ポップアップが表示される場合は、#popup_1 セレクターをクリックして閉じる
-	// ポップアップが表示されるまで待機してからクリック
-	// ポップアップが表示されるまで待機
-	// #popup_1 が表示されるまで待機してからクリック
-
-	takeScreenshot(page, "screenshot_01_afterLoginButton.png")
-	page.Locator("#popup_1").WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(3000),
-	})
-	// popup_1 が表示されたか確認
-
-	// ポップアップが表示されたらクリック
-	if exists, _ := selectorExists(page, "#popup_1"); exists {
-		log.Println("ポップアップが表示されました。クリックして閉じます。")
-		//#popup_1のvalueを確認
-		value, err := page.Locator("#popup_1").Evaluate("el => el.value", nil)
-		if err != nil {
-			log.Printf("ポップアップの値の取得に失敗しました: %v", err)
-		} else {
-			if value == "接続ユーザー確認" {
-				//popup を新しいタブで開く
-				// 新しいウィンドウ（ページ）が開くのを待つ
-				popupPage, err := page.ExpectPopup(func() error {
-					return clickSelector(page, "#popup_1", 3000) // ポップアップを閉じる
-					// return clickSelector(page, "#Button1st_2") // 例: ボタンをクリックして新しいウィンドウを開く
-				})
-				if err != nil {
-					log.Println("新しいウィンドウの取得に失敗しました")
-				} else {
-					log.Printf("新しいウィンドウを捕捉しました: %s\n", popupPage.URL())
-					//10秒待機してポップアップの内容を確認
-					time.Sleep(10 * time.Second)
-					//tr td の内容を取得
-					rows, err := popupPage.Locator("tr").All()
-					if err != nil {
-						log.Printf("ポップアップのテーブル行の取得に失敗しました: %v", err)
-					} else {
-						log.Printf("ポップアップのテーブル行の数: %d\n", len(rows))
-						for i, row := range rows {
-							// 各行の内容を取得
-							cells, err := row.Locator("td").All()
-							if err != nil {
-								log.Printf("ポップアップのテーブル行 %d のセルの取得に失敗しました: %v", i, err)
-								continue
-							}
-							// log.Printf("ポップアップのテーブル行 %d のセルの数: %d\n", i, len(cells))
-							for j, cell := range cells {
-								// 各セルの内容を取得
-								cellText, err := cell.InnerText()
-								if err != nil {
-									log.Printf("ポップアップのテーブル行 %d のセル %d の内容の取得に失敗しました: %v", i, j, err)
-									continue
-								}
-								if j == 2 && !inArray(cellText, []string{"auto2", "auto1", "auto3", "autoload"}) {
-									log.Printf("ポップアップのテーブル行 %d のセル %d の内容: %s\n", i, j, cellText)
-								}
-							}
-						}
-						// ここで popupPage に対して操作ができます
-					}
-					log.Println("ポップアップを閉じました。")
-
-				}
-
-				log.Printf("ポップアップの値: %v\n", value)
-			}
-			clickSelector(page, "#popup_1", 3000) // ポップアップを閉じる
-		}
-	}
-	//#Button1st_2が表示されるまで待機してからクリック
-	err = page.Locator("#Button1st_2").WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(10000),
-	})
-	if err != nil {
-		log.Printf("Button1st_2の表示待機中にエラーが発生しました: %v", err)
-		return err
-	}
-	takeScreenshot(page, "screenshot_02_afterLogin.png") // スクリーンショットを撮る
-
-	log.Println("ログインが完了しました。")
-
-	//3秒待機
-	log.Println("3秒待機します。")
-	time.Sleep(3 * time.Second)
-
-	Button1st_2, err := page.Locator("#Button1st_2").Count()
+	// ログインからダウンロードまではサイトのアダプター（site_theearth.go）で行う
+	site, _ := LookupSite(siteTheEarth)
+	params := map[string]string{"txtID1": txtID1, "txtID2": txtID2, "txtPass": txtPass}
+	from, to, ok, err := rng.resolve(site, params, time.Now())
 	if err != nil {
-		log.Printf("Button1st_2のカウント取得中にエラーが発生しました: %v", err)
 		return err
 	}
-	if Button1st_2 == 0 {
-		log.Println("Button1st_2が見つかりませんでした。ログインに失敗した可能性があります。")
-	}
-	page.Locator("Button2nd_5").WaitFor(playwright.LocatorWaitForOptions{
-		State:   playwright.WaitForSelectorStateVisible,
-		Timeout: playwright.Float(10000),
-	})
-	// Button1st_2が存在する場合はクリック
-	log.Println("Button1st_2が存在します。クリックします。")
-	clickSelector(page, "#Button1st_2", 3000)   // Button1st_2をクリック
-	waitForSelector(page, "#Button2nd_5", 3000) // Button2nd_5が表示されるまで待機
-	clickSelector(page, "#Button2nd_5", 3000)   // Button1st_2をクリック
-	waitForSelector(page, "#Button3rd_0", 3000) // Button2nd_5が表示されるまで待機
-	clickSelector(page, "#Button3rd_0", 3000)   // Button1st_2をクリック
-
-	waitForSelector(page, "#rdoSelect1", 10000) // 日付入力フィールドが表示されるまで待機
-	//https://theearth-np.com/F-NOS3010[GeneralCsv].aspxに移動
-	// targetURL = "https://theearth-np.com/F-NOS3010[GeneralCsv].aspx"
-	// log.Printf("次のURLにアクセス中: %s", targetURL)
-	// _, err = page.Goto(targetURL)
-	// if err != nil {
-	// 	log.Fatalf("次のURLへの移動に失敗しました: %v", err)
-	// }
-	// ページのタイトルを取得
-	title, err = page.Title()
-	if err != nil {
-		log.Printf("次のページのタイトル取得中にエラー: %v", err)
-		title = "取得できませんでした"
-		return err
+	if !ok {
+		job.Logln("前回の同期日以降にダウンロードする期間がないため、スキップします。")
+		return nil
 	}
-	log.Printf("ページのタイトル: %s\n", title)
-	err = clickSelector(page, "#rdoSelect1", 3000) // ポップアップを閉じる
+	files, err := runSite(ctx, job, site, params, from, to)
 	if err != nil {
 		return err
-	} // エラーが発生した場合は終了
-	clickSelector(page, "#rdoDate1", 3000) // ポップアップを閉じる
-	//日付をyesterday_yy, yesterday_mm, yesterday_ddに設定
-	// 昨日の日付を取得
-	yesterday := time.Now().AddDate(0, 0, -1)
-	yesterdayYY := fmt.Sprintf("%02d", yesterday.Year()%100) // 年を2桁で取得
-	yesterdayMM := fmt.Sprintf("%02d", int(yesterday.Month()))
-	yesterdayDD := fmt.Sprintf("%02d", yesterday.Day())
-	//今日の日付を取得
-	today := time.Now()
-	todayYY := fmt.Sprintf("%02d", today.Year()%100) // 年を2桁で取得
-	todayMM := fmt.Sprintf("%02d", int(today.Month()))
-	todayDD := fmt.Sprintf("%02d", today.Day())
-
-	clickSelector(page, "#MainContent_ucStartDate_txtYear")
-	inputSelector(page, "#MainContent_ucStartDate_txtYear", yesterdayYY)
-	clickSelector(page, "#MainContent_ucStartDate_txtMonth")
-	inputSelector(page, "#MainContent_ucStartDate_txtMonth", yesterdayMM)
-	clickSelector(page, "#MainContent_ucStartDate_txtDay")
-	inputSelector(page, "#MainContent_ucStartDate_txtDay", yesterdayDD)
-	clickSelector(page, "#MainContent_ucEndDate_txtYear")
-	inputSelector(page, "#MainContent_ucEndDate_txtYear", todayYY)
-	clickSelector(page, "#MainContent_ucEndDate_txtMonth")
-	inputSelector(page, "#MainContent_ucEndDate_txtMonth", todayMM)
-	clickSelector(page, "#MainContent_ucEndDate_txtDay")
-	inputSelector(page, "#MainContent_ucEndDate_txtDay", todayDD)
-
-	clickSelector(page, "#btnCsv") // 検索ボタンをクリック
-	//ダウンロードが完了するまで待機
-	log.Println("CSVダウンロードを開始しました。ダウンロードが完了するまで待機します。")
-	// ダウンロードが完了するまで待機
-	download, err := page.ExpectDownload(func() error {
-		return nil // 既にクリック済みなので何もしない
-	}, playwright.PageExpectDownloadOptions{
-		Timeout: playwright.Float(60000), // 60秒待機
-	})
-	if err != nil {
-		log.Printf("ダウンロードの待機中にエラーが発生しました: %v", err)
-	} else {
-		log.Printf("ダウンロードが完了しました: %s", download.URL())
 	}
-	// ダウンロードしたファイルを保存
-	downloadPath := "file/downloaded_file.zip" // 保存するファイル名
-	err = download.SaveAs(downloadPath)
-	if err != nil {
-		log.Printf("ダウンロードファイルの保存に失敗しました: %v", err)
+	if err := deliverFiles(ctx, job, sinks, files); err != nil {
 		return err
-	} else {
-		log.Printf("ダウンロードファイルを '%s' に保存しました。\n", downloadPath)
 	}
 
-	if resUrl != "" {
-		log.Printf("指定されたURLにリダイレクトします: %s", resUrl)
-		// resUrlが指定されている場合は、指定されたURLにFileをリダイレクト
-		err = postFileToServer(downloadPath, resUrl)
-		if err != nil {
-			log.Printf("ファイルのPOST送信に失敗しました: %v", err)
-			return err
-		}
-	} else {
-		log.Println("resUrlが指定されていないため、ファイルのPOST送信は行いません。")
+	if err := advanceSyncMark(job, site, params, rng, to); err != nil {
+		return err
 	}
-	// スクリーンショットを撮って保存 (デバッグや証拠として便利)
-
-	log.Println("スクレイピングが完了しました。")
-
-	// ここからPlaywrightのコードを記述できます
-	// 例: ブラウザを起動してGoogleにアクセス
+	job.Logln("スクレイピングが完了しました。")
 	return nil // ここではエラーがないことを示すために nil を返します
 }
 
-func postFileToServer(filePath string, url string) error {
-	// resUrlが指定されている場合は、指定されたURLにFileをリダイレクト
+// postFileToServer はファイルを url に multipart/form-data（フィールド名 file）で POST します
+func postFileToServer(ctx context.Context, filePath string, url string) error {
 	log.Printf("指定されたURLにリダイレクトします: %s", url)
-
-	// ダウンロードしたファイルをmultipartでkey:fileとして送信
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("ファイルのオープンに失敗しました: %v", err)
-		return err
-	}
-	defer file.Close()
-
-	var b bytes.Buffer
-	writer := multipart.NewWriter(&b)
-	// multipartでファイルを追加
-
-	// --- ここから修正部分 ---
-	// CreateFormFile の代わりに CreatePart を使用し、Content-Type を明示的に設定
-	header := make(textproto.MIMEHeader)
-	// Content-Disposition ヘッダーを設定（nameとfilenameは必須）
-	header.Set("Content-Disposition", `form-data; name="file"; filename="downloaded_file.zip"`)
-	// Content-Type を明示的に application/zip に設定
-	header.Set("Content-Type", "application/zip")
-
-	part, err := writer.CreatePart(header)
-	// part, err := writer.CreateFormFile("file", "downloaded_file.zip")
-	if err != nil {
-		log.Printf("multipart作成失敗: %v", err)
-		return err
-	}
-	_, err = io.Copy(part, file)
-	if err != nil {
-		log.Printf("ファイルコピー失敗: %v", err)
-		return err
-	}
-	writer.Close()
-
-	req, err := http.NewRequest("POST", url, &b)
-	if err != nil {
-		log.Printf("リクエスト作成失敗: %v", err)
-		return err
-	}
-
-	// Content-Typeヘッダーを正しく設定
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("ファイル送信失敗: %v", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		log.Printf("ファイル送信失敗: ステータスコード %d, レスポンス: %s", resp.StatusCode, string(respBody))
-		return fmt.Errorf("ファイル送信失敗: ステータスコード %d", resp.StatusCode)
-	}
-	log.Println("ファイル送信に成功しました。")
-	return nil // ファイル送信に成功した場合は nil を返す
+	return (&httpSink{URL: url}).Put(ctx, filePath, filepath.Base(filePath))
 }
 
 // CreateFormFile の代わりに以下の関数を使用する例
@@ -872,7 +731,10 @@ func createZipFilePart(writer *multipart.Writer, fieldname, filename string, fil
 	return err
 }
 
-func selectSlectorwithName(page playwright.Page, name string, value string) error {
+func selectSlectorwithName(ctx context.Context, page playwright.Page, name string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// セレクターを名前で取得して値を選択
 	_, err := page.Locator(fmt.Sprintf("[name='%s']", name)).SelectOption(playwright.SelectOptionValues{
 		Values: &[]string{value},
@@ -887,9 +749,13 @@ func selectSlectorwithName(page playwright.Page, name string, value string) erro
 }
 
 // clickSelector は指定されたセレクターをクリックするヘルパー関数です
+// ctx がキャンセルされている場合はクリックせずにエラーを返します
 // エラーが発生した場合はログに出力し、エラーを返します
 // 成功した場合はクリックしたセレクターをログに出力します
-func clickSelector(page playwright.Page, selector string, timeout ...int32) error {
+func clickSelector(ctx context.Context, page playwright.Page, selector string, timeout ...int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var opts playwright.LocatorClickOptions
 	if len(timeout) > 0 {
 		opts.Timeout = playwright.Float(float64(timeout[0]))
@@ -903,7 +769,10 @@ func clickSelector(page playwright.Page, selector string, timeout ...int32) erro
 	return nil
 }
 
-func clickSelectorWithName(page playwright.Page, name string, timeout ...int32) error {
+func clickSelectorWithName(ctx context.Context, page playwright.Page, name string, timeout ...int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var opts playwright.LocatorClickOptions
 	if len(timeout) > 0 {
 		opts.Timeout = playwright.Float(float64(timeout[0]))
@@ -918,7 +787,10 @@ func clickSelectorWithName(page playwright.Page, name string, timeout ...int32)
 	return nil
 }
 
-func waitForSelectorWithName(page playwright.Page, name string, timeout ...int32) error {
+func waitForSelectorWithName(ctx context.Context, page playwright.Page, name string, timeout ...int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var opts playwright.LocatorWaitForOptions
 	if len(timeout) > 0 {
 		opts.Timeout = playwright.Float(float64(timeout[0]))
@@ -934,9 +806,13 @@ func waitForSelectorWithName(page playwright.Page, name string, timeout ...int32
 }
 
 // waitforSelector は指定されたセレクターが表示されるまで待機するヘルパー関数です
+// ctx がキャンセルされている場合は待機せずにエラーを返します
 // エラーが発生した場合はログに出力し、エラーを返します
 // 成功した場合は表示されたセレクターをログに出力します
-func waitForSelector(page playwright.Page, selector string, timeout ...int32) error {
+func waitForSelector(ctx context.Context, page playwright.Page, selector string, timeout ...int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var opts playwright.LocatorWaitForOptions
 	if len(timeout) > 0 {
 		opts.Timeout = playwright.Float(float64(timeout[0]))
@@ -950,7 +826,10 @@ func waitForSelector(page playwright.Page, selector string, timeout ...int32) er
 	return nil
 }
 
-func inputSelectorWithName(page playwright.Page, name string, text string) error {
+func inputSelectorWithName(ctx context.Context, page playwright.Page, name string, text string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// セレクターを名前で取得してテキストを入力
 	err := page.Locator(fmt.Sprintf("[name='%s']", name)).Fill(text)
 	if err != nil {
@@ -961,7 +840,10 @@ func inputSelectorWithName(page playwright.Page, name string, text string) error
 	return nil
 }
 
-func clickInputByValeue(page playwright.Page, value string) error {
+func clickInputByValeue(ctx context.Context, page playwright.Page, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// セレクターを名前と値で取得してクリック
 	selector := fmt.Sprintf("input[value='%s'][type='button']", value)
 
@@ -975,9 +857,13 @@ func clickInputByValeue(page playwright.Page, value string) error {
 }
 
 // inputSelector は指定されたセレクターにテキストを入力するヘルパー関数です
+// ctx がキャンセルされている場合は入力せずにエラーを返します
 // エラーが発生した場合はログに出力し、エラーを返します
 // 成功した場合は入力したセレクターをログに出力します
-func inputSelector(page playwright.Page, selector string, text string) error {
+func inputSelector(ctx context.Context, page playwright.Page, selector string, text string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err := page.Locator(selector).Fill(text)
 	if err != nil {
 		log.Printf("セレクター '%s' への入力に失敗しました: %v", selector, err)
@@ -987,9 +873,27 @@ func inputSelector(page playwright.Page, selector string, text string) error {
 	return nil
 }
 
+// sleepContext は d だけ待機します
+// 待機中に ctx がキャンセルされた場合はすぐにエラーを返します
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // スクリーンショットを撮る関数
-func takeScreenshot(page playwright.Page, path string) error {
-	_, err := page.Screenshot(playwright.PageScreenshotOptions{Path: playwright.String("./file/" + path)})
+// スクリーンショットはジョブの作業ディレクトリの screenshots に保存します
+func takeScreenshot(job *Job, page playwright.Page, name string) error {
+	path, err := job.ArtifactPath(artifactScreenshots, name)
+	if err != nil {
+		return err
+	}
+	_, err = page.Screenshot(playwright.PageScreenshotOptions{Path: playwright.String(path)})
 	if err != nil {
 		log.Printf("スクリーンショットの撮影に失敗しました: %v", err)
 		return err
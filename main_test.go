@@ -1,28 +1,324 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/playwright-community/playwright-go"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetEtcMeisai(t *testing.T) {
-	// This is a placeholder for the getEtcMeisai function test.
-	// Since the function does not return any value,
-	// we cannot directly test it. Instead, we can check
-	// if it runs without panicking.
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("getEtcMeisai function panicked: %v", r)
+	// フェイクの etc-meisai.jp に対して、ログインからCSVのダウンロードまでを実際のブラウザで実行する
+	useTestBrowserPool(t)
+	useFastTimeouts(t)
+	site := newFakeEtcMeisai(t)
+	cfg.EtcMeisai.LoginURL = site.LoginURL()
+
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "")
+	err := getEtcMeisai(context.Background(), job, requestData{Data: []etcAccount{
+		{RisLoginId: "ris01", RisPassword: "pass01"},
+		{RisLoginId: "ris02", RisPassword: "pass02"},
+	}})
+	assert.Nil(t, err)
+
+	etcMeisai, _ := LookupSite(siteEtcMeisai)
+	from, to := etcMeisai.DefaultRange(time.Now())
+	searches := site.Searches()
+	assert.Len(t, searches, 2)
+	for i, id := range []string{"ris01", "ris02"} {
+		assert.Equal(t, id, searches[i].RisLoginId)
+		assert.Equal(t, from.Format(rangeDateLayout), searches[i].From)
+		assert.Equal(t, to.Format(rangeDateLayout), searches[i].To)
+		assert.Equal(t, "0", searches[i].SokoKbn)
+		assert.Equal(t, site.Cards, searches[i].Cards, "allSelected should check every card")
+
+		content, err := os.ReadFile(filepath.Join(job.Dir(), artifactDownloads, id+".csv"))
+		assert.Nil(t, err)
+		assert.Equal(t, site.Csv(id), content)
+	}
+
+	// 期間・カード・利用区分を指定した場合は、指定したカードだけを選択する
+	kbn := 1
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{
+		Data:    []etcAccount{{RisLoginId: "ris01", RisPassword: "pass01"}},
+		From:    "2026-08-01",
+		To:      "2026-08-31",
+		Cards:   []string{"1234 5678 9012 0000"},
+		SokoKbn: &kbn,
+	})
+	assert.Nil(t, err)
+	searches = site.Searches()
+	assert.Len(t, searches, 3)
+	assert.Equal(t, fakeEtcSearch{RisLoginId: "ris01", From: "2026-08-01", To: "2026-08-31", SokoKbn: "1", Cards: []string{"1234-5678-9012-0000"}}, searches[2])
+
+	// records を指定した場合はCSVをレコードに変換したファイルも作成する
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{
+		Data:    []etcAccount{{RisLoginId: "ris02", RisPassword: "pass02"}},
+		Records: recordsNDJSON,
+	})
+	assert.Nil(t, err)
+	content, err := os.ReadFile(filepath.Join(job.Dir(), artifactDownloads, "ris02.ndjson"))
+	assert.Nil(t, err)
+	var record EtcRecord
+	assert.Nil(t, json.Unmarshal(content, &record))
+	assert.Equal(t, "ris02", record.VehicleNumber)
+	assert.Equal(t, 930, record.Toll)
+	searches = site.Searches()
+
+	// 指定したカードがない場合は失敗する
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{
+		Data:  []etcAccount{{RisLoginId: "ris01", RisPassword: "pass01"}},
+		Cards: []string{"9999-9999-9999-9999"},
+	})
+	assert.ErrorContains(t, err, "指定されたETCカードが見つかりません")
+	assert.Len(t, site.Searches(), len(searches))
+
+	// パスワードが違う場合は検索画面まで進めずに失敗する
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: []etcAccount{{RisLoginId: "ris01", RisPassword: "wrong"}}})
+	assert.ErrorContains(t, err, "画面の移動に失敗しました")
+	assert.Len(t, site.Searches(), len(searches))
+}
+
+func TestGetEtcMeisaiDelivery(t *testing.T) {
+	// フェイクの etc-meisai.jp からダウンロードしたCSVを resUrl に送信する
+	useTestBrowserPool(t)
+	useFastTimeouts(t)
+	site := newFakeEtcMeisai(t)
+	cfg.EtcMeisai.LoginURL = site.LoginURL()
+	store := NewJobStore(t.TempDir())
+	accounts := []etcAccount{
+		{RisLoginId: "ris01", RisPassword: "pass01"},
+		{RisLoginId: "ris02", RisPassword: "pass02"},
+	}
+
+	// アカウントごとに1回ずつ送信し、失敗したアカウントがあっても残りのアカウントは送信する
+	res, posts := newEtcReceiver(t, "ris01")
+	job := store.New(jobTypeEtcMeisai, "")
+	err := getEtcMeisai(context.Background(), job, requestData{Data: accounts, ResUrl: res.URL})
+	assert.ErrorContains(t, err, "risLoginId=ris01: ファイル送信失敗: ステータスコード 500")
+	assert.Equal(t, []etcPost{
+		{RisLoginIds: []string{"ris01"}, Files: map[string][]byte{"ris01.csv": site.Csv("ris01")}},
+		{RisLoginIds: []string{"ris02"}, Files: map[string][]byte{"ris02.csv": site.Csv("ris02")}},
+	}, posts())
+	deliveries := job.Info().Deliveries
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, DeliveryResult{Account: "ris01", Status: deliveryFailed, Files: []string{"ris01.csv"}, Error: "ファイル送信失敗: ステータスコード 500"}, deliveries[0])
+	assert.Equal(t, DeliveryResult{Account: "ris02", Status: deliverySent, Files: []string{"ris02.csv"}}, deliveries[1])
+
+	// multipart の場合は全てのアカウントのCSVを1回で送信する
+	res, posts = newEtcReceiver(t, "")
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: accounts, ResUrl: res.URL, Delivery: deliveryMultipart})
+	assert.Nil(t, err)
+	assert.Equal(t, []etcPost{{
+		RisLoginIds: []string{"ris01", "ris02"},
+		Files:       map[string][]byte{"ris01_ris01.csv": site.Csv("ris01"), "ris02_ris02.csv": site.Csv("ris02")},
+	}}, posts())
+	for _, d := range job.Info().Deliveries {
+		assert.Equal(t, deliverySent, d.Status, d.Account)
+	}
+
+	// zip の場合は <risLoginId>/<ファイル名> のzipを1つ送信する
+	res, posts = newEtcReceiver(t, "")
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: accounts, ResUrl: res.URL, Delivery: deliveryZip})
+	assert.Nil(t, err)
+	sent := posts()
+	assert.Len(t, sent, 1)
+	assert.Equal(t, []string{"ris01", "ris02"}, sent[0].RisLoginIds)
+	content := sent[0].Files[etcBundleName]
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"ris01/ris01.csv", "ris02/ris02.csv"}, names)
+
+	// まとめて送信する場合に失敗したときは、全てのアカウントを失敗にする
+	res, _ = newEtcReceiver(t, "ris02")
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: accounts, ResUrl: res.URL, Delivery: deliveryZip})
+	assert.ErrorContains(t, err, "ステータスコード 500")
+	for _, d := range job.Info().Deliveries {
+		assert.Equal(t, deliveryFailed, d.Status, d.Account)
+	}
+
+	// ダウンロードに失敗したアカウントがあっても、残りのアカウントは処理して成功した分をまとめて送信する
+	res, posts = newEtcReceiver(t, "")
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: []etcAccount{{RisLoginId: "ris01", RisPassword: "wrong"}, accounts[1]}, ResUrl: res.URL, Delivery: deliveryMultipart})
+	assert.ErrorContains(t, err, "risLoginId=ris01: ")
+	assert.Equal(t, []etcPost{{RisLoginIds: []string{"ris02"}, Files: map[string][]byte{"ris02_ris02.csv": site.Csv("ris02")}}}, posts())
+	deliveries = job.Info().Deliveries
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, deliveryFailed, deliveries[0].Status)
+	assert.Equal(t, DeliveryResult{Account: "ris02", Status: deliverySent, Files: []string{"ris02.csv"}}, deliveries[1])
+
+	// resUrl を指定しない場合はダウンロードだけ
+	job = store.New(jobTypeEtcMeisai, "")
+	err = getEtcMeisai(context.Background(), job, requestData{Data: accounts[:1], Delivery: deliveryZip})
+	assert.Nil(t, err)
+	assert.Equal(t, []DeliveryResult{{Account: "ris01", Status: deliveryDownloaded, Files: []string{"ris01.csv"}}}, job.Info().Deliveries)
+}
+
+func TestEtcRequestData(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	kbn := 1
+	d := requestData{
+		Data: []etcAccount{
+			{RisLoginId: "ris01", RisPassword: "pass01"},
+			{RisLoginId: "ris02", RisPassword: "pass02", Cards: []string{"1111-2222-3333-4444"}},
+		},
+		From:    "2026-09-01",
+		To:      "2026-09-30",
+		Cards:   []string{"1234-5678-9012-3456", "1234 5678 9012 0000"},
+		SokoKbn: &kbn,
+	}
+	assert.Nil(t, d.validate(now))
+	rng, err := d.exportRange(now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-09-01", rng.From.Format(rangeDateLayout))
+	assert.Equal(t, "2026-09-30", rng.To.Format(rangeDateLayout))
+	assert.Equal(t, map[string]string{
+		"risLoginId": "ris01", "risPassword": "pass01", "cards": "1234567890123456,1234567890120000", "sokoKbn": "1",
+	}, d.params(d.Data[0]))
+	// アカウントごとのカードはリクエストのカードより優先する
+	assert.Equal(t, "1111222233334444", d.params(d.Data[1])["cards"])
+
+	// 省略した場合は設定ファイルの値を使うため、パラメータに含めない
+	d = requestData{Data: []etcAccount{{RisLoginId: "ris01", RisPassword: "pass01"}}}
+	assert.Nil(t, d.validate(now))
+	assert.Equal(t, map[string]string{"risLoginId": "ris01", "risPassword": "pass01"}, d.params(d.Data[0]))
+	rng, err = d.exportRange(now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-09-01", rng.From.Format(rangeDateLayout))
+
+	assert.ErrorContains(t, requestData{From: "2026-10-01", To: "2026-09-01"}.validate(now), "より後になっています")
+	assert.ErrorContains(t, requestData{Records: "xml"}.validate(now), "records 'xml' は不正です")
+	assert.ErrorContains(t, requestData{Delivery: "tar"}.validate(now), "delivery 'tar' は不正です")
+	assert.ErrorContains(t, requestData{Cards: []string{"1234-ABCD"}}.validate(now), "カード番号 '1234-ABCD' は不正です")
+	assert.ErrorContains(t, requestData{Data: []etcAccount{{Cards: []string{""}}}}.validate(now), "カード番号 '' は不正です")
+	kbn = -1
+	assert.ErrorContains(t, requestData{SokoKbn: &kbn}.validate(now), "sokoKbn -1 は不正です")
+}
+
+func TestGetPage(t *testing.T) {
+	// フェイクの theearth-np.com に対して、ログインからzipのダウンロード・resUrl への送信までを実際のブラウザで実行する
+	useTestBrowserPool(t)
+	useFastTimeouts(t)
+	site := newFakeTheEarth(t)
+	cfg.TheEarth.LoginURL = site.LoginURL()
+
+	var received, receivedJSON []byte
+	res := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-	}()
-	// getEtcMeisai()
+		defer file.Close()
+		if filepath.Ext(header.Filename) == ".json" {
+			receivedJSON, _ = io.ReadAll(file)
+			return
+		}
+		received, _ = io.ReadAll(file)
+	}))
+	defer res.Close()
+
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeGeneralCsv, "")
+	err := getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, []Sink{&httpSink{URL: res.URL}}, exportRange{})
+	assert.Nil(t, err)
+	assert.Equal(t, site.Zip, received)
+	// zipの中のCSVを確認してマニフェストを記録する
+	assert.Len(t, job.Info().Manifest, 3)
+	// レコードのJSONもzipと一緒に送信する
+	saved, err := os.ReadFile(filepath.Join(job.Dir(), artifactDownloads, "downloaded_file.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, saved, receivedJSON)
+
+	// 既定の期間（前日〜当日）が入力されている
+	theEarth, _ := LookupSite(siteTheEarth)
+	from, to := theEarth.DefaultRange(time.Now())
+	requests := site.CsvRequests()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "select", requests[0]["rdoSelect"])
+	assert.Equal(t, "range", requests[0]["rdoDate"])
+	assert.Equal(t, from.Format("06"), requests[0]["startYear"])
+	assert.Equal(t, from.Format("01"), requests[0]["startMonth"])
+	assert.Equal(t, from.Format("02"), requests[0]["startDay"])
+	assert.Equal(t, to.Format("02"), requests[0]["endDay"])
+
+	// 1回のCSV出力で指定できる日数を超える期間は分割して出力し、1つのzipにまとめる
+	cfg.TheEarth.MaxRangeDays = 2
+	job = store.New(jobTypeGeneralCsv, "")
+	from = time.Now().AddDate(0, 0, -4)
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, nil, exportRange{From: from, To: time.Now()})
+	assert.Nil(t, err)
+	assert.Len(t, site.CsvRequests(), 4)
+	zr, err := zip.OpenReader(filepath.Join(job.Dir(), artifactDownloads, "downloaded_file.zip"))
+	assert.Nil(t, err)
+	assert.Len(t, zr.File, 3)
+	zr.Close()
+
+	// incremental の場合は送信に失敗すると同期日を進めず、成功してから進める
+	syncMarks := useTestSyncStore(t)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	job = store.New(jobTypeGeneralCsv, "")
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, []Sink{&httpSink{URL: failing.URL}}, exportRange{Incremental: true})
+	assert.ErrorContains(t, err, "ステータスコード 500")
+	assert.Empty(t, syncMarks.List())
+	job = store.New(jobTypeGeneralCsv, "")
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, []Sink{&httpSink{URL: res.URL}}, exportRange{Incremental: true})
+	assert.Nil(t, err)
+	mark, ok := syncMarks.Get(siteTheEarth, site.CompanyID+"/"+site.UserID)
+	assert.True(t, ok)
+	assert.Equal(t, time.Now().Format(rangeDateLayout), mark.LastDate)
+	assert.Equal(t, job.Info().ID, mark.JobID)
+	// 今日まで同期済みでも overlapDays 日分は再度ダウンロードする
+	requests = site.CsvRequests()
+	job = store.New(jobTypeGeneralCsv, "")
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, nil, exportRange{Incremental: true})
+	assert.Nil(t, err)
+	assert.Len(t, site.CsvRequests(), len(requests)+1)
+	assert.Equal(t, time.Now().Format("02"), site.CsvRequests()[len(requests)]["startDay"])
+
+	// データのないzipは送信しない
+	zipData := site.Zip
+	site.Zip = fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号,乗務員\n"})
+	received = nil
+	job = store.New(jobTypeGeneralCsv, "")
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, site.Password, []Sink{&httpSink{URL: res.URL}}, exportRange{})
+	assert.ErrorIs(t, err, errTachoEmpty)
+	assert.Nil(t, received)
+	site.Zip = zipData
+
+	// ログインに失敗した場合はメニューが表示されずに失敗し、トレースが保存される
+	job = store.New(jobTypeGeneralCsv, "")
+	err = getPage(context.Background(), job, site.CompanyID, site.UserID, "wrong", nil, exportRange{})
+	assert.ErrorContains(t, err, "ログインに失敗しました")
+	_, err = os.Stat(filepath.Join(job.Dir(), artifactTraces, "theearth-"+site.UserID+".zip"))
+	assert.Nil(t, err)
 }
 
 func TestContains(t *testing.T) {
@@ -106,12 +402,12 @@ func TestClickRadioButtonByNameByValue(t *testing.T) {
 	defer pw.Stop()
 	defer browser.Close()
 
-	err = clickRadioButtonByNameByValue(nil, "testRadio", 1)
+	err = clickRadioButtonByNameByValue(context.Background(), nil, "testRadio", 1)
 	if err == nil {
 		t.Errorf("clickRadioButtonByNameByValue should returned an error: %v", err)
 	}
 
-	err = clickRadioButtonByNameByValue(page, "testRadio", 1)
+	err = clickRadioButtonByNameByValue(context.Background(), page, "testRadio", 1)
 	if err == nil {
 		t.Errorf("clickRadioButtonByNameByValue should returned an error: %v", err)
 	}
@@ -121,7 +417,7 @@ func TestClickRadioButtonByNameByValue(t *testing.T) {
 	}
 
 	page.SetContent("<!DOCTYPE html><html><body><form><input type='radio' name='testRadio' value='1'><input type='radio' name='testRadio' value='2'></form></body></html>")
-	err = clickRadioButtonByNameByValue(page, "testRadio", 1)
+	err = clickRadioButtonByNameByValue(context.Background(), page, "testRadio", 1)
 	if err != nil {
 		t.Errorf("clickRadioButtonByNameByValue returned an error: %v", err)
 	}
@@ -140,22 +436,34 @@ func TestClickRadioButtonByNameByValue(t *testing.T) {
 }
 
 func TestPostErrorToLineWorksBot(t *testing.T) {
-	// This is a placeholder for the postErrorToLineWorksBot function test.
-	// Since the function does not return any value,
-	// we cannot directly test it. Instead, we can check
-	// if it runs without panicking.
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("postErrorToLineWorksBot function panicked: %v", r)
-		}
-	}()
-
-	// t.Error("postErrorToLineWorksBot function is not implemented yet, please implement it before running the test")
-	// if err == nil {
-	// 	t.Errorf("postErrorToLineWorksBot should have returned an error, but got nil")
-	// }
-
-	// postErrorToLineWorksBot()
+	// LINE WORKS のボットのプロキシの代わりにローカルのサーバーで受信する
+	var payload map[string]string
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer bot.Close()
+
+	err := postErrorToLineWorksBot("スクレイピング中にエラーが発生しました", bot.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test": "sendTextMessageLine", "message": "スクレイピング中にエラーが発生しました"}, payload)
+
+	// URLを指定しない場合は設定ファイルのURLに送信する
+	orig := cfg.LineWorks.URL
+	t.Cleanup(func() { cfg.LineWorks.URL = orig })
+	cfg.LineWorks.URL = bot.URL
+	payload = nil
+	assert.Nil(t, postErrorToLineWorksBot("設定ファイルのURL"))
+	assert.Equal(t, "設定ファイルのURL", payload["message"])
+
+	// ボットがエラーを返した場合はエラー
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	err = postErrorToLineWorksBot("失敗", failing.URL)
+	assert.ErrorContains(t, err, "ステータスコード 502")
 }
 
 // MockRoundTripper は http.RoundTripper インターフェースのモック実装です。
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// 通知先の種類です
+const (
+	notifierLineWorks    = "lineworks"     // LINE WORKS ボットのプロキシ（従来の lineworks.url と同じ）
+	notifierLineWorksBot = "lineworks-bot" // LINE WORKS の Bot API を直接呼び出す
+	notifierWebhook      = "webhook"       // 通知の内容をそのまま JSON で POST する
+	notifierSlack        = "slack"         // Slack 互換の Incoming Webhook
+	notifierSMTP         = "smtp"          // メール
+)
+
+// 通知の重要度です（info < warning < error）
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// notifyTimeout は1つの通知先への送信のタイムアウトです
+const notifyTimeout = 30 * time.Second
+
+// Notification は通知の内容です
+type Notification struct {
+	Severity string    `json:"severity"`
+	JobType  string    `json:"jobType,omitempty"`
+	Account  string    `json:"account,omitempty"` // エイリアス・スケジュールのアカウント名
+	JobID    string    `json:"jobId,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+
+	key string // 重複を排除するキー（空の場合は種類・アカウント・メッセージ）
+}
+
+// Subject はメールの件名などに使う1行の見出しです
+func (n Notification) Subject() string {
+	subject := "[" + n.Severity + "]"
+	if n.JobType != "" {
+		subject += " " + n.JobType
+	}
+	if n.Account != "" {
+		subject += " " + n.Account
+	}
+	return subject
+}
+
+// Notifier は通知の送信先です
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+	// String はログに出力する通知先の説明です（パスワードなどは含めません）
+	String() string
+}
+
+// NotifierConfig は設定ファイルの notify.channels に登録する通知先の設定です
+type NotifierConfig struct {
+	Type string `yaml:"type"`
+
+	// lineworks・webhook・slack の送信先
+	URL string `yaml:"url"`
+
+	// lineworks-bot の送信先（省略した場合は lineworks.channelId・userId）
+	ChannelID string `yaml:"channelId"`
+	UserID    string `yaml:"userId"`
+
+	// smtp
+	Host     string   `yaml:"host"` // host:port（ポートを省略した場合は25）
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// NotifyRoute は通知先を選ぶルールです
+// 空の項目は全てに一致し、一致したルールの channels の全てに送信します
+type NotifyRoute struct {
+	JobTypes    []string `yaml:"jobTypes"`    // ジョブの種類（GeneralCsv・etc-meisai・サイトの jobType）
+	Accounts    []string `yaml:"accounts"`    // アカウント名
+	MinSeverity string   `yaml:"minSeverity"` // この重要度以上の通知だけに一致する
+	Channels    []string `yaml:"channels"`    // 送信する notify.channels の名前
+}
+
+// match は通知がルールに一致するかどうかを返します
+func (r NotifyRoute) match(n Notification) bool {
+	if len(r.JobTypes) > 0 && !slices.Contains(r.JobTypes, n.JobType) {
+		return false
+	}
+	if len(r.Accounts) > 0 && !slices.Contains(r.Accounts, n.Account) {
+		return false
+	}
+	return severityLevel(n.Severity) >= severityLevel(r.MinSeverity)
+}
+
+// severityLevel は重要度を比較するための値です（空は info と同じ）
+func severityLevel(severity string) int {
+	switch severity {
+	case severityWarning:
+		return 1
+	case severityError:
+		return 2
+	}
+	return 0
+}
+
+func validateSeverity(severity string) error {
+	switch severity {
+	case "", severityInfo, severityWarning, severityError:
+		return nil
+	}
+	return fmt.Errorf("重要度 '%s' は不正です（%s / %s / %s）", severity, severityInfo, severityWarning, severityError)
+}
+
+// NewNotifier は設定から通知先を作成します
+// bot は lineworks-bot の通知先で使う Bot API のクライアントです（設定がない場合は nil）
+func NewNotifier(c NotifierConfig, bot *LineWorksClient) (Notifier, error) {
+	switch c.Type {
+	case notifierLineWorksBot:
+		if bot == nil {
+			return nil, errors.New("lineworks-bot の通知先には設定ファイルの lineworks に Bot API の設定が必要です")
+		}
+		to := LineWorksTarget{UserID: c.UserID, ChannelID: c.ChannelID}
+		if to.UserID == "" && to.ChannelID == "" {
+			to = bot.defaultTo
+		}
+		if to.UserID == "" && to.ChannelID == "" {
+			return nil, errors.New("lineworks-bot の通知先には channelId または userId が必要です")
+		}
+		return &lineWorksBotNotifier{client: bot, to: to}, nil
+	case notifierLineWorks, notifierWebhook, notifierSlack:
+		if c.URL == "" {
+			return nil, fmt.Errorf("%s の通知先には url が必要です", c.Type)
+		}
+		switch c.Type {
+		case notifierLineWorks:
+			return &lineWorksProxyNotifier{URL: c.URL}, nil
+		case notifierWebhook:
+			return &webhookNotifier{URL: c.URL}, nil
+		}
+		return &slackNotifier{URL: c.URL}, nil
+	case notifierSMTP:
+		return newSMTPNotifier(c)
+	}
+	return nil, fmt.Errorf("通知先の type '%s' は不正です（%s / %s / %s / %s / %s）", c.Type, notifierLineWorks, notifierLineWorksBot, notifierWebhook, notifierSlack, notifierSMTP)
+}
+
+// Notifiers は通知をルールに従って通知先に振り分けます
+type Notifiers struct {
+	channels map[string]Notifier
+	names    []string // 通知先の名前（ルールがない場合は全てに送信する）
+	routes   []NotifyRoute
+	bot      *LineWorksClient // LINE WORKS の Bot API のクライアント（設定がない場合は nil）
+
+	dedupeWindow time.Duration // 同じ内容の失敗の通知を1回にまとめる時間
+	groupWindow  time.Duration // 同じジョブの種類の失敗の通知を1つにまとめる時間（0で待たずに送信）
+	rateLimit    int           // 通知先ごとの1時間の送信の回数の上限（0で無制限）
+	now          func() time.Time
+	templates    map[string]*template.Template  // イベントごとのメッセージのテンプレート
+	accounts     map[string]NotifyAccountConfig // 開始・成功を通知するアカウント
+	alerts       alertState
+	rate         rateState
+}
+
+// NewNotifiers は設定の通知先とルールを作成します
+// 通知先を登録していない場合は、lineworks に Bot API と既定の送信先の設定があれば Bot API で、
+// なければ従来どおり lineworks.url のプロキシに全ての通知を送信します
+func NewNotifiers(c NotifyConfig, lw LineWorksConfig) (*Notifiers, error) {
+	n := &Notifiers{
+		channels:     map[string]Notifier{},
+		routes:       c.Routes,
+		dedupeWindow: time.Duration(c.DedupeWindowSeconds) * time.Second,
+		groupWindow:  time.Duration(c.GroupWindowSeconds) * time.Second,
+		rateLimit:    c.RateLimitPerHour,
+		now:          time.Now,
+		accounts:     c.Accounts,
+		alerts:       alertState{seen: map[string]time.Time{}, groups: map[string][]Notification{}, failing: map[string]bool{}},
+		rate:         rateState{sent: map[string][]time.Time{}, dropped: map[string]int{}},
+	}
+	if lineWorksBotConfigured(lw) {
+		bot, err := NewLineWorksClient(lw)
+		if err != nil {
+			return nil, err
+		}
+		n.bot = bot
+	}
+	templates, err := parseMessageTemplates(c.Templates)
+	if err != nil {
+		return nil, err
+	}
+	n.templates = templates
+	channels := c.Channels
+	if len(channels) == 0 {
+		switch {
+		case n.bot != nil && (lw.ChannelID != "" || lw.UserID != ""):
+			channels = map[string]NotifierConfig{notifierLineWorks: {Type: notifierLineWorksBot}}
+		case lw.URL != "":
+			channels = map[string]NotifierConfig{notifierLineWorks: {Type: notifierLineWorks, URL: lw.URL}}
+		}
+	}
+	for name, nc := range channels {
+		notifier, err := NewNotifier(nc, n.bot)
+		if err != nil {
+			return nil, fmt.Errorf("通知先 '%s': %w", name, err)
+		}
+		n.channels[name] = notifier
+		n.names = append(n.names, name)
+	}
+	sort.Strings(n.names)
+	for i, r := range c.Routes {
+		if err := validateSeverity(r.MinSeverity); err != nil {
+			return nil, fmt.Errorf("notify.routes[%d]: %w", i, err)
+		}
+		if len(r.Channels) == 0 {
+			return nil, fmt.Errorf("notify.routes[%d]: channels が指定されていません", i)
+		}
+		for _, name := range r.Channels {
+			if _, ok := n.channels[name]; !ok {
+				return nil, fmt.Errorf("notify.routes[%d]: 通知先 '%s' は notify.channels に登録されていません", i, name)
+			}
+		}
+	}
+	return n, nil
+}
+
+// Route は通知を送信する通知先の名前を返します（ルールがない場合は全ての通知先）
+func (n *Notifiers) Route(note Notification) []string {
+	if len(n.routes) == 0 {
+		return n.names
+	}
+	var names []string
+	for _, r := range n.routes {
+		if !r.match(note) {
+			continue
+		}
+		for _, name := range r.Channels {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Notify は通知をルールに一致した全ての通知先に送信します
+// 1つの通知先に失敗しても残りの通知先には送信し、失敗した通知先のエラーをまとめて返します
+// 送信の回数の上限に達した通知先には送信せず、次に送信する通知に送信しなかった数を書き添えます
+func (n *Notifiers) Notify(ctx context.Context, note Notification) error {
+	if note.Time.IsZero() {
+		note.Time = n.now()
+	}
+	if note.Severity == "" {
+		note.Severity = severityInfo
+	}
+	var errs []error
+	for _, name := range n.Route(note) {
+		notifier := n.channels[name]
+		ok, dropped := n.allow(name, n.now())
+		if !ok {
+			log.Printf("通知先 %s の1時間の送信の回数の上限（%d 回）に達したため、通知しません: %s", notifier, n.rateLimit, note.Message)
+			continue
+		}
+		sent := note
+		if dropped > 0 {
+			sent.Message += fmt.Sprintf("\n（送信の回数の上限のため、%d 件の通知を送信しませんでした）", dropped)
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err := notifier.Notify(sendCtx, sent)
+		cancel()
+		if err != nil {
+			log.Printf("通知先 %s への通知に失敗しました: %v", notifier, err)
+			errs = append(errs, fmt.Errorf("通知先 '%s': %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notifiers はサーバー起動時に設定から作成する通知先です
+var notifiers *Notifiers
+
+// initNotifiers は設定ファイルの notify から通知先を作成します
+func initNotifiers() error {
+	n, err := NewNotifiers(cfg.Notify, cfg.LineWorks)
+	if err != nil {
+		return err
+	}
+	if err := n.startDigest(cfg.Notify.DigestCron, jobs); err != nil {
+		return err
+	}
+	notifiers = n
+	log.Printf("通知先: %v", n.names)
+	return nil
+}
+
+// notifyJobError はジョブのエラーを通知します（重複の排除・まとめは Alert を参照）
+// メッセージは notify.templates.failed で整形します（テンプレートでは message を .Message、err を .Error として参照します）
+func notifyJobError(job *Job, message string, err error) {
+	n := notifiers
+	if n == nil {
+		log.Printf("通知先が初期化されていないため、通知しません: %s", message)
+		return
+	}
+	data := newMessageData(eventFailed, job, n.now())
+	data.Message = message
+	if err != nil {
+		data.Status, data.Error, data.ErrorCategory = JobFailed, err.Error(), errorCategory(err)
+	}
+	note := noteFor(severityError, data, n.render(eventFailed, data, message))
+	note.key = alertKey(Notification{JobType: data.Type, Account: data.Account, Message: message})
+	n.Alert(note)
+}
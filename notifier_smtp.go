@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpNotifier はメールで通知します
+// サーバーが STARTTLS に対応している場合は暗号化し、username を指定した場合は PLAIN 認証します
+type smtpNotifier struct {
+	host     string // host:port
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTPNotifier(c NotifierConfig) (*smtpNotifier, error) {
+	if c.Host == "" {
+		return nil, errors.New("smtp の通知先には host が必要です")
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return nil, errors.New("smtp の通知先には from と to が必要です")
+	}
+	host := c.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "25")
+	}
+	return &smtpNotifier{host: host, username: c.Username, password: c.Password, from: c.From, to: c.To}, nil
+}
+
+func (n *smtpNotifier) String() string {
+	return notifierSMTP + " " + n.host + " → " + strings.Join(n.to, ",")
+}
+
+func (n *smtpNotifier) Notify(ctx context.Context, note Notification) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.host)
+	if err != nil {
+		return fmt.Errorf("SMTPサーバーへの接続に失敗しました: %w", err)
+	}
+	defer conn.Close()
+	// net/smtp はコンテキストに対応していないため、期限を接続に設定する
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	serverName, _, _ := net.SplitHostPort(n.host)
+	client, err := smtp.NewClient(conn, serverName)
+	if err != nil {
+		return fmt.Errorf("SMTPサーバーへの接続に失敗しました: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: serverName}); err != nil {
+			return fmt.Errorf("STARTTLS に失敗しました: %w", err)
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, serverName)); err != nil {
+			return fmt.Errorf("SMTPの認証に失敗しました: %w", err)
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return fmt.Errorf("送信元 '%s' が拒否されました: %w", n.from, err)
+	}
+	for _, to := range n.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("宛先 '%s' が拒否されました: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("メールの送信に失敗しました: %w", err)
+	}
+	if _, err := w.Write(n.message(note)); err != nil {
+		return fmt.Errorf("メールの送信に失敗しました: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("メールの送信に失敗しました: %w", err)
+	}
+	return client.Quit()
+}
+
+// message はメールのヘッダーと本文を作成します。件名は MIME エンコードし、本文は UTF-8 を base64 で送ります
+func (n *smtpNotifier) message(note Notification) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", note.Subject()))
+	fmt.Fprintf(&buf, "Date: %s\r\n", note.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := note.Message + "\r\n"
+	if note.JobID != "" {
+		body += "\r\nジョブID: " + note.JobID + "\r\n"
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
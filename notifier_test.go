@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonReceiver は受け取った JSON を記録するサーバーです
+func jsonReceiver(t *testing.T, status int) (*httptest.Server, func() []map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]any(nil), received...)
+	}
+}
+
+// smtpMail は testSMTPServer が受け取ったメールです
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// testSMTPServer はメールを受け取って記録するだけのローカルの SMTP サーバーです
+func testSMTPServer(t *testing.T) (string, func() []smtpMail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	var mu sync.Mutex
+	var mails []smtpMail
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+				reply("220 localhost ESMTP")
+				var m smtpMail
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.TrimRight(line, "\r\n")
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 localhost")
+					case strings.HasPrefix(cmd, "MAIL FROM:"):
+						m.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+						reply("250 OK")
+					case strings.HasPrefix(cmd, "RCPT TO:"):
+						m.to = append(m.to, strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>"))
+						reply("250 OK")
+					case cmd == "DATA":
+						reply("354 Go ahead")
+						var data strings.Builder
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							data.WriteString(line)
+						}
+						m.data = data.String()
+						mu.Lock()
+						mails = append(mails, m)
+						mu.Unlock()
+						reply("250 OK")
+					case cmd == "QUIT":
+						reply("221 Bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), func() []smtpMail {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]smtpMail(nil), mails...)
+	}
+}
+
+func TestNotifiersRoute(t *testing.T) {
+	c := NotifyConfig{
+		Channels: map[string]NotifierConfig{
+			"bot":   {Type: notifierLineWorks, URL: "http://bot/api/tasks"},
+			"slack": {Type: notifierSlack, URL: "http://slack/hook"},
+			"mail":  {Type: notifierSMTP, Host: "smtp.local", From: "alert@example.com", To: []string{"ops@example.com"}},
+		},
+		Routes: []NotifyRoute{
+			{Channels: []string{"bot"}},
+			{JobTypes: []string{jobTypeEtcMeisai}, MinSeverity: severityError, Channels: []string{"mail", "bot"}},
+			{Accounts: []string{"honsha"}, MinSeverity: severityWarning, Channels: []string{"slack"}},
+		},
+	}
+	n, err := NewNotifiers(c, LineWorksConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, "smtp smtp.local:25 → ops@example.com", n.channels["mail"].String())
+
+	assert.Equal(t, []string{"bot"}, n.Route(Notification{Severity: severityInfo, JobType: jobTypeEtcMeisai}))
+	assert.Equal(t, []string{"bot", "mail"}, n.Route(Notification{Severity: severityError, JobType: jobTypeEtcMeisai}))
+	assert.Equal(t, []string{"bot"}, n.Route(Notification{Severity: severityInfo, JobType: jobTypeGeneralCsv, Account: "honsha"}))
+	assert.Equal(t, []string{"bot", "slack"}, n.Route(Notification{Severity: severityWarning, JobType: jobTypeGeneralCsv, Account: "honsha"}))
+
+	// ルールがない場合は全ての通知先に送信する
+	c.Routes = nil
+	n, err = NewNotifiers(c, LineWorksConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bot", "mail", "slack"}, n.Route(Notification{Severity: severityInfo}))
+
+	// 通知先を登録していない場合は lineworks.url のプロキシに送信する
+	n, err = NewNotifiers(NotifyConfig{}, LineWorksConfig{URL: "http://bot/api/tasks"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{notifierLineWorks}, n.Route(Notification{Severity: severityError}))
+	assert.Equal(t, "lineworks http://bot/api/tasks", n.channels[notifierLineWorks].String())
+
+	for _, tc := range []struct {
+		config NotifyConfig
+		err    string
+	}{
+		{NotifyConfig{Channels: map[string]NotifierConfig{"x": {Type: "fax"}}}, "通知先 'x': 通知先の type 'fax' は不正です"},
+		{NotifyConfig{Channels: map[string]NotifierConfig{"x": {Type: notifierWebhook}}}, "webhook の通知先には url が必要です"},
+		{NotifyConfig{Channels: map[string]NotifierConfig{"x": {Type: notifierSMTP, Host: "smtp.local"}}}, "from と to が必要です"},
+		{NotifyConfig{Routes: []NotifyRoute{{Channels: []string{"nowhere"}}}}, "通知先 'nowhere' は notify.channels に登録されていません"},
+		{NotifyConfig{Routes: []NotifyRoute{{}}}, "channels が指定されていません"},
+		{NotifyConfig{Routes: []NotifyRoute{{MinSeverity: "fatal", Channels: []string{"lineworks"}}}}, "重要度 'fatal' は不正です"},
+	} {
+		_, err := NewNotifiers(tc.config, LineWorksConfig{URL: "http://bot/api/tasks"})
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	bot, botReceived := jsonReceiver(t, http.StatusOK)
+	webhook, webhookReceived := jsonReceiver(t, http.StatusOK)
+	slack, slackReceived := jsonReceiver(t, http.StatusOK)
+	failing, _ := jsonReceiver(t, http.StatusBadGateway)
+	n, err := NewNotifiers(NotifyConfig{Channels: map[string]NotifierConfig{
+		"bot":     {Type: notifierLineWorks, URL: bot.URL},
+		"webhook": {Type: notifierWebhook, URL: webhook.URL},
+		"slack":   {Type: notifierSlack, URL: slack.URL},
+		"failing": {Type: notifierWebhook, URL: failing.URL},
+	}}, LineWorksConfig{})
+	assert.Nil(t, err)
+
+	at := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	note := Notification{Severity: severityError, JobType: jobTypeGeneralCsv, Account: "honsha", JobID: "3f9c2a1b7d4e8f60", Message: "スクレイピング中にエラーが発生しました", Time: at}
+	// 1つの通知先に失敗しても残りの通知先には送信する
+	err = n.Notify(context.Background(), note)
+	assert.ErrorContains(t, err, "通知先 'failing': HTTP POSTリクエスト失敗: ステータスコード 502")
+
+	assert.Equal(t, []map[string]any{{"test": "sendTextMessageLine", "message": "スクレイピング中にエラーが発生しました"}}, botReceived())
+	assert.Equal(t, []map[string]any{{
+		"severity": "error", "jobType": "GeneralCsv", "account": "honsha", "jobId": "3f9c2a1b7d4e8f60",
+		"message": "スクレイピング中にエラーが発生しました", "time": "2026-10-17T06:00:00Z",
+	}}, webhookReceived())
+	assert.Equal(t, []map[string]any{{"text": "*[error] GeneralCsv honsha*\nスクレイピング中にエラーが発生しました"}}, slackReceived())
+
+	// ジョブのエラーはジョブの種類・アカウントを付けて通知する
+	old := notifiers
+	t.Cleanup(func() { notifiers = old })
+	notifiers = n
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "etc-honsha")
+	notifyJobError(job, "etc-meisai.jpからのデータ取得中にエラーが発生しました", nil)
+	received := webhookReceived()
+	assert.Len(t, received, 2)
+	assert.Equal(t, "etc-meisai", received[1]["jobType"])
+	assert.Equal(t, "etc-honsha", received[1]["account"])
+	assert.Equal(t, job.Info().ID, received[1]["jobId"])
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails := testSMTPServer(t)
+	notifier, err := NewNotifier(NotifierConfig{Type: notifierSMTP, Host: addr, From: "alert@example.com", To: []string{"ops@example.com", "dispatch@example.com"}}, nil)
+	assert.Nil(t, err)
+
+	note := Notification{Severity: severityError, JobType: jobTypeEtcMeisai, Account: "etc-honsha", JobID: "3f9c2a1b7d4e8f60", Message: "etc-meisai.jpからのデータ取得中にエラーが発生しました", Time: time.Now()}
+	assert.Nil(t, notifier.Notify(context.Background(), note))
+
+	received := mails()
+	assert.Len(t, received, 1)
+	assert.Equal(t, "alert@example.com", received[0].from)
+	assert.Equal(t, []string{"ops@example.com", "dispatch@example.com"}, received[0].to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(received[0].data))
+	assert.Nil(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Nil(t, err)
+	assert.Equal(t, "[error] etc-meisai etc-honsha", subject)
+	assert.Equal(t, "base64", msg.Header.Get("Content-Transfer-Encoding"))
+	body, err := io.ReadAll(msg.Body)
+	assert.Nil(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "etc-meisai.jpからのデータ取得中にエラーが発生しました\r\n\r\nジョブID: 3f9c2a1b7d4e8f60\r\n", string(decoded))
+
+	// SMTPサーバーに接続できない場合はエラー
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed := l.Addr().String()
+	l.Close()
+	notifier, err = NewNotifier(NotifierConfig{Type: notifierSMTP, Host: closed, From: "alert@example.com", To: []string{"ops@example.com"}}, nil)
+	assert.Nil(t, err)
+	assert.ErrorContains(t, notifier.Notify(context.Background(), note), "SMTPサーバーへの接続に失敗しました")
+}
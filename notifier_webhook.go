@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+)
+
+// lineWorksProxyNotifier は LINE WORKS ボットのプロキシに通知します
+type lineWorksProxyNotifier struct {
+	URL string
+}
+
+func (n *lineWorksProxyNotifier) Notify(ctx context.Context, note Notification) error {
+	payload := map[string]string{
+		"test":    "sendTextMessageLine",
+		"message": note.Message,
+	}
+	return postJsonContext(ctx, payload, n.URL)
+}
+
+func (n *lineWorksProxyNotifier) String() string {
+	return notifierLineWorks + " " + n.URL
+}
+
+// webhookNotifier は通知の内容（Notification）をそのまま JSON で POST します
+type webhookNotifier struct {
+	URL string
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, note Notification) error {
+	return postJsonContext(ctx, note, n.URL)
+}
+
+func (n *webhookNotifier) String() string {
+	return notifierWebhook + " " + n.URL
+}
+
+// slackNotifier は Slack 互換の Incoming Webhook に {"text": "..."} を POST します
+type slackNotifier struct {
+	URL string
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, note Notification) error {
+	payload := map[string]string{
+		"text": "*" + note.Subject() + "*\n" + note.Message,
+	}
+	return postJsonContext(ctx, payload, n.URL)
+}
+
+func (n *slackNotifier) String() string {
+	return notifierSlack + " " + n.URL
+}
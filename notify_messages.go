@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 通知のメッセージのテンプレートを使うイベントです
+const (
+	eventStarted        = "started"
+	eventSucceeded      = "succeeded"
+	eventFailed         = "failed"
+	eventDeliveryFailed = "deliveryFailed"
+	eventDigest         = "digest"
+)
+
+// digestPeriod はダイジェストに含めるジョブの期間です
+const digestPeriod = 24 * time.Hour
+
+// MessageTemplates はイベントごとの通知のメッセージのテンプレート（text/template）です
+// テンプレートでは MessageData（digest は DigestData）の項目と size・duration 関数を使えます
+type MessageTemplates struct {
+	Started        string `yaml:"started"`
+	Succeeded      string `yaml:"succeeded"`
+	Failed         string `yaml:"failed"`
+	DeliveryFailed string `yaml:"deliveryFailed"`
+	Digest         string `yaml:"digest"`
+}
+
+// NotifyAccountConfig はアカウントごとに通知するイベントの設定です（失敗は常に通知します）
+type NotifyAccountConfig struct {
+	Started   bool `yaml:"started"`   // ジョブの開始を通知する
+	Succeeded bool `yaml:"succeeded"` // ジョブの成功を通知する
+}
+
+// MessageData はテンプレートに渡すジョブの情報です
+type MessageData struct {
+	Event         string
+	JobID         string
+	Type          string
+	Site          string
+	Account       string
+	From          string // ダウンロードした期間（2006-01-02 形式）
+	To            string
+	Status        JobStatus
+	Error         string
+	ErrorCategory string
+	Message       string        // 失敗の場合はエラーを含むメッセージ
+	Rows          int           // ダウンロードしたCSVの行数（マニフェストの合計）
+	Files         int           // ダウンロードしたファイルの数
+	Size          int64         // ダウンロードしたファイルのバイト数の合計
+	Duration      time.Duration // ジョブの開始から終了（実行中の場合は現在）まで
+	Target        string        // deliveryFailed: 送信先
+	Outbox        string        // deliveryFailed: 送信待ちのID
+}
+
+// DigestData はダイジェストのテンプレートに渡す情報です
+type DigestData struct {
+	From      time.Time
+	To        time.Time
+	Jobs      []MessageData // 期間内に作成したジョブ（古い順）
+	Succeeded int
+	Failed    int
+	Other     int // 実行中・キャンセルなど
+}
+
+// messageFuncs はテンプレートで使える関数です
+var messageFuncs = template.FuncMap{
+	"size":     formatSize,
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+}
+
+// formatSize はバイト数を読みやすい単位に変換します
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, "KMGT"
+	for value >= unit && len(prefix) > 1 {
+		value /= unit
+		prefix = prefix[1:]
+	}
+	return fmt.Sprintf("%.1f %cB", value, prefix[0])
+}
+
+// parseMessageTemplates はイベントごとのテンプレートを解析します
+func parseMessageTemplates(t MessageTemplates) (map[string]*template.Template, error) {
+	parsed := map[string]*template.Template{}
+	for event, text := range map[string]string{
+		eventStarted:        t.Started,
+		eventSucceeded:      t.Succeeded,
+		eventFailed:         t.Failed,
+		eventDeliveryFailed: t.DeliveryFailed,
+		eventDigest:         t.Digest,
+	} {
+		if text == "" {
+			continue // 空の場合は組み込みのメッセージを使う
+		}
+		tmpl, err := template.New(event).Funcs(messageFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notify.templates.%s: %w", event, err)
+		}
+		parsed[event] = tmpl
+	}
+	return parsed, nil
+}
+
+// render はイベントのテンプレートでメッセージを作成します
+// テンプレートの実行に失敗した場合は fallback を返します
+func (n *Notifiers) render(event string, data any, fallback string) string {
+	tmpl, ok := n.templates[event]
+	if !ok {
+		return fallback
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		log.Printf("通知のテンプレート %s の実行に失敗しました: %v", event, err)
+		return fallback
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// newMessageData はジョブの情報からテンプレートに渡す情報を作成します
+func newMessageData(event string, job *Job, now time.Time) MessageData {
+	data := MessageData{Event: event}
+	if job == nil {
+		return data
+	}
+	info := job.Info()
+	data.JobID, data.Type, data.Site, data.Account = info.ID, info.Type, info.Site, info.Account
+	data.Status, data.Error, data.ErrorCategory = info.Status, info.Error, info.ErrorCategory
+	if info.Range != nil {
+		data.From, data.To = info.Range.From, info.Range.To
+	}
+	for _, m := range info.Manifest {
+		data.Rows += m.Rows
+	}
+	if info.StartedAt != nil {
+		end := now
+		if info.EndedAt != nil {
+			end = *info.EndedAt
+		}
+		data.Duration = end.Sub(*info.StartedAt)
+	}
+	if artifacts, err := job.Artifacts(); err == nil {
+		for _, a := range artifacts {
+			if path.Dir(a.Path) == artifactDownloads {
+				data.Files++
+				data.Size += a.Size
+			}
+		}
+	}
+	return data
+}
+
+// noteFor はジョブの通知を作成します
+func noteFor(severity string, data MessageData, message string) Notification {
+	return Notification{Severity: severity, JobType: data.Type, Account: data.Account, JobID: data.JobID, Message: message}
+}
+
+// notifyJobStarted はジョブの開始を通知します（notify.accounts で started を指定したアカウントのみ）
+func notifyJobStarted(n *Notifiers, job *Job) {
+	info := job.Info()
+	if n == nil || !n.accounts[info.Account].Started {
+		return
+	}
+	data := newMessageData(eventStarted, job, n.now())
+	n.Notify(context.Background(), noteFor(severityInfo, data, n.render(eventStarted, data, info.Type+" のジョブを開始しました。")))
+}
+
+// notifyJobSucceeded はジョブの成功を通知します（notify.accounts で succeeded を指定したアカウントのみ）
+func notifyJobSucceeded(n *Notifiers, job *Job) {
+	info := job.Info()
+	if n == nil || !n.accounts[info.Account].Succeeded {
+		return
+	}
+	data := newMessageData(eventSucceeded, job, n.now())
+	n.Notify(context.Background(), noteFor(severityInfo, data, n.render(eventSucceeded, data, info.Type+" のジョブが完了しました。")))
+}
+
+// notifyDeliveryFailed はファイルの送信に失敗して送信待ちに追加したことを通知します
+func notifyDeliveryFailed(job *Job, d Delivery) {
+	n := notifiers
+	if n == nil {
+		return
+	}
+	data := newMessageData(eventDeliveryFailed, job, n.now())
+	data.Target, data.Outbox, data.Error = d.Target, d.ID, d.LastError
+	fallback := fmt.Sprintf("%s への送信に失敗しました: %s", d.Target, d.LastError)
+	n.Notify(context.Background(), noteFor(severityWarning, data, n.render(eventDeliveryFailed, data, fallback)))
+}
+
+// Digest は now までの24時間に作成したジョブの一覧のメッセージを作成します
+func (n *Notifiers) Digest(store *JobStore, now time.Time) string {
+	data := DigestData{From: now.Add(-digestPeriod), To: now}
+	for _, job := range store.List() {
+		info := job.Info()
+		if info.CreatedAt.Before(data.From) || info.CreatedAt.After(now) {
+			continue
+		}
+		switch info.Status {
+		case JobSucceeded:
+			data.Succeeded++
+		case JobFailed:
+			data.Failed++
+		default:
+			data.Other++
+		}
+		data.Jobs = append(data.Jobs, newMessageData(eventDigest, job, now))
+	}
+	fallback := fmt.Sprintf("過去24時間のジョブ: 成功 %d 件、失敗 %d 件、その他 %d 件", data.Succeeded, data.Failed, data.Other)
+	return n.render(eventDigest, data, fallback)
+}
+
+// startDigest は cron 式の時刻に過去24時間のジョブの一覧を通知します（cron 式が空の場合は通知しない）
+func (n *Notifiers) startDigest(spec string, store *JobStore) error {
+	if spec == "" {
+		return nil
+	}
+	c := cron.New()
+	if _, err := c.AddFunc(spec, func() {
+		n.Notify(context.Background(), Notification{Severity: severityInfo, Message: n.Digest(store, n.now())})
+	}); err != nil {
+		return fmt.Errorf("notify.digestCron '%s' が不正です: %w", spec, err)
+	}
+	c.Start()
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "2.0 MB", formatSize(2*1024*1024))
+	assert.Equal(t, "3.0 GB", formatSize(3*1024*1024*1024))
+}
+
+func TestMessageTemplates(t *testing.T) {
+	c := DefaultConfig().Notify
+	c.Accounts = map[string]NotifyAccountConfig{"honsha": {Started: true, Succeeded: true}}
+	n, messages, _ := testAlertNotifiers(t, c)
+	store := NewJobStore(t.TempDir())
+
+	download := func(ctx context.Context, job *Job) error {
+		job.SetTarget("etc-meisai", time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local), time.Date(2026, 9, 30, 0, 0, 0, 0, time.Local))
+		file, err := job.ArtifactPath(artifactDownloads, "etc.csv")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, make([]byte, 2048), 0644); err != nil {
+			return err
+		}
+		job.AddManifest(ManifestEntry{File: "etc.csv", Type: "etc", Rows: 12, Size: 2048})
+		return nil
+	}
+	job := store.Start(jobTypeEtcMeisai, "honsha", download)
+	assert.Eventually(t, func() bool { return job.Info().EndedAt != nil }, 5*time.Second, 10*time.Millisecond)
+	notifyJobStarted(n, job)
+	notifyJobFinished(n, job)
+	assert.Equal(t, []string{
+		"etc-meisai のジョブを開始しました（honsha）。",
+		"etc-meisai のジョブが完了しました（honsha）。期間: 2026-09-01〜2026-09-30、1 ファイル（2.0 KB）、12 行、0s",
+	}, messages())
+
+	// notify.accounts に指定していないアカウントの開始・成功は通知しない
+	other := store.Start(jobTypeEtcMeisai, "shiten", download)
+	assert.Eventually(t, func() bool { return other.Info().EndedAt != nil }, 5*time.Second, 10*time.Millisecond)
+	notifyJobStarted(n, other)
+	notifyJobFinished(n, other)
+	assert.Len(t, messages(), 2)
+
+	// 通知先がない場合は何もしない
+	assert.NotPanics(t, func() {
+		notifyJobStarted(nil, job)
+		notifyJobSucceeded(nil, job)
+	})
+}
+
+func TestFailedTemplate(t *testing.T) {
+	c := DefaultConfig().Notify
+	c.DedupeWindowSeconds = 600
+	c.GroupWindowSeconds = 0
+	c.Templates.Failed = "{{.Type}}（{{.Account}}）[{{.ErrorCategory}}] {{.Error}}"
+	n, messages, now := testAlertNotifiers(t, c)
+	old := notifiers
+	t.Cleanup(func() { notifiers = old })
+	notifiers = n
+	store := NewJobStore(t.TempDir())
+
+	// テンプレートで整形しても、重複の排除は整形前のメッセージで判定する
+	err := errors.New("タイムアウトしました")
+	for i := 0; i < 2; i++ {
+		notifyJobError(store.New(jobTypeGeneralCsv, "honsha"), "スクレイピング中にエラーが発生しました: タイムアウトしました", err)
+		*now = now.Add(time.Minute)
+	}
+	assert.Equal(t, []string{"GeneralCsv（honsha）[unknown] タイムアウトしました"}, messages())
+}
+
+func TestDeliveryFailedTemplate(t *testing.T) {
+	n, messages, _ := testAlertNotifiers(t, DefaultConfig().Notify)
+	old := notifiers
+	t.Cleanup(func() { notifiers = old })
+	notifiers = n
+	o := useTestOutbox(t, 3)
+	_, server := newFlakyReceiver(t)
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeGeneralCsv, "honsha")
+	file := writeTestFile(t, "export.zip", "PK")
+
+	assert.NotNil(t, deliverFiles(context.Background(), job, []Sink{&httpSink{URL: server.URL}}, []string{file}))
+	d := o.List()[0]
+	assert.Equal(t, []string{"GeneralCsv のファイルの送信に失敗しました（honsha）: " + d.Target + ": ファイル送信失敗: ステータスコード 503（送信待ち " + d.ID + " から再送します）"}, messages())
+}
+
+func TestDigest(t *testing.T) {
+	n, _, now := testAlertNotifiers(t, DefaultConfig().Notify)
+	store := NewJobStore(t.TempDir())
+	add := func(account string, status JobStatus, errMessage string, age time.Duration) {
+		job := store.New(jobTypeGeneralCsv, account)
+		job.info.Status, job.info.Error, job.info.CreatedAt = status, errMessage, now.Add(-age)
+	}
+	add("honsha", JobSucceeded, "", 25*time.Hour) // 24時間より前のジョブは含めない
+	add("honsha", JobFailed, "タイムアウトしました", 3*time.Hour)
+	add("shiten", JobSucceeded, "", 2*time.Hour)
+	add("", JobRunning, "", time.Minute)
+
+	assert.Equal(t, "過去24時間のジョブ: 成功 1 件、失敗 1 件、その他 1 件\n"+
+		"- GeneralCsv honsha: failed（タイムアウトしました）\n"+
+		"- GeneralCsv shiten: succeeded\n"+
+		"- GeneralCsv: running", n.Digest(store, *now))
+
+	// テンプレートが空の場合は組み込みのメッセージを使う
+	c := DefaultConfig().Notify
+	c.Templates.Digest = ""
+	n, _, _ = testAlertNotifiers(t, c)
+	assert.Equal(t, "過去24時間のジョブ: 成功 1 件、失敗 1 件、その他 1 件", n.Digest(store, *now))
+}
+
+func TestMessageTemplatesConfig(t *testing.T) {
+	c := DefaultConfig().Notify
+	c.Templates.Succeeded = "{{.Type"
+	_, err := NewNotifiers(c, LineWorksConfig{})
+	assert.ErrorContains(t, err, "notify.templates.succeeded")
+
+	n, err := NewNotifiers(DefaultConfig().Notify, LineWorksConfig{})
+	assert.Nil(t, err)
+	assert.ErrorContains(t, n.startDigest("every day", NewJobStore(t.TempDir())), "notify.digestCron 'every day' が不正です")
+	assert.Nil(t, n.startDigest("", NewJobStore(t.TempDir())))
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 送信待ちの状態です
+const (
+	outboxPending = "pending" // 次の再送を待っている
+	outboxFailed  = "failed"  // 再送の回数の上限に達した（POST /deliveries/{id}/retry でのみ再送する）
+	outboxSent    = "sent"    // 再送に成功した（送信待ちから削除済み）
+)
+
+const outboxRecordName = "delivery.json"
+
+var (
+	// errDeliveryNotFound は指定された送信待ちが見つからない場合のエラーです
+	errDeliveryNotFound = errors.New("指定された送信待ちが見つかりません")
+	// errDeliveryBusy は指定された送信待ちを送信中の場合のエラーです
+	errDeliveryBusy = errors.New("指定された送信待ちは送信中です")
+)
+
+// Delivery は GET /deliveries で返す送信待ちの状態です
+type Delivery struct {
+	ID            string    `json:"id"`
+	JobID         string    `json:"jobId,omitempty"`
+	Target        string    `json:"target"` // 送信先の説明（パスワードなどは含めない）
+	Files         []string  `json:"files"`  // 送信先での名前
+	Status        string    `json:"status"` // pending / failed / sent
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitzero"`
+}
+
+// outboxRecord は送信待ちのディレクトリに保存する内容です
+// ファイルは送信待ちのディレクトリにコピーするため、ジョブの作業ディレクトリが削除されても再送できます
+type outboxRecord struct {
+	Delivery
+	Sink   SinkConfig      `json:"sink"`
+	Fields url.Values      `json:"fields,omitempty"` // Bundle の場合に一緒に送るフォームの値
+	Parts  []multipartFile `json:"parts"`            // Path は送信待ちのディレクトリの中のファイル名
+	Bundle bool            `json:"bundle,omitempty"` // http の送信先に全てのファイルを1回の POST で送る
+
+	sending bool // 送信中（同じ送信待ちを同時に送信しない）
+}
+
+// Outbox は送信に失敗したファイルを保存し、指数バックオフとジッターで再送します
+type Outbox struct {
+	dir         string
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      func() float64 // 0〜1 の乱数（テストで差し替える）
+	timeout     time.Duration  // 1回の再送のタイムアウト（0 の場合は打ち切らない）
+
+	mu      sync.Mutex
+	records map[string]*outboxRecord
+}
+
+// outbox はサーバー起動時に開く送信待ちです（nil の場合は送信に失敗したファイルを保存しません）
+var outbox *Outbox
+
+// NewOutbox は dir に保存した送信待ちを読み込みます
+func NewOutbox(dir string, maxAttempts int, baseDelay, maxDelay time.Duration) (*Outbox, error) {
+	o := &Outbox{
+		dir:         dir,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		jitter:      rand.Float64,
+		records:     make(map[string]*outboxRecord),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("送信待ちのディレクトリ '%s' の作成に失敗しました: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("送信待ちのディレクトリ '%s' の読み取りに失敗しました: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), outboxRecordName))
+		if err != nil {
+			log.Printf("送信待ち '%s' の読み込みに失敗しました: %v", entry.Name(), err)
+			continue
+		}
+		var rec outboxRecord
+		if err := json.Unmarshal(data, &rec); err != nil || rec.ID != entry.Name() {
+			log.Printf("送信待ち '%s' の解析に失敗しました: %v", entry.Name(), err)
+			continue
+		}
+		o.records[rec.ID] = &rec
+	}
+	return o, nil
+}
+
+// backoff は attempts 回失敗した後、次に再送するまでの時間です
+// baseDelay × 2^(attempts-1)（上限 maxDelay）の半分から全体までのランダムな時間にします
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.baseDelay
+	for i := 1; i < attempts && d < o.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, o.maxDelay)
+	return d/2 + time.Duration(o.jitter()*float64(d/2))
+}
+
+// EnqueueFiles は sink への送信に失敗したファイルを送信待ちに追加します
+// files は送信先での名前 → 送信するファイルです
+func (o *Outbox) EnqueueFiles(job *Job, sink Sink, files []multipartFile, cause error) (Delivery, error) {
+	return o.enqueue(job, &outboxRecord{Sink: sink.Config(), Parts: files}, sink.String(), cause)
+}
+
+// EnqueuePost は1回の multipart の POST で送信する予定だったファイルを送信待ちに追加します
+func (o *Outbox) EnqueuePost(job *Job, target string, fields url.Values, parts []multipartFile, cause error) (Delivery, error) {
+	sink := &httpSink{URL: target}
+	return o.enqueue(job, &outboxRecord{Sink: sink.Config(), Fields: fields, Parts: parts, Bundle: true}, sink.String(), cause)
+}
+
+func (o *Outbox) enqueue(job *Job, rec *outboxRecord, target string, cause error) (Delivery, error) {
+	now := time.Now()
+	rec.ID = newJobID()
+	if job != nil {
+		rec.JobID = job.Info().ID
+	}
+	rec.Target = target
+	rec.Status = outboxPending
+	rec.Attempts = 1 // 送信待ちに追加する前の送信を1回目とする
+	rec.LastError = cause.Error()
+	rec.CreatedAt = now
+	rec.UpdatedAt = now
+	rec.NextAttemptAt = now.Add(o.backoff(1))
+	if rec.Attempts >= o.maxAttempts {
+		rec.Status = outboxFailed
+		rec.NextAttemptAt = time.Time{}
+	}
+
+	dir := filepath.Join(o.dir, rec.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Delivery{}, fmt.Errorf("送信待ちのディレクトリの作成に失敗しました: %w", err)
+	}
+	parts := make([]multipartFile, len(rec.Parts))
+	for i, part := range rec.Parts {
+		local := fmt.Sprintf("%03d_%s", i, filepath.Base(part.Path))
+		if err := copyFile(part.Path, filepath.Join(dir, local)); err != nil {
+			os.RemoveAll(dir)
+			return Delivery{}, fmt.Errorf("送信待ちへの '%s' のコピーに失敗しました: %w", filepath.Base(part.Path), err)
+		}
+		part.Path = local
+		parts[i] = part
+		rec.Files = append(rec.Files, part.Name)
+	}
+	rec.Parts = parts
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.saveLocked(rec); err != nil {
+		os.RemoveAll(dir)
+		return Delivery{}, err
+	}
+	o.records[rec.ID] = rec
+	return rec.Delivery, nil
+}
+
+// List は全ての送信待ちを追加した順に返します
+func (o *Outbox) List() []Delivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	deliveries := make([]Delivery, 0, len(o.records))
+	for _, rec := range o.records {
+		d := rec.Delivery
+		d.Files = slices.Clone(d.Files)
+		deliveries = append(deliveries, d)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
+
+// Retry は送信待ちをすぐに再送します。再送の回数の上限に達した送信待ちも再送します
+// 送信に成功した場合は送信待ちから削除し、状態が sent の Delivery を返します
+func (o *Outbox) Retry(ctx context.Context, id string) (Delivery, error) {
+	o.mu.Lock()
+	rec, ok := o.records[id]
+	if !ok {
+		o.mu.Unlock()
+		return Delivery{}, errDeliveryNotFound
+	}
+	if rec.sending {
+		o.mu.Unlock()
+		return Delivery{}, errDeliveryBusy
+	}
+	rec.sending = true
+	o.mu.Unlock()
+	return o.attempt(ctx, rec)
+}
+
+// RetryDue は now の時点で再送の時刻を過ぎた送信待ちを再送します
+func (o *Outbox) RetryDue(ctx context.Context, now time.Time) {
+	o.mu.Lock()
+	var due []*outboxRecord
+	for _, rec := range o.records {
+		if rec.Status == outboxPending && !rec.sending && !rec.NextAttemptAt.After(now) {
+			rec.sending = true
+			due = append(due, rec)
+		}
+	}
+	o.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	for i, rec := range due {
+		if ctx.Err() != nil {
+			o.mu.Lock()
+			for _, rest := range due[i:] {
+				rest.sending = false
+			}
+			o.mu.Unlock()
+			return
+		}
+		if d, err := o.attempt(ctx, rec); err != nil {
+			log.Printf("送信待ち %s（%s）の再送に失敗しました（%d 回目）: %v", d.ID, d.Target, d.Attempts, err)
+		}
+	}
+}
+
+// attempt は送信待ちを1回送信し、結果を保存します。rec.sending を立ててから呼び出します
+func (o *Outbox) attempt(ctx context.Context, rec *outboxRecord) (Delivery, error) {
+	sent, err := o.send(ctx, rec)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rec.sending = false
+	now := time.Now()
+	rec.UpdatedAt = now
+	if sent > 0 {
+		// 送信できたファイルは次の再送では送らない
+		rec.Parts = rec.Parts[sent:]
+		rec.Files = rec.Files[sent:]
+	}
+	if err == nil {
+		delete(o.records, rec.ID)
+		if rerr := os.RemoveAll(filepath.Join(o.dir, rec.ID)); rerr != nil {
+			log.Printf("送信待ち %s の削除に失敗しました: %v", rec.ID, rerr)
+		}
+		log.Printf("送信待ち %s（%s）を再送しました。", rec.ID, rec.Target)
+		d := rec.Delivery
+		d.Status = outboxSent
+		d.Attempts++
+		d.NextAttemptAt = time.Time{}
+		return d, nil
+	}
+	rec.Attempts++
+	rec.LastError = err.Error()
+	if rec.Attempts >= o.maxAttempts {
+		rec.Status = outboxFailed
+		rec.NextAttemptAt = time.Time{}
+	} else {
+		rec.Status = outboxPending
+		rec.NextAttemptAt = now.Add(o.backoff(rec.Attempts))
+	}
+	if serr := o.saveLocked(rec); serr != nil {
+		log.Printf("送信待ち %s の保存に失敗しました: %v", rec.ID, serr)
+	}
+	return rec.Delivery, err
+}
+
+// send は送信待ちのファイルを送信し、先頭から送信できたファイルの数を返します
+func (o *Outbox) send(ctx context.Context, rec *outboxRecord) (int, error) {
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	dir := filepath.Join(o.dir, rec.ID)
+	parts := make([]multipartFile, len(rec.Parts))
+	for i, part := range rec.Parts {
+		part.Path = filepath.Join(dir, part.Path)
+		parts[i] = part
+	}
+	if rec.Bundle {
+		if err := postMultipart(ctx, rec.Sink.URL, rec.Fields, parts); err != nil {
+			return 0, err
+		}
+		return len(parts), nil
+	}
+	sink, err := outboxSink(rec.Sink)
+	if err != nil {
+		return 0, err
+	}
+	for i, part := range parts {
+		if err := sink.Put(ctx, part.Path, part.Name); err != nil {
+			return i, err
+		}
+	}
+	return len(parts), nil
+}
+
+// outboxSink は送信待ちに保存した送信先を作り直します
+// 名前のない送信先は resUrl の multipart の POST だけです
+func outboxSink(c SinkConfig) (Sink, error) {
+	if c.Name != "" {
+		return NewSink(c)
+	}
+	if c.Type != sinkHTTP {
+		return nil, fmt.Errorf("送信待ちの送信先の type '%s' は不正です", c.Type)
+	}
+	return newSink(c)
+}
+
+// saveLocked は送信待ちを一時ファイルに書き込み、置き換えます
+// 送信先のパスワードを含む場合があるため、所有者だけが読めるようにします
+func (o *Outbox) saveLocked(rec *outboxRecord) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(o.dir, rec.ID, outboxRecordName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("送信待ちの書き込みに失敗しました: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("送信待ちの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Start は再送の時刻を過ぎた送信待ちを interval ごとに再送するゴルーチンを開始します
+func (o *Outbox) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			o.RetryDue(context.Background(), now)
+		}
+	}()
+}
+
+// copyFile は src を dst にコピーします
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// queuedError は送信に失敗し、送信待ちに追加したことを表すエラーです
+type queuedError struct {
+	ID  string // 送信待ちのID
+	Err error
+}
+
+func (e *queuedError) Error() string {
+	return fmt.Sprintf("%v（送信待ち %s に追加しました）", e.Err, e.ID)
+}
+
+func (e *queuedError) Unwrap() error {
+	return e.Err
+}
+
+// queuedID は err が送信待ちに追加した送信のエラーであれば、送信待ちのIDを返します
+func queuedID(err error) string {
+	var q *queuedError
+	if errors.As(err, &q) {
+		return q.ID
+	}
+	return ""
+}
+
+// postOrQueue は postMultipart で送信し、失敗した場合はファイルを送信待ちに追加します
+// ジョブがキャンセルされた場合は送信待ちに追加しません
+func postOrQueue(ctx context.Context, job *Job, target string, fields url.Values, parts []multipartFile) error {
+	err := postMultipart(ctx, target, fields, parts)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	if id := queueFailedPost(job, target, fields, parts, err); id != "" {
+		return &queuedError{ID: id, Err: err}
+	}
+	return err
+}
+
+// queueFailedFiles は sink への送信に失敗したファイルを送信待ちに追加し、ジョブのログに出力します
+// 送信待ちを使わない場合や追加に失敗した場合は空文字を返します
+func queueFailedFiles(job *Job, sink Sink, files []multipartFile, cause error) string {
+	if outbox == nil {
+		return ""
+	}
+	d, err := outbox.EnqueueFiles(job, sink, files, cause)
+	return logQueued(job, d, err)
+}
+
+// queueFailedPost は1回の POST で送信する予定だったファイルを送信待ちに追加し、ジョブのログに出力します
+func queueFailedPost(job *Job, target string, fields url.Values, parts []multipartFile, cause error) string {
+	if outbox == nil {
+		return ""
+	}
+	d, err := outbox.EnqueuePost(job, target, fields, parts, cause)
+	return logQueued(job, d, err)
+}
+
+func logQueued(job *Job, d Delivery, err error) string {
+	if err != nil {
+		job.Logf("送信待ちへの追加に失敗しました: %v", err)
+		return ""
+	}
+	job.Logf("送信に失敗したファイルを送信待ち %s に追加しました（%s 以降に再送します）。", d.ID, d.NextAttemptAt.Format(time.DateTime))
+	notifyDeliveryFailed(job, d)
+	return d.ID
+}
+
+// initOutbox は設定ファイルの outbox.dir から送信待ちを読み込み、再送を開始します
+func initOutbox() error {
+	c := cfg.Outbox
+	if c.IntervalSeconds <= 0 {
+		return fmt.Errorf("outbox.intervalSeconds %d は不正です（1以上を指定してください）", c.IntervalSeconds)
+	}
+	if c.TimeoutSeconds <= 0 {
+		return fmt.Errorf("outbox.timeoutSeconds %d は不正です（1以上を指定してください）", c.TimeoutSeconds)
+	}
+	o, err := NewOutbox(c.Dir, c.MaxAttempts, time.Duration(c.BaseDelaySeconds)*time.Second, time.Duration(c.MaxDelaySeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	o.timeout = time.Duration(c.TimeoutSeconds) * time.Second
+	outbox = o
+	log.Printf("送信待ちのディレクトリ '%s' を読み込みました（%d 件）", c.Dir, len(o.List()))
+	o.Start(time.Duration(c.IntervalSeconds) * time.Second)
+	return nil
+}
+
+// handleDeliveries は GET /deliveries のハンドラーです
+func handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	deliveries := []Delivery{}
+	if outbox != nil {
+		deliveries = outbox.List()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
+
+// handleDeliveryRetry は POST /deliveries/{id}/retry のハンドラーです
+// 送信の結果を返します（失敗した場合は 502）
+func handleDeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	if outbox == nil {
+		http.Error(w, errDeliveryNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	d, err := outbox.Retry(r.Context(), r.PathValue("id"))
+	if errors.Is(err, errDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errDeliveryBusy) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
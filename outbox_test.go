@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestOutbox はテスト用の一時ディレクトリに送信待ちを作成し、テスト終了時に元に戻します
+func useTestOutbox(t *testing.T, maxAttempts int) *Outbox {
+	t.Helper()
+	o, err := NewOutbox(t.TempDir(), maxAttempts, time.Minute, time.Hour)
+	assert.Nil(t, err)
+	o.jitter = func() float64 { return 1 }
+	old := outbox
+	outbox = o
+	t.Cleanup(func() { outbox = old })
+	return o
+}
+
+// flakyReceiver は down の間は503を返し、それ以外は受け取ったフォームを記録するサーバーです
+type flakyReceiver struct {
+	mu    sync.Mutex
+	down  bool
+	forms []*http.Request
+	files []string
+}
+
+func newFlakyReceiver(t *testing.T) (*flakyReceiver, *httptest.Server) {
+	t.Helper()
+	fr := &flakyReceiver{down: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fr.mu.Lock()
+		defer fr.mu.Unlock()
+		if fr.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); !assert.Nil(t, err) {
+			return
+		}
+		fr.forms = append(fr.forms, r)
+		for _, header := range r.MultipartForm.File["file"] {
+			f, _ := header.Open()
+			data, _ := io.ReadAll(f)
+			f.Close()
+			fr.files = append(fr.files, header.Filename+"="+string(data))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return fr, server
+}
+
+func (fr *flakyReceiver) setDown(down bool) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.down = down
+}
+
+func (fr *flakyReceiver) received() []string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return append([]string(nil), fr.files...)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	o := &Outbox{baseDelay: time.Minute, maxDelay: time.Hour, jitter: func() float64 { return 1 }}
+	assert.Equal(t, time.Minute, o.backoff(1))
+	assert.Equal(t, 2*time.Minute, o.backoff(2))
+	assert.Equal(t, 32*time.Minute, o.backoff(6))
+	assert.Equal(t, time.Hour, o.backoff(7))
+	assert.Equal(t, time.Hour, o.backoff(1000))
+
+	// ジッターは指数バックオフの時間の半分から全体まで
+	o.jitter = func() float64 { return 0 }
+	assert.Equal(t, 30*time.Second, o.backoff(1))
+	assert.Equal(t, 30*time.Minute, o.backoff(1000))
+}
+
+func TestOutboxRetry(t *testing.T) {
+	o := useTestOutbox(t, 3)
+	receiver, server := newFlakyReceiver(t)
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeGeneralCsv, "")
+	file := writeTestFile(t, "export.zip", "PK")
+
+	// 送信に失敗したファイルは送信待ちに追加する
+	err := deliverFiles(context.Background(), job, []Sink{&httpSink{URL: server.URL}}, []string{file})
+	assert.ErrorContains(t, err, "ステータスコード 503")
+	deliveries := o.List()
+	assert.Len(t, deliveries, 1)
+	d := deliveries[0]
+	assert.ErrorContains(t, err, "送信待ち "+d.ID+" に追加しました")
+	assert.Equal(t, job.Info().ID, d.JobID)
+	assert.Equal(t, outboxPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, []string{job.Info().ID + "/export.zip"}, d.Files)
+	assert.Equal(t, "ファイル送信失敗: ステータスコード 503", d.LastError)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), d.NextAttemptAt, 5*time.Second)
+
+	// ジョブの作業ディレクトリが削除されても再送できる
+	assert.Nil(t, os.Remove(file))
+
+	// 再送の時刻の前は何もしない
+	o.RetryDue(context.Background(), time.Now())
+	assert.Equal(t, 1, o.List()[0].Attempts)
+
+	o.RetryDue(context.Background(), d.NextAttemptAt)
+	d = o.List()[0]
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, outboxPending, d.Status)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), d.NextAttemptAt, 5*time.Second)
+
+	// サーバーを再起動しても送信待ちは残る
+	reloaded, err := NewOutbox(o.dir, 3, time.Minute, time.Hour)
+	assert.Nil(t, err)
+	list := reloaded.List()
+	assert.Len(t, list, 1)
+	assert.Equal(t, d.ID, list[0].ID)
+	assert.Equal(t, d.Files, list[0].Files)
+	assert.Equal(t, 2, list[0].Attempts)
+	assert.True(t, d.NextAttemptAt.Equal(list[0].NextAttemptAt))
+
+	// 回数の上限に達した場合は自動では再送しない
+	o.RetryDue(context.Background(), d.NextAttemptAt)
+	d = o.List()[0]
+	assert.Equal(t, 3, d.Attempts)
+	assert.Equal(t, outboxFailed, d.Status)
+	assert.True(t, d.NextAttemptAt.IsZero())
+	o.RetryDue(context.Background(), time.Now().Add(24*time.Hour))
+	assert.Equal(t, 3, o.List()[0].Attempts)
+
+	// 受信側が復旧すれば手動で再送できる
+	receiver.setDown(false)
+	sent, err := o.Retry(context.Background(), d.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, outboxSent, sent.Status)
+	assert.Equal(t, 4, sent.Attempts)
+	assert.Empty(t, o.List())
+	assert.Equal(t, []string{"export.zip=PK"}, receiver.received())
+	_, err = os.Stat(filepath.Join(o.dir, d.ID))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = o.Retry(context.Background(), d.ID)
+	assert.ErrorIs(t, err, errDeliveryNotFound)
+}
+
+func TestOutboxRetryTimeout(t *testing.T) {
+	o := useTestOutbox(t, 3)
+	o.timeout = 50 * time.Millisecond
+	// 最初の送信は503を返し、再送では応答しない受信側
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	job := NewJobStore(t.TempDir()).New(jobTypeGeneralCsv, "")
+
+	assert.NotNil(t, deliverFiles(context.Background(), job, []Sink{&httpSink{URL: server.URL}}, []string{writeTestFile(t, "export.zip", "PK")}))
+	d := o.List()[0]
+
+	// 応答のない送信先でも再送を打ち切り、次の再送を待つ
+	done := make(chan struct{})
+	go func() {
+		o.RetryDue(context.Background(), d.NextAttemptAt)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("再送がタイムアウトしませんでした")
+	}
+	d = o.List()[0]
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, outboxPending, d.Status)
+	assert.Contains(t, d.LastError, "context deadline exceeded")
+}
+
+func TestOutboxPartialAndBundle(t *testing.T) {
+	o := useTestOutbox(t, 10)
+	dir := t.TempDir()
+	files := []string{writeTestFile(t, "a.csv", "a"), writeTestFile(t, "b.csv", "b")}
+
+	// 送信先のディレクトリを作成できない場合
+	blocked := filepath.Join(dir, "blocked")
+	assert.Nil(t, os.WriteFile(blocked, nil, 0644))
+	orig := cfg.Sinks
+	t.Cleanup(func() { cfg.Sinks = orig })
+	cfg.Sinks = map[string]SinkConfig{"nas": {Type: sinkDir, Dir: blocked}}
+	sink, err := NewSink(SinkConfig{Name: "nas"})
+	assert.Nil(t, err)
+	_, err = o.EnqueueFiles(nil, sink, []multipartFile{{Path: files[0], Name: "job/a.csv"}, {Path: files[1], Name: "job/b.csv"}}, io.ErrUnexpectedEOF)
+	assert.Nil(t, err)
+	d := o.List()[0]
+	o.RetryDue(context.Background(), d.NextAttemptAt)
+	assert.Equal(t, 2, o.List()[0].Attempts)
+
+	assert.Nil(t, os.Remove(blocked))
+	o.RetryDue(context.Background(), time.Now().Add(24*time.Hour))
+	assert.Empty(t, o.List())
+	for _, name := range []string{"a.csv", "b.csv"} {
+		_, err := os.Stat(filepath.Join(blocked, "job", name))
+		assert.Nil(t, err)
+	}
+
+	// まとめて送信する場合はフォームの値も一緒に再送する
+	receiver, server := newFlakyReceiver(t)
+	parts := []multipartFile{{Field: "file", Path: files[0], Name: "ris01_a.csv"}, {Field: "file", Path: files[1], Name: "ris02_b.csv"}}
+	err = postOrQueue(context.Background(), nil, server.URL, url.Values{"risLoginId": {"ris01", "ris02"}}, parts)
+	id := queuedID(err)
+	assert.NotEmpty(t, id)
+	receiver.setDown(false)
+	_, err = o.Retry(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ris01_a.csv=a", "ris02_b.csv=b"}, receiver.received())
+	assert.Equal(t, []string{"ris01", "ris02"}, receiver.forms[0].MultipartForm.Value["risLoginId"])
+}
+
+func TestHandleDeliveries(t *testing.T) {
+	o := useTestOutbox(t, 10)
+	receiver, server := newFlakyReceiver(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deliveries", handleDeliveries)
+	mux.HandleFunc("/deliveries/{id}/retry", handleDeliveryRetry)
+
+	file := writeTestFile(t, "export.zip", "PK")
+	d, err := o.EnqueueFiles(nil, &httpSink{URL: server.URL}, []multipartFile{{Path: file, Name: "export.zip"}}, io.ErrUnexpectedEOF)
+	assert.Nil(t, err)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deliveries", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list []Delivery
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+	assert.Equal(t, d.ID, list[0].ID)
+	assert.Equal(t, "http "+server.URL, list[0].Target)
+	assert.NotContains(t, rec.Body.String(), `"sink"`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deliveries/"+d.ID+"/retry", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	var retried Delivery
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &retried))
+	assert.Equal(t, 2, retried.Attempts)
+
+	receiver.setDown(false)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deliveries/"+d.ID+"/retry", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &retried))
+	assert.Equal(t, outboxSent, retried.Status)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deliveries/"+d.ID+"/retry", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deliveries/"+d.ID+"/retry", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestOutboxSink(t *testing.T) {
+	sink, err := outboxSink(SinkConfig{Type: sinkHTTP, URL: "http://example.com/upload"})
+	assert.Nil(t, err)
+	assert.Equal(t, &httpSink{URL: "http://example.com/upload"}, sink)
+
+	// 名前のない送信先は resUrl の POST だけを作り直す
+	_, err = outboxSink(SinkConfig{Type: sinkDir, Dir: "/etc"})
+	assert.ErrorContains(t, err, "送信待ちの送信先の type 'dir' は不正です")
+}
+
+func TestInitOutboxConfig(t *testing.T) {
+	oldCfg, oldOutbox := cfg, outbox
+	t.Cleanup(func() { cfg, outbox = oldCfg, oldOutbox })
+	cfg = DefaultConfig()
+	cfg.Outbox.Dir = t.TempDir()
+	cfg.Outbox.TimeoutSeconds = 0
+	assert.ErrorContains(t, initOutbox(), "outbox.timeoutSeconds")
+	cfg.Outbox.TimeoutSeconds = 300
+
+	// 0以下の間隔は time.NewTicker が panic するため、起動前にエラーにする
+	for _, interval := range []int{0, -1} {
+		cfg.Outbox.IntervalSeconds = interval
+		assert.ErrorContains(t, initOutbox(), "outbox.intervalSeconds")
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"gopkg.in/yaml.v3"
+)
+
+// builtinScenarios は設定ファイルでシナリオを指定しない場合に使う組み込みのシナリオです
+//
+//go:embed scenarios/*.yaml
+var builtinScenarios embed.FS
+
+// シナリオのアクション
+const (
+	actionGoto           = "goto"            // url に移動する
+	actionFill           = "fill"            // selector に value を入力する
+	actionClick          = "click"           // selector をクリックする
+	actionSelect         = "select"          // selector（セレクトボックス）で value を選択する
+	actionCheckRadio     = "check_radio"     // name が selector のラジオボタンの index 番目を選択する
+	actionEvaluate       = "evaluate"        // script を実行する
+	actionWait           = "wait"            // selector の表示、または duration ミリ秒を待機する
+	actionAcceptDialogs  = "accept_dialogs"  // 以降に表示されるダイアログを全て受け入れる
+	actionExpectPopup    = "expect_popup"    // trigger で開いたウィンドウに対して steps を実行する
+	actionExpectDownload = "expect_download" // trigger で開始したダウンロードを save に保存する
+	actionScreenshot     = "screenshot"      // スクリーンショットを save に保存する
+	actionExtractTable   = "extract_table"   // rows・cells のテキストを var に保存する
+)
+
+// selector の種類（by）
+const (
+	selectByCSS   = "css"   // CSSセレクター（既定）
+	selectByName  = "name"  // name 属性
+	selectByValue = "value" // value 属性（ボタン）
+)
+
+// scenarioVarPattern はシナリオの中で ${変数名} を置き換えるためのパターンです
+var scenarioVarPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.]+)\}`)
+
+// Scenario はブラウザの操作手順を宣言的に記述したものです
+// サイトのアダプター（Scraper）から使う場合は login / navigate / setRange / download / logout の段階ごとに記述します
+type Scenario struct {
+	Name     string         `yaml:"name"`
+	Steps    []ScenarioStep `yaml:"steps,omitempty"` // 段階に分けない場合の手順（login より前に実行する）
+	Login    []ScenarioStep `yaml:"login,omitempty"`
+	Navigate []ScenarioStep `yaml:"navigate,omitempty"`
+	SetRange []ScenarioStep `yaml:"setRange,omitempty"`
+	Download []ScenarioStep `yaml:"download,omitempty"`
+	Logout   []ScenarioStep `yaml:"logout,omitempty"`
+}
+
+// phases は段階の名前と手順を実行順に返します
+func (sc *Scenario) phases() []scenarioPhase {
+	return []scenarioPhase{
+		{"steps", sc.Steps},
+		{"login", sc.Login},
+		{"navigate", sc.Navigate},
+		{"setRange", sc.SetRange},
+		{"download", sc.Download},
+		{"logout", sc.Logout},
+	}
+}
+
+type scenarioPhase struct {
+	name  string
+	steps []ScenarioStep
+}
+
+// ScenarioStep はシナリオの1ステップです
+// 文字列の項目には ${変数名} でログイン情報や日付などの変数を埋め込めます
+type ScenarioStep struct {
+	Action   string `yaml:"action"`
+	Step     string `yaml:"step,omitempty"` // 指定した場合はジョブのステップを更新する
+	Selector string `yaml:"selector,omitempty"`
+	By       string `yaml:"by,omitempty"` // css / name / value
+	Value    string `yaml:"value,omitempty"`
+	URL      string `yaml:"url,omitempty"`
+	Script   string `yaml:"script,omitempty"`
+	Index    int    `yaml:"index,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"`  // ミリ秒
+	Duration string `yaml:"duration,omitempty"` // ミリ秒
+	Save     string `yaml:"save,omitempty"`     // 保存するファイル名
+	Var      string `yaml:"var,omitempty"`      // 結果を保存する変数名
+
+	// extract_table の設定
+	Rows   string `yaml:"rows,omitempty"`   // 行のセレクター（既定: tr）
+	Cells  string `yaml:"cells,omitempty"`  // セルのセレクター（既定: td）
+	Column *int   `yaml:"column,omitempty"` // 指定した場合はこの列の値をログに出力する
+	Ignore string `yaml:"ignore,omitempty"` // ログに出力しない値（カンマ区切り）
+
+	// 実行条件（全て満たす場合だけ実行する）
+	IfExists  string `yaml:"ifExists,omitempty"`  // セレクターが存在する
+	IfValue   string `yaml:"ifValue,omitempty"`   // ifExists の要素の value が一致する
+	IfContent string `yaml:"ifContent,omitempty"` // ページの内容に含まれる
+	IfSet     string `yaml:"ifSet,omitempty"`     // 変数を展開した値が空でない（例: ifSet: ${cards}）
+	IfEmpty   string `yaml:"ifEmpty,omitempty"`   // 変数を展開した値が空
+
+	Optional bool `yaml:"optional,omitempty"` // 失敗してもログに出して次のステップに進む
+
+	Trigger []ScenarioStep `yaml:"trigger,omitempty"` // expect_popup / expect_download を開始する操作
+	Steps   []ScenarioStep `yaml:"steps,omitempty"`   // expect_popup で開いたウィンドウに対する操作
+}
+
+// ScenarioResult はシナリオの実行結果です
+type ScenarioResult struct {
+	Vars      map[string]string     // evaluate などで保存した変数を含む全ての変数
+	Downloads []string              // expect_download で保存したファイルのパス
+	Tables    map[string][][]string // extract_table で取得した表
+}
+
+// ParseScenario はYAMLのシナリオを読み込んで検証します
+func ParseScenario(data []byte) (*Scenario, error) {
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("シナリオの解析に失敗しました: %w", err)
+	}
+	total := 0
+	for _, phase := range sc.phases() {
+		if err := validateScenarioSteps(phase.steps, phase.name); err != nil {
+			return nil, fmt.Errorf("シナリオ '%s' が不正です: %w", sc.Name, err)
+		}
+		total += len(phase.steps)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("シナリオ '%s' にステップがありません", sc.Name)
+	}
+	return &sc, nil
+}
+
+// LoadScenario はシナリオファイルを読み込みます
+// path が空の場合は組み込みのシナリオ builtin を使います
+func LoadScenario(path string, builtin string) (*Scenario, error) {
+	var data []byte
+	var err error
+	if path == "" {
+		data, err = builtinScenarios.ReadFile("scenarios/" + builtin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("シナリオファイルの読み込みに失敗しました: %w", err)
+	}
+	return ParseScenario(data)
+}
+
+func validateScenarioSteps(steps []ScenarioStep, where string) error {
+	for i, step := range steps {
+		at := fmt.Sprintf("%s[%d] (%s)", where, i, step.Action)
+		var missing string
+		switch step.Action {
+		case actionGoto:
+			if step.URL == "" {
+				missing = "url"
+			}
+		case actionFill, actionSelect, actionCheckRadio, actionClick:
+			if step.Selector == "" {
+				missing = "selector"
+			}
+		case actionEvaluate:
+			if step.Script == "" {
+				missing = "script"
+			}
+		case actionWait:
+			if step.Selector == "" && step.Duration == "" {
+				missing = "selector または duration"
+			}
+		case actionScreenshot, actionExpectDownload:
+			if step.Save == "" {
+				missing = "save"
+			}
+		case actionExtractTable:
+			if step.Var == "" {
+				missing = "var"
+			}
+		case actionExpectPopup, actionAcceptDialogs:
+		default:
+			return fmt.Errorf("%s: 不明なアクションです", at)
+		}
+		if missing != "" {
+			return fmt.Errorf("%s: %s が指定されていません", at, missing)
+		}
+		switch step.By {
+		case "", selectByCSS, selectByName, selectByValue:
+		default:
+			return fmt.Errorf("%s: by '%s' は不正です（css / name / value）", at, step.By)
+		}
+		if err := validateScenarioSteps(step.Trigger, at+".trigger"); err != nil {
+			return err
+		}
+		if err := validateScenarioSteps(step.Steps, at+".steps"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScenario は page に対してシナリオの全ての段階を順に実行します
+func RunScenario(ctx context.Context, job *Job, page playwright.Page, sc *Scenario, vars map[string]string) (*ScenarioResult, error) {
+	r := newScenarioRunner(job, vars)
+	job.Logf("シナリオ '%s' を実行します。", sc.Name)
+	for _, phase := range sc.phases() {
+		if err := r.runSteps(ctx, page, phase.steps); err != nil {
+			return r.result, err
+		}
+	}
+	return r.result, nil
+}
+
+// scenarioRunner はシナリオの手順を実行し、変数やダウンロードしたファイルを保持します
+type scenarioRunner struct {
+	job    *Job
+	result *ScenarioResult
+}
+
+func newScenarioRunner(job *Job, vars map[string]string) *scenarioRunner {
+	r := &scenarioRunner{
+		job: job,
+		result: &ScenarioResult{
+			Vars:   make(map[string]string, len(vars)),
+			Tables: make(map[string][][]string),
+		},
+	}
+	for k, v := range vars {
+		r.result.Vars[k] = v
+	}
+	return r
+}
+
+func (r *scenarioRunner) runSteps(ctx context.Context, page playwright.Page, steps []ScenarioStep) error {
+	for _, raw := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		step, err := r.expand(raw)
+		if err != nil {
+			return err
+		}
+		if step.Step != "" {
+			r.job.SetStep(step.Step)
+		}
+		ok, err := r.shouldRun(page, step, raw)
+		if err == nil && ok {
+			err = r.runStep(ctx, page, step)
+		}
+		if err == nil {
+			continue
+		}
+		// キャンセルされた場合は optional でも中断する
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !step.Optional {
+			return fmt.Errorf("シナリオのステップ '%s' に失敗しました: %w", step.Action, err)
+		}
+		r.job.Logf("シナリオのステップ '%s' に失敗しましたが続行します: %v", step.Action, err)
+	}
+	return nil
+}
+
+// shouldRun は ifExists / ifValue / ifContent / ifSet / ifEmpty の条件を確認します
+// ifSet / ifEmpty は展開後の値で判定するため、YAML に書いた時点で空でなくても条件になります
+func (r *scenarioRunner) shouldRun(page playwright.Page, step ScenarioStep, raw ScenarioStep) (bool, error) {
+	if raw.IfSet != "" && step.IfSet == "" {
+		return false, nil
+	}
+	if raw.IfEmpty != "" && step.IfEmpty != "" {
+		return false, nil
+	}
+	if step.IfExists != "" {
+		exists, err := selectorExists(page, step.IfExists)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, nil
+		}
+		if step.IfValue != "" {
+			value, err := page.Locator(step.IfExists).Evaluate("el => el.value", nil)
+			if err != nil {
+				return false, fmt.Errorf("'%s' の値の取得に失敗しました: %w", step.IfExists, err)
+			}
+			if fmt.Sprint(value) != step.IfValue {
+				r.job.Logf("'%s' の値が '%v' のため、ステップ '%s' をスキップします。", step.IfExists, value, step.Action)
+				return false, nil
+			}
+		}
+	}
+	if step.IfContent != "" {
+		content, err := page.Content()
+		if err != nil {
+			return false, fmt.Errorf("ページの内容取得に失敗しました: %w", err)
+		}
+		if !contains(content, step.IfContent) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *scenarioRunner) runStep(ctx context.Context, page playwright.Page, step ScenarioStep) error {
+	timeout, err := scenarioMillis(step.Timeout)
+	if err != nil {
+		return err
+	}
+	var timeouts []int32
+	if step.Timeout != "" {
+		timeouts = append(timeouts, int32(timeout/time.Millisecond))
+	}
+
+	switch step.Action {
+	case actionGoto:
+		r.job.Logf("URLにアクセス中: %s", step.URL)
+		if _, err := page.Goto(step.URL); err != nil {
+			return fmt.Errorf("URLへの移動に失敗しました: %w", err)
+		}
+		title, err := page.Title()
+		if err != nil {
+			return fmt.Errorf("タイトル取得中にエラー: %w", err)
+		}
+		r.job.Logf("ページのタイトル: %s", title)
+	case actionFill:
+		if step.By == selectByName {
+			return inputSelectorWithName(ctx, page, step.Selector, step.Value)
+		}
+		return inputSelector(ctx, page, step.Selector, step.Value)
+	case actionClick:
+		switch step.By {
+		case selectByName:
+			return clickSelectorWithName(ctx, page, step.Selector, timeouts...)
+		case selectByValue:
+			return clickInputByValeue(ctx, page, step.Selector)
+		}
+		return clickSelector(ctx, page, step.Selector, timeouts...)
+	case actionSelect:
+		if step.By == selectByName {
+			return selectSlectorwithName(ctx, page, step.Selector, step.Value)
+		}
+		if _, err := page.Locator(step.Selector).SelectOption(playwright.SelectOptionValues{Values: &[]string{step.Value}}); err != nil {
+			return fmt.Errorf("セレクター '%s' の値 '%s' の選択に失敗しました: %w", step.Selector, step.Value, err)
+		}
+	case actionCheckRadio:
+		// value を指定した場合は index の代わりに使う（変数で切り替えられるように）
+		index := step.Index
+		if step.Value != "" {
+			if index, err = strconv.Atoi(step.Value); err != nil {
+				return fmt.Errorf("ラジオボタン %s の値 '%s' は数値ではありません", step.Selector, step.Value)
+			}
+		}
+		return clickRadioButtonByNameByValue(ctx, page, step.Selector, index)
+	case actionEvaluate:
+		value, err := page.Evaluate(step.Script, nil)
+		if err != nil {
+			return fmt.Errorf("JavaScriptの実行中にエラーが発生しました: %w", err)
+		}
+		if step.Var != "" {
+			r.result.Vars[step.Var] = fmt.Sprint(value)
+		}
+	case actionWait:
+		if step.Selector != "" {
+			if step.By == selectByName {
+				return waitForSelectorWithName(ctx, page, step.Selector, timeouts...)
+			}
+			return waitForSelector(ctx, page, step.Selector, timeouts...)
+		}
+		d, err := scenarioMillis(step.Duration)
+		if err != nil {
+			return err
+		}
+		r.job.Logf("%s待機します。", d)
+		return sleepContext(ctx, d)
+	case actionAcceptDialogs:
+		page.On("dialog", func(dialog playwright.Dialog) {
+			r.job.Logf("%sダイアログを受け入れます: %s", dialog.Type(), dialog.Message())
+			if dialog.Type() == "prompt" {
+				dialog.Accept("これはプロンプトの応答です")
+				return
+			}
+			dialog.Accept()
+		})
+	case actionScreenshot:
+		return takeScreenshot(r.job, page, step.Save)
+	case actionExpectPopup:
+		popup, err := page.ExpectPopup(func() error {
+			return r.runSteps(ctx, page, step.Trigger)
+		})
+		if err != nil {
+			return fmt.Errorf("新しいウィンドウの取得に失敗しました: %w", err)
+		}
+		r.job.Logf("新しいウィンドウを捕捉しました: %s", popup.URL())
+		return r.runSteps(ctx, popup, step.Steps)
+	case actionExpectDownload:
+		var opts playwright.PageExpectDownloadOptions
+		if step.Timeout != "" {
+			opts.Timeout = playwright.Float(float64(timeout / time.Millisecond))
+		}
+		download, err := page.ExpectDownload(func() error {
+			return r.runSteps(ctx, page, step.Trigger)
+		}, opts)
+		if err != nil {
+			return fmt.Errorf("ダウンロードの待機中にエラーが発生しました: %w", err)
+		}
+		r.job.Logf("ダウンロードが完了しました: %s", download.URL())
+		downloadPath, err := r.job.ArtifactPath(artifactDownloads, step.Save)
+		if err != nil {
+			return err
+		}
+		if err := download.SaveAs(downloadPath); err != nil {
+			return fmt.Errorf("ダウンロードファイルの保存に失敗しました: %w", err)
+		}
+		r.job.Logf("ダウンロードファイルを '%s' に保存しました。", downloadPath)
+		r.result.Downloads = append(r.result.Downloads, downloadPath)
+		if step.Var != "" {
+			r.result.Vars[step.Var] = downloadPath
+		}
+	case actionExtractTable:
+		return r.extractTable(page, step)
+	}
+	return nil
+}
+
+// extractTable は表のセルのテキストを取得して Tables に保存します
+func (r *scenarioRunner) extractTable(page playwright.Page, step ScenarioStep) error {
+	rowsSelector, cellsSelector := step.Rows, step.Cells
+	if rowsSelector == "" {
+		rowsSelector = "tr"
+	}
+	if cellsSelector == "" {
+		cellsSelector = "td"
+	}
+	var ignore []string
+	if step.Ignore != "" {
+		ignore = strings.Split(step.Ignore, ",")
+	}
+	rows, err := page.Locator(rowsSelector).All()
+	if err != nil {
+		return fmt.Errorf("テーブル行の取得に失敗しました: %w", err)
+	}
+	r.job.Logf("テーブル行の数: %d", len(rows))
+	table := make([][]string, 0, len(rows))
+	for i, row := range rows {
+		cells, err := row.Locator(cellsSelector).All()
+		if err != nil {
+			r.job.Logf("テーブル行 %d のセルの取得に失敗しました: %v", i, err)
+			continue
+		}
+		values := make([]string, 0, len(cells))
+		for j, cell := range cells {
+			text, err := cell.InnerText()
+			if err != nil {
+				r.job.Logf("テーブル行 %d のセル %d の内容の取得に失敗しました: %v", i, j, err)
+			}
+			values = append(values, text)
+			if step.Column != nil && j == *step.Column && !inArray(text, ignore) {
+				r.job.Logf("テーブル行 %d のセル %d の内容: %s", i, j, text)
+			}
+		}
+		table = append(table, values)
+	}
+	r.result.Tables[step.Var] = table
+	return nil
+}
+
+// expand はステップの文字列の項目の ${変数名} を置き換えます
+func (r *scenarioRunner) expand(step ScenarioStep) (ScenarioStep, error) {
+	var err error
+	replace := func(s string) string {
+		return scenarioVarPattern.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[2 : len(m)-1]
+			v, ok := r.result.Vars[name]
+			if !ok && err == nil {
+				err = fmt.Errorf("シナリオの変数 '%s' が定義されていません", name)
+			}
+			return v
+		})
+	}
+	for _, field := range []*string{
+		&step.Step, &step.Selector, &step.Value, &step.URL, &step.Script, &step.Timeout, &step.Duration,
+		&step.Save, &step.Rows, &step.Cells, &step.Ignore, &step.IfExists, &step.IfValue, &step.IfContent,
+		&step.IfSet, &step.IfEmpty,
+	} {
+		*field = replace(*field)
+	}
+	// trigger と steps は実行時に展開する（evaluate で保存した変数を使えるように）
+	return step, err
+}
+
+// scenarioMillis はミリ秒の文字列を time.Duration に変換します（"10s" のような指定も使えます）
+func scenarioMillis(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.Atoi(s); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("待機時間 '%s' が不正です", s)
+	}
+	return d, nil
+}
+
+// scenarioVars は設定の構造体をYAMLのキーでシナリオの変数にします
+// 例: TheEarthConfig の Selectors.Csv → selectors.csv
+func scenarioVars(v any) map[string]string {
+	vars := make(map[string]string)
+	flattenScenarioVars(reflect.ValueOf(v), "", vars)
+	return vars
+}
+
+func flattenScenarioVars(v reflect.Value, prefix string, vars map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Struct:
+			flattenScenarioVars(fv, prefix+key+".", vars)
+		case reflect.Slice:
+			parts := make([]string, fv.Len())
+			for j := range parts {
+				parts[j] = fmt.Sprint(fv.Index(j).Interface())
+			}
+			vars[prefix+key] = strings.Join(parts, ",")
+		default:
+			vars[prefix+key] = fmt.Sprint(fv.Interface())
+		}
+	}
+}
+
+// setScenarioDateVars は日付を name.yyyy / name.yy / name.mm / name.dd の変数にします
+func setScenarioDateVars(vars map[string]string, name string, t time.Time) {
+	vars[name+".yyyy"] = fmt.Sprintf("%04d", t.Year())
+	vars[name+".yy"] = fmt.Sprintf("%02d", t.Year()%100)
+	vars[name+".mm"] = fmt.Sprintf("%02d", int(t.Month()))
+	vars[name+".dd"] = fmt.Sprintf("%02d", t.Day())
+}
+
+// errNoScenarioDownload はシナリオでファイルがダウンロードされなかった場合のエラーです
+var errNoScenarioDownload = errors.New("シナリオでファイルがダウンロードされませんでした")
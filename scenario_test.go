@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePage はシナリオの実行で呼ばれた操作を記録する playwright.Page です
+// 使わないメソッドは埋め込んだインターフェース（nil）のままにしています
+type fakePage struct {
+	playwright.Page
+	calls    []string
+	elements map[string]int // セレクターごとの要素数（未登録は1）
+	values   map[string]string
+	content  string
+	failures map[string]error // "click #foo" のような操作を失敗させる
+	popup    *fakePage
+}
+
+func newFakePage() *fakePage {
+	return &fakePage{elements: map[string]int{}, values: map[string]string{}, failures: map[string]error{}}
+}
+
+func (p *fakePage) record(call string) error {
+	p.calls = append(p.calls, call)
+	return p.failures[call]
+}
+
+func (p *fakePage) Goto(url string, options ...playwright.PageGotoOptions) (playwright.Response, error) {
+	return nil, p.record("goto " + url)
+}
+
+func (p *fakePage) Title() (string, error) { return "fake", nil }
+
+func (p *fakePage) URL() string { return "http://fake/" }
+
+func (p *fakePage) Content() (string, error) { return p.content, nil }
+
+func (p *fakePage) Evaluate(expression string, arg ...interface{}) (interface{}, error) {
+	return "result:" + expression, p.record("evaluate " + expression)
+}
+
+func (p *fakePage) On(event string, handler interface{}) { p.record("on " + event) }
+
+func (p *fakePage) Locator(selector string, options ...playwright.PageLocatorOptions) playwright.Locator {
+	return &fakeLocator{page: p, selector: selector}
+}
+
+func (p *fakePage) ExpectPopup(cb func() error, options ...playwright.PageExpectPopupOptions) (playwright.Page, error) {
+	if err := cb(); err != nil {
+		return nil, err
+	}
+	return p.popup, nil
+}
+
+func (p *fakePage) ExpectDownload(cb func() error, options ...playwright.PageExpectDownloadOptions) (playwright.Download, error) {
+	if err := cb(); err != nil {
+		return nil, err
+	}
+	return &fakeDownload{}, nil
+}
+
+func (p *fakePage) Screenshot(options ...playwright.PageScreenshotOptions) ([]byte, error) {
+	return nil, p.record("screenshot " + filepath.Base(*options[0].Path))
+}
+
+// playwrightLocator は Locator メソッドと名前が衝突しないように埋め込むための別名です
+type playwrightLocator = playwright.Locator
+
+type fakeLocator struct {
+	playwrightLocator
+	page     *fakePage
+	selector string
+}
+
+func (l *fakeLocator) Click(options ...playwright.LocatorClickOptions) error {
+	return l.page.record("click " + l.selector)
+}
+
+func (l *fakeLocator) Fill(value string, options ...playwright.LocatorFillOptions) error {
+	return l.page.record("fill " + l.selector + "=" + value)
+}
+
+func (l *fakeLocator) WaitFor(options ...playwright.LocatorWaitForOptions) error {
+	return l.page.record("wait " + l.selector)
+}
+
+func (l *fakeLocator) SelectOption(values playwright.SelectOptionValues, options ...playwright.LocatorSelectOptionOptions) ([]string, error) {
+	return *values.Values, l.page.record("select " + l.selector + "=" + (*values.Values)[0])
+}
+
+func (l *fakeLocator) Count() (int, error) {
+	if n, ok := l.page.elements[l.selector]; ok {
+		return n, nil
+	}
+	return 1, nil
+}
+
+func (l *fakeLocator) Evaluate(expression string, arg interface{}, options ...playwright.LocatorEvaluateOptions) (interface{}, error) {
+	return l.page.values[l.selector], nil
+}
+
+func (l *fakeLocator) All() ([]playwright.Locator, error) {
+	var rows []playwright.Locator
+	for i := 0; i < l.page.elements[l.selector]; i++ {
+		rows = append(rows, &fakeLocator{page: l.page, selector: fmt.Sprintf("%s[%d]", l.selector, i)})
+	}
+	return rows, nil
+}
+
+func (l *fakeLocator) Locator(selectorOrLocator interface{}, options ...playwright.LocatorLocatorOptions) playwright.Locator {
+	return &fakeLocator{page: l.page, selector: l.selector + " " + selectorOrLocator.(string)}
+}
+
+func (l *fakeLocator) InnerText(options ...playwright.LocatorInnerTextOptions) (string, error) {
+	return l.page.values[l.selector], nil
+}
+
+type fakeDownload struct {
+	playwright.Download
+}
+
+func (d *fakeDownload) URL() string { return "http://fake/download" }
+
+func (d *fakeDownload) SaveAs(path string) error {
+	return os.WriteFile(path, []byte("csv"), 0644)
+}
+
+func TestParseScenarioValidation(t *testing.T) {
+	_, err := ParseScenario([]byte("name: empty\nsteps: []\n"))
+	assert.ErrorContains(t, err, "ステップがありません")
+
+	_, err = ParseScenario([]byte("name: bad\nsteps:\n  - action: dance\n"))
+	assert.ErrorContains(t, err, "steps[0] (dance): 不明なアクションです")
+
+	_, err = ParseScenario([]byte("name: bad\nsteps:\n  - action: expect_download\n    save: a.zip\n    trigger:\n      - action: click\n"))
+	assert.ErrorContains(t, err, "steps[0] (expect_download).trigger[0] (click): selector が指定されていません")
+
+	_, err = ParseScenario([]byte("name: bad\nsteps:\n  - {action: click, selector: a, by: xpath}\n"))
+	assert.ErrorContains(t, err, "by 'xpath' は不正です")
+}
+
+func TestRunScenario(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+name: test
+steps:
+  - {action: goto, url: "${loginUrl}"}
+  - {action: fill, selector: "#user", value: "${user}"}
+  - {action: fill, by: name, selector: pass, value: "${pass}"}
+  - {action: select, by: name, selector: fromYYYY, value: "${from.yyyy}"}
+  - {action: click, selector: "#missing", optional: true}
+  - {action: click, ifExists: "#popup", selector: "#popup"}
+  - {action: evaluate, ifContent: "menu", script: "goMenu()", var: menu}
+  - {action: evaluate, ifContent: "nothing", script: "never()"}
+  - {action: wait, duration: "1"}
+  - action: expect_download
+    save: ${user}.csv
+    var: csvPath
+    trigger:
+      - {action: click, by: value, selector: "CSV"}
+`))
+	assert.Nil(t, err)
+
+	page := newFakePage()
+	page.content = "<a>menu</a>"
+	page.elements["#popup"] = 0
+	page.failures["click #missing"] = errors.New("not found")
+
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeEtcMeisai, "")
+	vars := map[string]string{"loginUrl": "http://fake/login", "user": "taro", "pass": "secret"}
+	setScenarioDateVars(vars, "from", time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local))
+
+	result, err := RunScenario(context.Background(), job, page, sc, vars)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"goto http://fake/login",
+		"fill #user=taro",
+		"fill [name='pass']=secret",
+		"select [name='fromYYYY']=2026",
+		"click #missing",
+		"evaluate goMenu()",
+		"click input[value='CSV'][type='button']",
+	}, page.calls)
+	assert.Equal(t, "result:goMenu()", result.Vars["menu"])
+	assert.Equal(t, []string{filepath.Join(job.Dir(), artifactDownloads, "taro.csv")}, result.Downloads)
+	assert.Equal(t, result.Downloads[0], result.Vars["csvPath"])
+	assert.FileExists(t, result.Downloads[0])
+}
+
+func TestRunScenarioErrors(t *testing.T) {
+	sc, err := ParseScenario([]byte("name: test\nsteps:\n  - {action: click, selector: \"${undefined}\"}\n"))
+	assert.Nil(t, err)
+	_, err = RunScenario(context.Background(), nil, newFakePage(), sc, nil)
+	assert.ErrorContains(t, err, "シナリオの変数 'undefined' が定義されていません")
+
+	sc, err = ParseScenario([]byte("name: test\nsteps:\n  - {action: click, selector: \"#login\"}\n  - {action: click, selector: \"#next\"}\n"))
+	assert.Nil(t, err)
+	page := newFakePage()
+	page.failures["click #login"] = errors.New("timeout")
+	_, err = RunScenario(context.Background(), nil, page, sc, nil)
+	assert.ErrorContains(t, err, "シナリオのステップ 'click' に失敗しました: timeout")
+	assert.Equal(t, []string{"click #login"}, page.calls)
+
+	// キャンセルされた場合は何も実行しない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	page = newFakePage()
+	_, err = RunScenario(ctx, nil, page, sc, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, page.calls)
+}
+
+func TestRunScenarioPopupTable(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+name: popup
+steps:
+  - action: expect_popup
+    ifExists: "#popup"
+    ifValue: 接続ユーザー確認
+    trigger:
+      - {action: click, selector: "#popup"}
+    steps:
+      - {action: extract_table, rows: tr, cells: td, column: 1, ignore: "auto1,auto2", var: users}
+`))
+	assert.Nil(t, err)
+
+	page := newFakePage()
+	page.popup = newFakePage()
+	page.popup.elements["tr"] = 2
+	page.popup.elements["tr[0] td"] = 2
+	page.popup.elements["tr[1] td"] = 2
+	page.popup.values["tr[0] td[1]"] = "auto1"
+	page.popup.values["tr[1] td[1]"] = "yamada"
+
+	// ポップアップのボタンの値が違う場合は実行しない
+	page.values["#popup"] = "お知らせ"
+	result, err := RunScenario(context.Background(), nil, page, sc, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, page.calls)
+	assert.Empty(t, result.Tables)
+
+	page.values["#popup"] = "接続ユーザー確認"
+	result, err = RunScenario(context.Background(), nil, page, sc, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"click #popup"}, page.calls)
+	assert.Equal(t, [][]string{{"", "auto1"}, {"", "yamada"}}, result.Tables["users"])
+}
+
+// collectScenarioVars はシナリオで参照している変数名を集めます
+func collectScenarioVars(steps []ScenarioStep, names map[string]bool) {
+	for _, step := range steps {
+		for _, s := range []string{step.Step, step.Selector, step.Value, step.URL, step.Script, step.Timeout,
+			step.Duration, step.Save, step.Rows, step.Cells, step.Ignore, step.IfExists, step.IfValue, step.IfContent} {
+			for _, m := range scenarioVarPattern.FindAllStringSubmatch(s, -1) {
+				names[m[1]] = true
+			}
+		}
+		collectScenarioVars(step.Trigger, names)
+		collectScenarioVars(step.Steps, names)
+	}
+}
+
+func TestBuiltinScenariosUseDefinedVars(t *testing.T) {
+	dates := map[string]string{}
+	setScenarioDateVars(dates, "from", time.Now())
+	setScenarioDateVars(dates, "to", time.Now())
+
+	cases := map[string]map[string]string{
+		"theearth.yaml":   scenarioVars(DefaultConfig().TheEarth),
+		"etc-meisai.yaml": scenarioVars(DefaultConfig().EtcMeisai),
+	}
+	credentials := map[string][]string{
+		"theearth.yaml":   {"txtID1", "txtID2", "txtPass"},
+		"etc-meisai.yaml": {"risLoginId", "risPassword"},
+	}
+	for name, vars := range cases {
+		sc, err := LoadScenario("", name)
+		assert.Nil(t, err, name)
+		for k, v := range dates {
+			vars[k] = v
+		}
+		for _, k := range credentials[name] {
+			vars[k] = "x"
+		}
+		names := map[string]bool{}
+		for _, phase := range sc.phases() {
+			collectScenarioVars(phase.steps, names)
+		}
+		for n := range names {
+			_, ok := vars[n]
+			assert.True(t, ok, "%s: variable %s is not defined", name, n)
+		}
+		downloads := 0
+		for _, step := range sc.Download {
+			if step.Action == actionExpectDownload {
+				downloads++
+			}
+		}
+		assert.Equal(t, 1, downloads, name)
+	}
+}
+
+func TestScenarioVars(t *testing.T) {
+	vars := scenarioVars(DefaultConfig().TheEarth)
+	assert.Equal(t, "#btnCsv", vars["selectors.csv"])
+	assert.Equal(t, "60000", vars["timeouts.download"])
+	assert.Equal(t, "auto2,auto1,auto3,autoload", vars["ignoredUsers"])
+	assert.True(t, strings.HasPrefix(vars["loginUrl"], "http://theearth-np.com/"))
+
+	d, err := scenarioMillis("1500")
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, d)
+	d, err = scenarioMillis("2s")
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, d)
+	_, err = scenarioMillis("soon")
+	assert.ErrorContains(t, err, "待機時間 'soon' が不正です")
+}
+
+func TestRunScenarioVarConditions(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+name: conditions
+steps:
+  - {action: check_radio, selector: kbn, value: "${sokoKbn}"}
+  - {action: evaluate, ifEmpty: "${cards}", script: "selectAll()"}
+  - {action: evaluate, ifSet: "${cards}", script: "select('${cards}')"}
+`))
+	assert.Nil(t, err)
+	store := NewJobStore(t.TempDir())
+
+	page := newFakePage()
+	_, err = RunScenario(context.Background(), store.New(jobTypeEtcMeisai, ""), page, sc, map[string]string{"sokoKbn": "1", "cards": ""})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"wait input[name='kbn'][value='1']", "click input[name='kbn'][value='1']", "evaluate selectAll()"}, page.calls)
+
+	page = newFakePage()
+	_, err = RunScenario(context.Background(), store.New(jobTypeEtcMeisai, ""), page, sc, map[string]string{"sokoKbn": "0", "cards": "1234,5678"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"wait input[name='kbn'][value='0']", "click input[name='kbn'][value='0']", "evaluate select('1234,5678')"}, page.calls)
+
+	_, err = RunScenario(context.Background(), store.New(jobTypeEtcMeisai, ""), newFakePage(), sc, map[string]string{"sokoKbn": "x", "cards": ""})
+	assert.ErrorContains(t, err, "ラジオボタン kbn の値 'x' は数値ではありません")
+}
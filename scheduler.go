@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleDef はスケジュール定義ファイルの1件分です
+type ScheduleDef struct {
+	Name    string       `json:"name"`
+	Cron    string       `json:"cron"`    // cron式（例: "0 6 * * *"、"@daily"）
+	Type    string       `json:"type"`    // GeneralCsv / etc-meisai
+	Account string       `json:"account"` // accounts のキー、またはエイリアスで登録したアカウント
+	ResUrl  string       `json:"resUrl"`
+	Mode    string       `json:"mode,omitempty"`  // incremental の場合は前回の同期日からの期間（省略時はサイトの既定の期間）
+	Sinks   []SinkConfig `json:"sinks,omitempty"` // resUrl 以外の送信先
+	// CallbackUrl はジョブの終了時に結果を送信するURLです
+	CallbackUrl string `json:"callbackUrl,omitempty"`
+}
+
+// ScheduleAccount はスケジュールから参照するアカウントのログイン情報です
+// GeneralCsv では txtID1/txtID2/txtPass、etc-meisai では risLoginId/risPassword を使います
+type ScheduleAccount struct {
+	TxtID1      string `json:"txtID1,omitempty"`
+	TxtID2      string `json:"txtID2,omitempty"`
+	TxtPass     string `json:"txtPass,omitempty"`
+	RisLoginId  string `json:"risLoginId,omitempty"`
+	RisPassword string `json:"risPassword,omitempty"`
+}
+
+// ScheduleFile はスケジュール定義ファイルの形式です
+type ScheduleFile struct {
+	Schedules []ScheduleDef              `json:"schedules"`
+	Accounts  map[string]ScheduleAccount `json:"accounts"`
+}
+
+// ScheduleStatus は GET /schedules で返すスケジュールの状態です
+type ScheduleStatus struct {
+	Name        string     `json:"name"`
+	Cron        string     `json:"cron"`
+	Type        string     `json:"type"`
+	Account     string     `json:"account"`
+	ResUrl      string     `json:"resUrl,omitempty"`
+	Mode        string     `json:"mode,omitempty"`
+	NextRun     *time.Time `json:"nextRun,omitempty"`
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	LastJobID   string     `json:"lastJobId,omitempty"`
+	LastSkipped bool       `json:"lastSkipped"` // 前回の実行が同じアカウントの実行中ジョブのためにスキップされたか
+}
+
+type scheduleEntry struct {
+	def         ScheduleDef
+	id          cron.EntryID
+	lastRun     *time.Time
+	lastJobID   string
+	lastSkipped bool
+}
+
+// Scheduler はスケジュール定義に従って HTTP ハンドラーと同じ処理でジョブを開始します
+type Scheduler struct {
+	cron     *cron.Cron
+	accounts map[string]ScheduleAccount
+	mu       sync.Mutex
+	entries  []*scheduleEntry
+	// trigger はスケジュールに対応するジョブを開始します（テストで差し替えられるようにしています）
+	trigger func(def ScheduleDef, account ScheduleAccount) *Job
+	// active は同じ種類・アカウントのジョブが実行中かどうかを返します
+	active func(jobType string, account string) bool
+}
+
+// scheduler はサーバー起動時に作成するスケジューラーです（定義ファイルがない場合は nil）
+var scheduler *Scheduler
+
+// NewScheduler はスケジュール定義を検証してスケジューラーを作成します
+func NewScheduler(file ScheduleFile) (*Scheduler, error) {
+	s := &Scheduler{
+		cron:     cron.New(),
+		accounts: file.Accounts,
+		trigger:  startScheduledJob,
+		active:   jobs.Active,
+	}
+	for i, def := range file.Schedules {
+		if def.Name == "" {
+			def.Name = fmt.Sprintf("schedule-%d", i+1)
+		}
+		if def.Type != jobTypeGeneralCsv && def.Type != jobTypeEtcMeisai {
+			return nil, fmt.Errorf("スケジュール '%s' の type '%s' は不正です（GeneralCsv または etc-meisai）", def.Name, def.Type)
+		}
+		if err := validateMode(def.Mode); err != nil {
+			return nil, fmt.Errorf("スケジュール '%s' の %w", def.Name, err)
+		}
+		if _, err := resolveSinks(def.ResUrl, def.Sinks); err != nil {
+			return nil, fmt.Errorf("スケジュール '%s' の送信先が不正です: %w", def.Name, err)
+		}
+		if err := validateCallbackURL(def.CallbackUrl); err != nil {
+			return nil, fmt.Errorf("スケジュール '%s' の %w", def.Name, err)
+		}
+		if _, err := s.account(def); err != nil {
+			return nil, fmt.Errorf("スケジュール '%s' のアカウント '%s' が accounts に定義されていません: %w", def.Name, def.Account, err)
+		}
+		entry := &scheduleEntry{def: def}
+		id, err := s.cron.AddFunc(def.Cron, func() { s.run(entry) })
+		if err != nil {
+			return nil, fmt.Errorf("スケジュール '%s' のcron式 '%s' が不正です: %w", def.Name, def.Cron, err)
+		}
+		entry.id = id
+		s.entries = append(s.entries, entry)
+	}
+	return s, nil
+}
+
+// LoadScheduleFile はスケジュール定義ファイルを読み込みます
+func LoadScheduleFile(path string) (ScheduleFile, error) {
+	var file ScheduleFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("スケジュール定義ファイル '%s' の読み込みに失敗しました: %w", path, err)
+	}
+	return file, nil
+}
+
+// Start はスケジューラーを開始します
+func (s *Scheduler) Start() {
+	s.cron.Start()
+	log.Printf("スケジューラーを開始しました（%d 件）", len(s.entries))
+}
+
+// Stop はスケジューラーを停止します。実行中のジョブは停止しません
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// run はスケジュールの実行時刻に呼び出されます
+// 同じアカウントの前回のジョブがまだ実行中の場合はスキップします
+func (s *Scheduler) run(entry *scheduleEntry) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.lastRun = &now
+	if s.active(entry.def.Type, entry.def.Account) {
+		log.Printf("スケジュール '%s': アカウント '%s' の前回のジョブが実行中のためスキップします。", entry.def.Name, entry.def.Account)
+		entry.lastSkipped = true
+		return
+	}
+	account, err := s.account(entry.def)
+	if err != nil {
+		log.Printf("スケジュール '%s': アカウント '%s' のログイン情報を取得できないためスキップします: %v", entry.def.Name, entry.def.Account, err)
+		entry.lastSkipped = true
+		return
+	}
+	job := s.trigger(entry.def, account)
+	entry.lastJobID = job.Info().ID
+	entry.lastSkipped = false
+	log.Printf("スケジュール '%s': ジョブ %s を開始しました。", entry.def.Name, entry.lastJobID)
+}
+
+// account はスケジュールのアカウントのログイン情報を返します
+// accounts に定義がない場合はエイリアスで登録したアカウントを使います
+func (s *Scheduler) account(def ScheduleDef) (ScheduleAccount, error) {
+	if account, ok := s.accounts[def.Account]; ok {
+		return account, nil
+	}
+	c, err := resolveCredential(def.Account, def.Type)
+	if err != nil {
+		return ScheduleAccount{}, err
+	}
+	return ScheduleAccount{
+		TxtID1:      c.TxtID1,
+		TxtID2:      c.TxtID2,
+		TxtPass:     c.TxtPass,
+		RisLoginId:  c.RisLoginId,
+		RisPassword: c.RisPassword,
+	}, nil
+}
+
+// Statuses は全スケジュールの次回・前回の実行時刻を返します
+func (s *Scheduler) Statuses() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]ScheduleStatus, 0, len(s.entries))
+	for _, entry := range s.entries {
+		status := ScheduleStatus{
+			Name:        entry.def.Name,
+			Cron:        entry.def.Cron,
+			Type:        entry.def.Type,
+			Account:     entry.def.Account,
+			ResUrl:      entry.def.ResUrl,
+			Mode:        entry.def.Mode,
+			LastRun:     entry.lastRun,
+			LastJobID:   entry.lastJobID,
+			LastSkipped: entry.lastSkipped,
+		}
+		if next := s.cron.Entry(entry.id).Next; !next.IsZero() {
+			status.NextRun = &next
+		} else if sched := s.cron.Entry(entry.id).Schedule; sched != nil {
+			// 開始前は cron がまだ次回時刻を計算していないため、ここで計算する
+			next := sched.Next(time.Now())
+			status.NextRun = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// startScheduledJob はスケジュールの種類に応じて /GeneralCsv または /etc-meisai と同じ処理を開始します
+func startScheduledJob(def ScheduleDef, account ScheduleAccount) *Job {
+	if def.Type == jobTypeEtcMeisai {
+		return startEtcMeisaiJob(def.Account, requestData{
+			Data:        []etcAccount{{RisLoginId: account.RisLoginId, RisPassword: account.RisPassword}},
+			ResUrl:      def.ResUrl,
+			Mode:        def.Mode,
+			Sinks:       def.Sinks,
+			CallbackUrl: def.CallbackUrl,
+		})
+	}
+	sinks, _ := resolveSinks(def.ResUrl, def.Sinks) // NewScheduler で検証済み
+	return startGeneralCsvJob(def.Account, account.TxtID2, account.TxtID1, account.TxtPass, sinks, exportRange{Incremental: def.Mode == modeIncremental}, def.CallbackUrl)
+}
+
+// initScheduler はスケジュール定義ファイルがあればスケジューラーを開始します
+func initScheduler() error {
+	path := cfg.Jobs.SchedulesFile
+	file, err := LoadScheduleFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("スケジュール定義ファイル '%s' がないため、スケジューラーは起動しません。", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s, err := NewScheduler(file)
+	if err != nil {
+		return err
+	}
+	scheduler = s
+	scheduler.Start()
+	return nil
+}
+
+// handleSchedules は GET /schedules のハンドラーです
+func handleSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	statuses := []ScheduleStatus{}
+	if scheduler != nil {
+		statuses = scheduler.Statuses()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
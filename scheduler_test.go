@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testScheduleFile() ScheduleFile {
+	return ScheduleFile{
+		Schedules: []ScheduleDef{
+			{Name: "tacho-daily", Cron: "0 6 * * *", Type: jobTypeGeneralCsv, Account: "honsha", ResUrl: "http://example.com/upload"},
+			{Name: "etc-monthly", Cron: "@monthly", Type: jobTypeEtcMeisai, Account: "etc-honsha"},
+		},
+		Accounts: map[string]ScheduleAccount{
+			"honsha":     {TxtID1: "user", TxtID2: "company", TxtPass: "pass"},
+			"etc-honsha": {RisLoginId: "ris", RisPassword: "pass"},
+		},
+	}
+}
+
+func TestNewSchedulerValidation(t *testing.T) {
+	_, err := NewScheduler(testScheduleFile())
+	assert.Nil(t, err)
+
+	file := testScheduleFile()
+	file.Schedules[0].Cron = "every day"
+	_, err = NewScheduler(file)
+	assert.ErrorContains(t, err, "cron式 'every day' が不正です")
+
+	file = testScheduleFile()
+	file.Schedules[0].Type = "unknown"
+	_, err = NewScheduler(file)
+	assert.ErrorContains(t, err, "type 'unknown' は不正です")
+
+	file = testScheduleFile()
+	file.Schedules[0].Account = "missing"
+	_, err = NewScheduler(file)
+	assert.ErrorContains(t, err, "アカウント 'missing' が accounts に定義されていません")
+
+	file = testScheduleFile()
+	file.Schedules[0].Mode = "full"
+	_, err = NewScheduler(file)
+	assert.ErrorContains(t, err, "スケジュール 'tacho-daily' の mode 'full' は不正です")
+	file.Schedules[0].Mode = modeIncremental
+	_, err = NewScheduler(file)
+	assert.Nil(t, err)
+}
+
+func TestSchedulerRunSkipsActiveAccount(t *testing.T) {
+	s, err := NewScheduler(testScheduleFile())
+	assert.Nil(t, err)
+
+	store := NewJobStore(t.TempDir())
+	s.active = store.Active
+	release := make(chan struct{})
+	var triggered []ScheduleAccount
+	var started []*Job
+	s.trigger = func(def ScheduleDef, account ScheduleAccount) *Job {
+		triggered = append(triggered, account)
+		job := store.Start(def.Type, def.Account, func(ctx context.Context, job *Job) error {
+			<-release
+			return nil
+		})
+		started = append(started, job)
+		return job
+	}
+
+	entry := s.entries[0]
+	s.run(entry)
+	assert.Len(t, triggered, 1)
+	assert.Equal(t, "company", triggered[0].TxtID2)
+	assert.False(t, entry.lastSkipped)
+	firstJobID := entry.lastJobID
+	assert.NotEmpty(t, firstJobID)
+
+	// 前回のジョブが実行中の間はスキップされる
+	s.run(entry)
+	assert.Len(t, triggered, 1)
+	assert.True(t, entry.lastSkipped)
+	assert.Equal(t, firstJobID, entry.lastJobID)
+
+	// 別のアカウントのスケジュールは影響を受けない
+	s.run(s.entries[1])
+	assert.Len(t, triggered, 2)
+
+	close(release)
+	job, _ := store.Get(firstJobID)
+	waitForJob(t, job)
+	s.run(entry)
+	assert.Len(t, triggered, 3)
+	assert.False(t, entry.lastSkipped)
+
+	// 作業ディレクトリを削除する前に全てのジョブの終了を待つ
+	for _, job := range started {
+		waitForJob(t, job)
+	}
+}
+
+func TestSchedulerStatuses(t *testing.T) {
+	s, err := NewScheduler(testScheduleFile())
+	assert.Nil(t, err)
+	statuses := s.Statuses()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "tacho-daily", statuses[0].Name)
+	assert.NotNil(t, statuses[0].NextRun)
+	assert.Equal(t, 6, statuses[0].NextRun.Hour())
+	assert.Nil(t, statuses[0].LastRun)
+
+	// パスワードなどのログイン情報は返さない
+	data, err := json.Marshal(statuses)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "pass")
+}
+
+func TestLoadScheduleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	data, _ := json.Marshal(testScheduleFile())
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+
+	file, err := LoadScheduleFile(path)
+	assert.Nil(t, err)
+	assert.Len(t, file.Schedules, 2)
+	assert.Equal(t, "ris", file.Accounts["etc-honsha"].RisLoginId)
+
+	_, err = LoadScheduleFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestHandleSchedules(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleSchedules(rec, httptest.NewRequest(http.MethodPost, "/schedules", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handleSchedules(rec, httptest.NewRequest(http.MethodGet, "/schedules", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
+
+func TestSchedulerUsesRegisteredAccount(t *testing.T) {
+	store := useTestCredentials(t)
+	_, err := store.Create(Credential{Alias: "etc-shiten", Site: jobTypeEtcMeisai, RisLoginId: "ris-shiten", RisPassword: "pass"})
+	assert.Nil(t, err)
+
+	file := testScheduleFile()
+	file.Schedules = append(file.Schedules, ScheduleDef{Name: "etc-shiten", Cron: "@monthly", Type: jobTypeEtcMeisai, Account: "etc-shiten"})
+	s, err := NewScheduler(file)
+	assert.Nil(t, err)
+
+	account, err := s.account(s.entries[2].def)
+	assert.Nil(t, err)
+	assert.Equal(t, "ris-shiten", account.RisLoginId)
+
+	// 登録済みのアカウントでもサイトが違えばエラーにする
+	file.Schedules[2].Type = jobTypeGeneralCsv
+	_, err = NewScheduler(file)
+	assert.ErrorContains(t, err, "etc-meisai 用です")
+}
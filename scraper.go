@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// rangeDateLayout は期間（from / to）の日付の形式です
+const rangeDateLayout = "2006-01-02"
+
+// ScrapeSession は1回のスクレイピングで各段階が共有する状態です
+type ScrapeSession struct {
+	Job    *Job
+	Page   playwright.Page
+	Params map[string]string // ログイン情報（txtID1 や risLoginId など、サイトごとのキー）
+}
+
+// Scraper はサイトごとのスクレイピング処理です
+// runSite が Login → Navigate → SetRange → Download の順に呼び出し、ログインに成功した場合は最後に Logout を呼び出します
+type Scraper interface {
+	Login(ctx context.Context, s *ScrapeSession) error
+	Navigate(ctx context.Context, s *ScrapeSession) error
+	SetRange(ctx context.Context, s *ScrapeSession, from, to time.Time) error
+	// Download はダウンロードしたファイルのパスを返します
+	Download(ctx context.Context, s *ScrapeSession) ([]string, error)
+	Logout(ctx context.Context, s *ScrapeSession) error
+}
+
+// Site はレジストリに登録するサイトの情報です
+// 新しいサイトは site_<名前>.go を追加し、init で RegisterSite を呼び出します
+type Site struct {
+	Name        string   // /scrape/{site} で指定するサイト名
+	JobType     string   // ジョブの種類（アカウントの site と一致させる）
+	Credentials []string // 必須のログイン情報のキー
+	// DefaultRange は期間が指定されなかった場合の期間を返します
+	DefaultRange func(now time.Time) (from, to time.Time)
+	// Limits はサイトで指定できる期間の制限を返します（nil の場合は制限なし）
+	Limits func() RangeLimits
+	// Account はログイン情報から同期日を記録するアカウントの識別子を返します（nil の場合は Credentials の最初の項目）
+	Account func(params map[string]string) string
+	// Bundle を指定した場合は、ダウンロードしたファイルをこの名前の1つのzipにまとめます
+	Bundle string
+	// Inspect はダウンロードしたファイルを送信する前に確認します（nil の場合は確認しない）
+	// 確認で作成したファイル（レコードのJSONなど）を返すと、ダウンロードしたファイルと一緒に送信します
+	// エラーを返した場合はジョブを失敗にし、ファイルを送信しません
+	Inspect func(job *Job, files []string) ([]string, error)
+	// New は1回のスクレイピング用の Scraper を作成します
+	New func() (Scraper, error)
+}
+
+// RangeLimits はサイトで指定できる期間の制限です
+type RangeLimits struct {
+	MaxDays     int // 1回のダウンロードで指定できる最大の日数（超える期間は分割する。0で無制限）
+	MaxPastDays int // 何日前まで指定できるか（0で無制限）
+}
+
+// dateRange は1回のダウンロードで指定する期間です
+type dateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r dateRange) String() string {
+	return r.From.Format(rangeDateLayout) + " 〜 " + r.To.Format(rangeDateLayout)
+}
+
+// splitRange は from から to までの期間を maxDays 日ごとに分割します（maxDays が0以下の場合は分割しない）
+func splitRange(from, to time.Time, maxDays int) []dateRange {
+	if maxDays <= 0 {
+		return []dateRange{{From: from, To: to}}
+	}
+	var ranges []dateRange
+	for start := from; !startOfDay(start).After(startOfDay(to)); start = start.AddDate(0, 0, maxDays) {
+		end := start.AddDate(0, 0, maxDays-1)
+		if !startOfDay(end).Before(startOfDay(to)) {
+			end = to
+		}
+		ranges = append(ranges, dateRange{From: start, To: end})
+	}
+	return ranges
+}
+
+// startOfDay は t の日付の0時を返します
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+var (
+	sitesMu sync.RWMutex
+	sites   = map[string]*Site{}
+)
+
+// RegisterSite はサイトをレジストリに登録します。同じ名前のサイトを登録すると panic します
+func RegisterSite(site Site) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if _, ok := sites[site.Name]; ok {
+		panic(fmt.Sprintf("サイト '%s' は既に登録されています", site.Name))
+	}
+	sites[site.Name] = &site
+}
+
+// LookupSite は登録されているサイトを返します
+func LookupSite(name string) (*Site, bool) {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+	site, ok := sites[name]
+	return site, ok
+}
+
+// SiteNames は登録されているサイト名を名前順に返します
+func SiteNames() []string {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateParams は必須のログイン情報が揃っているかを確認します
+func (site *Site) validateParams(params map[string]string) error {
+	for _, key := range site.Credentials {
+		if params[key] == "" {
+			return fmt.Errorf("サイト '%s' のログイン情報 %s が空です", site.Name, key)
+		}
+	}
+	return nil
+}
+
+// account は同期日を記録するアカウントの識別子です
+func (site *Site) account(params map[string]string) string {
+	if site.Account != nil {
+		return site.Account(params)
+	}
+	if len(site.Credentials) == 0 {
+		return ""
+	}
+	return params[site.Credentials[0]]
+}
+
+// runSite はブラウザプールから BrowserContext を借りてサイトのスクレイピングを実行し、ダウンロードしたファイルのパスを返します
+// サイトの1回のダウンロードで指定できる日数を超える期間は分割してダウンロードし、site.Bundle が指定されていれば1つのzipにまとめます
+// site.Inspect が指定されていれば、ダウンロードしたファイルを確認し、確認で作成したファイルを加えて返します
+// 失敗した場合は Playwright のトレースをジョブの作業ディレクトリに保存します
+func runSite(ctx context.Context, job *Job, site *Site, params map[string]string, from, to time.Time) (files []string, err error) {
+	if err := site.validateParams(params); err != nil {
+		return nil, err
+	}
+	job.SetTarget(site.Name, from, to)
+	scraper, err := site.New()
+	if err != nil {
+		return nil, err
+	}
+
+	job.SetStep("ブラウザの準備")
+	lease, err := acquireBrowser(ctx)
+	if err != nil {
+		return nil, withCategory(errorBrowser, err)
+	}
+	defer lease.Release() // 処理終了時にBrowserContextを確実に閉じてブラウザを返却する
+
+	// BrowserContext を閉じる前にトレースを保存する
+	// ジョブがキャンセルされた場合はプールが BrowserContext を閉じる前に保存し、キャンセルした時点までの操作を残す
+	stopTrace := startTrace(job, lease.Context, traceName(site, params))
+	lease.BeforeClose(func() { stopTrace(ctx.Err()) })
+	defer func() { stopTrace(err) }()
+
+	page, err := lease.Context.NewPage()
+	if err != nil {
+		return nil, fmt.Errorf("ページの作成に失敗しました: %w", err)
+	}
+	files, err = runScraper(ctx, &ScrapeSession{Job: job, Page: page, Params: params}, scraper, site.splitRange(from, to))
+	if err != nil {
+		return nil, err
+	}
+	if site.Bundle != "" {
+		bundle, err := job.BundleDownloads(files, site.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		files = []string{bundle}
+	}
+	if site.Inspect != nil {
+		inspected, err := site.Inspect(job, files)
+		if err != nil {
+			return nil, withCategory(errorData, err)
+		}
+		files = append(files, inspected...)
+	}
+	return files, nil
+}
+
+// splitRange はサイトの1回のダウンロードで指定できる日数ごとに期間を分割します
+func (site *Site) splitRange(from, to time.Time) []dateRange {
+	var limits RangeLimits
+	if site.Limits != nil {
+		limits = site.Limits()
+	}
+	return splitRange(from, to, limits.MaxDays)
+}
+
+// runScraper は Scraper の各段階を順に実行します
+// 期間が複数ある場合は、ログインと画面の移動の後に期間の入力とダウンロードを期間ごとに繰り返します
+func runScraper(ctx context.Context, s *ScrapeSession, scraper Scraper, ranges []dateRange) ([]string, error) {
+	if err := scraper.Login(ctx, s); err != nil {
+		return nil, withCategory(errorLogin, fmt.Errorf("ログインに失敗しました: %w", err))
+	}
+	defer func() {
+		// ログアウトに失敗してもダウンロード結果には影響しないため、ログに出すだけにする
+		if err := scraper.Logout(ctx, s); err != nil {
+			s.Job.Logf("ログアウトに失敗しました: %v", err)
+		}
+	}()
+	if err := scraper.Navigate(ctx, s); err != nil {
+		return nil, withCategory(errorScrape, fmt.Errorf("画面の移動に失敗しました: %w", err))
+	}
+	if len(ranges) > 1 {
+		s.Job.Logf("期間を %d 回に分けてダウンロードします。", len(ranges))
+	}
+	var files []string
+	for _, r := range ranges {
+		s.Job.Logf("期間: %s", r)
+		if err := scraper.SetRange(ctx, s, r.From, r.To); err != nil {
+			return nil, withCategory(errorScrape, fmt.Errorf("期間の入力に失敗しました（%s）: %w", r, err))
+		}
+		downloaded, err := scraper.Download(ctx, s)
+		if err != nil {
+			return nil, withCategory(errorScrape, err)
+		}
+		if len(downloaded) == 0 {
+			return nil, withCategory(errorScrape, errNoScenarioDownload)
+		}
+		files = append(files, downloaded...)
+	}
+	return files, nil
+}
+
+// scenarioScraper はシナリオファイルの段階ごとの手順で Scraper を実装します
+type scenarioScraper struct {
+	scenario *Scenario
+	runner   *scenarioRunner
+}
+
+// newScenarioScraper はシナリオファイル（path が空の場合は組み込みの builtin）を読み込みます
+// config の項目はシナリオの変数（selectors.csv など）になります
+func newScenarioScraper(path string, builtin string, config any) (Scraper, error) {
+	scenario, err := LoadScenario(path, builtin)
+	if err != nil {
+		return nil, err
+	}
+	return &scenarioScraper{scenario: scenario, runner: newScenarioRunner(nil, scenarioVars(config))}, nil
+}
+
+func (sc *scenarioScraper) Login(ctx context.Context, s *ScrapeSession) error {
+	sc.runner.job = s.Job
+	for k, v := range s.Params {
+		sc.runner.result.Vars[k] = v
+	}
+	s.Job.Logf("シナリオ '%s' を実行します。", sc.scenario.Name)
+	if err := sc.runner.runSteps(ctx, s.Page, sc.scenario.Steps); err != nil {
+		return err
+	}
+	return sc.runner.runSteps(ctx, s.Page, sc.scenario.Login)
+}
+
+func (sc *scenarioScraper) Navigate(ctx context.Context, s *ScrapeSession) error {
+	return sc.runner.runSteps(ctx, s.Page, sc.scenario.Navigate)
+}
+
+func (sc *scenarioScraper) SetRange(ctx context.Context, s *ScrapeSession, from, to time.Time) error {
+	setScenarioDateVars(sc.runner.result.Vars, "from", from)
+	setScenarioDateVars(sc.runner.result.Vars, "to", to)
+	return sc.runner.runSteps(ctx, s.Page, sc.scenario.SetRange)
+}
+
+func (sc *scenarioScraper) Download(ctx context.Context, s *ScrapeSession) ([]string, error) {
+	before := len(sc.runner.result.Downloads)
+	if err := sc.runner.runSteps(ctx, s.Page, sc.scenario.Download); err != nil {
+		return nil, err
+	}
+	return sc.runner.result.Downloads[before:], nil
+}
+
+func (sc *scenarioScraper) Logout(ctx context.Context, s *ScrapeSession) error {
+	return sc.runner.runSteps(ctx, s.Page, sc.scenario.Logout)
+}
+
+// scrapeRequest は POST /scrape/{site} のリクエストです
+// alias を指定した場合は登録済みのアカウントのログイン情報を使います
+type scrapeRequest struct {
+	Alias       string            `json:"alias"`
+	Credentials map[string]string `json:"credentials"`
+	From        string            `json:"from"` // 2006-01-02 形式（省略時はサイトの既定の期間）
+	To          string            `json:"to"`
+	Mode        string            `json:"mode"` // incremental の場合は前回の同期日からの期間
+	ResUrl      string            `json:"resUrl"`
+	Sinks       []SinkConfig      `json:"sinks"`       // resUrl 以外の送信先
+	CallbackUrl string            `json:"callbackUrl"` // ジョブの終了時に結果を送信するURL
+}
+
+// parseRange は from / to を解析します。省略された場合はサイトの既定の期間を使います
+// 未来の日付や、サイトで指定できるより前の日付はエラーにします
+func (site *Site) parseRange(fromText, toText string, now time.Time) (time.Time, time.Time, error) {
+	from, to := site.DefaultRange(now)
+	var err error
+	if fromText != "" {
+		if from, err = time.ParseInLocation(rangeDateLayout, fromText, now.Location()); err != nil {
+			return from, to, fmt.Errorf("from '%s' の形式が不正です（%s）", fromText, rangeDateLayout)
+		}
+	}
+	if toText != "" {
+		if to, err = time.ParseInLocation(rangeDateLayout, toText, now.Location()); err != nil {
+			return from, to, fmt.Errorf("to '%s' の形式が不正です（%s）", toText, rangeDateLayout)
+		}
+	}
+	if startOfDay(from).After(startOfDay(to)) {
+		return from, to, fmt.Errorf("from '%s' が to '%s' より後になっています", from.Format(rangeDateLayout), to.Format(rangeDateLayout))
+	}
+	today := startOfDay(now)
+	if startOfDay(to).After(today) {
+		return from, to, fmt.Errorf("to '%s' が未来の日付です", to.Format(rangeDateLayout))
+	}
+	if site.Limits != nil {
+		if limits := site.Limits(); limits.MaxPastDays > 0 {
+			oldest := today.AddDate(0, 0, -limits.MaxPastDays)
+			if startOfDay(from).Before(oldest) {
+				return from, to, fmt.Errorf("from '%s' は指定できません（%s 以降を指定してください）", from.Format(rangeDateLayout), oldest.Format(rangeDateLayout))
+			}
+		}
+	}
+	return from, to, nil
+}
+
+// startScrapeJob はサイトのスクレイピングをジョブとしてバックグラウンドで開始します
+// sinks が指定されている場合はダウンロードしたファイルを送信します
+func startScrapeJob(site *Site, account string, params map[string]string, r exportRange, sinks []Sink, callbackUrl string) *Job {
+	return jobs.StartWithCallback(site.JobType, account, callbackUrl, func(ctx context.Context, job *Job) error {
+		err := scrapeAndSend(ctx, job, site, params, r, sinks)
+		if err != nil {
+			log.Printf("%s のスクレイピング中にエラーが発生しました: %v", site.Name, err)
+			notifyJobError(job, fmt.Sprintf("%s のスクレイピング中にエラーが発生しました: %v", site.Name, err), err)
+		}
+		return err
+	})
+}
+
+// scrapeAndSend はスクレイピングとファイルの送信を行い、incremental の場合は全ての送信に成功してから同期日を進めます
+func scrapeAndSend(ctx context.Context, job *Job, site *Site, params map[string]string, r exportRange, sinks []Sink) error {
+	from, to, ok, err := r.resolve(site, params, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		job.Logf("前回の同期日以降にダウンロードする期間がないため、スキップします。")
+		return nil
+	}
+	files, err := runSite(ctx, job, site, params, from, to)
+	if err != nil {
+		return err
+	}
+	if err := deliverFiles(ctx, job, sinks, files); err != nil {
+		return err
+	}
+	return advanceSyncMark(job, site, params, r, to)
+}
+
+// handleScrape は POST /scrape/{site} のハンドラーです
+func handleScrape(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	site, ok := LookupSite(r.PathValue("site"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("サイト '%s' は登録されていません（%v）", r.PathValue("site"), SiteNames()), http.StatusNotFound)
+		return
+	}
+	var req scrapeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "リクエストボディのJSONデコードに失敗しました。", http.StatusBadRequest)
+		return
+	}
+	params := req.Credentials
+	if req.Alias != "" {
+		c, err := resolveCredential(req.Alias, site.JobType)
+		if err != nil {
+			http.Error(w, err.Error(), credentialErrorStatus(err))
+			return
+		}
+		params = c.Params()
+	}
+	if err := site.validateParams(params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rng, err := site.parseExportRange(req.Mode, req.From, req.To, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sinks, err := resolveSinks(req.ResUrl, req.Sinks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCallbackURL(req.CallbackUrl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job := startScrapeJob(site, req.Alias, params, rng, sinks, req.CallbackUrl)
+	w.Header().Set("Content-Type", "application/json")
+	returnJson(w, Message{Message: fmt.Sprintf("%s のスクレイピングを開始しました。", site.Name), JobID: job.Info().ID})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingScraper は呼び出された段階を記録する Scraper です
+type recordingScraper struct {
+	calls   []string
+	failAt  string
+	files   []string
+	ranges  []dateRange
+	session *ScrapeSession
+}
+
+func (s *recordingScraper) phase(name string) error {
+	s.calls = append(s.calls, name)
+	if s.failAt == name {
+		return errors.New(name + " failed")
+	}
+	return nil
+}
+
+func (s *recordingScraper) Login(ctx context.Context, session *ScrapeSession) error {
+	s.session = session
+	return s.phase("login")
+}
+
+func (s *recordingScraper) Navigate(ctx context.Context, session *ScrapeSession) error {
+	return s.phase("navigate")
+}
+
+func (s *recordingScraper) SetRange(ctx context.Context, session *ScrapeSession, from, to time.Time) error {
+	s.ranges = append(s.ranges, dateRange{From: from, To: to})
+	return s.phase("setRange")
+}
+
+func (s *recordingScraper) Download(ctx context.Context, session *ScrapeSession) ([]string, error) {
+	return s.files, s.phase("download")
+}
+
+func (s *recordingScraper) Logout(ctx context.Context, session *ScrapeSession) error {
+	return s.phase("logout")
+}
+
+func TestSiteRegistry(t *testing.T) {
+	assert.Equal(t, []string{siteEtcMeisai, siteTheEarth}, SiteNames())
+
+	site, ok := LookupSite(siteTheEarth)
+	assert.True(t, ok)
+	assert.Equal(t, jobTypeGeneralCsv, site.JobType)
+	_, ok = LookupSite("unknown")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { RegisterSite(Site{Name: siteTheEarth}) })
+}
+
+func TestRunScraperPhases(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2026, 9, 30, 0, 0, 0, 0, time.Local)
+
+	ranges := []dateRange{{From: from, To: to}}
+
+	s := &recordingScraper{files: []string{"a.csv"}}
+	files, err := runScraper(context.Background(), &ScrapeSession{}, s, ranges)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.csv"}, files)
+	assert.Equal(t, []string{"login", "navigate", "setRange", "download", "logout"}, s.calls)
+	assert.Equal(t, ranges, s.ranges)
+
+	// 期間が複数ある場合は期間の入力とダウンロードを繰り返す
+	ranges = splitRange(from, to, 10)
+	s = &recordingScraper{files: []string{"a.csv"}}
+	files, err = runScraper(context.Background(), &ScrapeSession{}, s, ranges)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.csv", "a.csv", "a.csv"}, files)
+	assert.Equal(t, []string{"login", "navigate", "setRange", "download", "setRange", "download", "setRange", "download", "logout"}, s.calls)
+	assert.Equal(t, ranges, s.ranges)
+	ranges = ranges[:1]
+
+	// ログイン後に失敗した場合もログアウトする
+	s = &recordingScraper{failAt: "navigate"}
+	_, err = runScraper(context.Background(), &ScrapeSession{}, s, ranges)
+	assert.ErrorContains(t, err, "画面の移動に失敗しました: navigate failed")
+	assert.Equal(t, []string{"login", "navigate", "logout"}, s.calls)
+
+	// ログインに失敗した場合はログアウトしない
+	s = &recordingScraper{failAt: "login"}
+	_, err = runScraper(context.Background(), &ScrapeSession{}, s, ranges)
+	assert.ErrorContains(t, err, "ログインに失敗しました")
+	assert.Equal(t, []string{"login"}, s.calls)
+
+	// ファイルがダウンロードされなかった場合はエラー
+	s = &recordingScraper{}
+	_, err = runScraper(context.Background(), &ScrapeSession{}, s, ranges)
+	assert.ErrorIs(t, err, errNoScenarioDownload)
+}
+
+func TestScenarioScraperPhases(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+name: phases
+login:
+  - {action: fill, selector: "#user", value: "${user}"}
+navigate:
+  - {action: click, selector: "${selectors.menu}"}
+setRange:
+  - {action: fill, selector: "#from", value: "${from.yyyy}/${from.mm}/${from.dd}"}
+  - {action: fill, selector: "#to", value: "${to.yyyy}/${to.mm}/${to.dd}"}
+download:
+  - action: expect_download
+    save: ${user}.csv
+    trigger:
+      - {action: click, selector: "#csv"}
+logout:
+  - {action: click, selector: "#logout"}
+`))
+	assert.Nil(t, err)
+	type config struct {
+		Selectors struct {
+			Menu string `yaml:"menu"`
+		} `yaml:"selectors"`
+	}
+	var c config
+	c.Selectors.Menu = "#menu"
+
+	scraper := &scenarioScraper{scenario: sc, runner: newScenarioRunner(nil, scenarioVars(c))}
+	page := newFakePage()
+	store := NewJobStore(t.TempDir())
+	session := &ScrapeSession{Job: store.New(jobTypeGeneralCsv, ""), Page: page, Params: map[string]string{"user": "taro"}}
+
+	files, err := runScraper(context.Background(), session, scraper,
+		[]dateRange{{From: time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local), To: time.Date(2026, 9, 30, 0, 0, 0, 0, time.Local)}})
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0], "taro.csv"))
+	assert.Equal(t, []string{
+		"fill #user=taro",
+		"click #menu",
+		"fill #from=2026/09/01",
+		"fill #to=2026/09/30",
+		"click #csv",
+		"click #logout",
+	}, page.calls)
+}
+
+func TestRunSiteInspect(t *testing.T) {
+	orig, origPool := cfg.Browser, browserPool
+	t.Cleanup(func() { cfg.Browser, browserPool = orig, origPool })
+	cfg.Browser.Tracing = false
+	browserPool = NewBrowserPool(func() (playwright.Browser, error) {
+		return &tracedBrowser{fakeBrowser: &fakeBrowser{connected: true}, bctx: &closingTraceContext{}}, nil
+	}, 1, 0)
+	t.Cleanup(browserPool.Close)
+
+	var inspected []string
+	site := &Site{
+		Name: "inspect-test",
+		New:  func() (Scraper, error) { return &recordingScraper{files: []string{"a.zip"}}, nil },
+		Inspect: func(job *Job, files []string) ([]string, error) {
+			inspected = files
+			return []string{"a.json"}, nil
+		},
+	}
+	job := NewJobStore(t.TempDir()).New(jobTypeGeneralCsv, "")
+	now := time.Now()
+
+	// 確認で作成したファイルはダウンロードしたファイルと一緒に返す
+	files, err := runSite(context.Background(), job, site, nil, now, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.zip"}, inspected)
+	assert.Equal(t, []string{"a.zip", "a.json"}, files)
+
+	// 確認に失敗した場合はファイルを返さない
+	site.Inspect = func(job *Job, files []string) ([]string, error) { return nil, errTachoEmpty }
+	files, err = runSite(context.Background(), job, site, nil, now, now)
+	assert.ErrorIs(t, err, errTachoEmpty)
+	assert.Equal(t, errorData, errorCategory(err))
+	assert.Nil(t, files)
+}
+
+func TestSiteParseRange(t *testing.T) {
+	site, _ := LookupSite(siteEtcMeisai)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+
+	from, to, err := site.parseRange("", "", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-09-01", from.Format(rangeDateLayout))
+	assert.Equal(t, "2026-10-17", to.Format(rangeDateLayout))
+
+	from, to, err = site.parseRange("2026-08-01", "2026-08-31", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-08-01", from.Format(rangeDateLayout))
+	assert.Equal(t, "2026-08-31", to.Format(rangeDateLayout))
+
+	_, _, err = site.parseRange("2026/08/01", "", now)
+	assert.ErrorContains(t, err, "from '2026/08/01' の形式が不正です")
+	_, _, err = site.parseRange("2026-09-10", "2026-09-01", now)
+	assert.ErrorContains(t, err, "より後になっています")
+	_, _, err = site.parseRange("2026-10-01", "2026-10-18", now)
+	assert.ErrorContains(t, err, "to '2026-10-18' が未来の日付です")
+
+	// サイトで指定できるより前の日付はエラー
+	site, _ = LookupSite(siteTheEarth)
+	from, to, err = site.parseRange("2026-08-01", "", now)
+	assert.Nil(t, err)
+	assert.Equal(t, now, to)
+	_, _, err = site.parseRange("2025-10-16", "2025-10-31", now)
+	assert.ErrorContains(t, err, "2025-10-17 以降を指定してください")
+}
+
+func TestSplitRange(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.Local) }
+
+	assert.Equal(t, []dateRange{{From: day(9, 1), To: day(9, 30)}}, splitRange(day(9, 1), day(9, 30), 0))
+	assert.Equal(t, []dateRange{{From: day(9, 1), To: day(9, 30)}}, splitRange(day(9, 1), day(9, 30), 31))
+	assert.Equal(t, []dateRange{{From: day(9, 1), To: day(9, 1)}}, splitRange(day(9, 1), day(9, 1), 31))
+	assert.Equal(t, []dateRange{
+		{From: day(8, 1), To: day(8, 31)},
+		{From: day(9, 1), To: day(10, 1)},
+		{From: day(10, 2), To: day(10, 17)},
+	}, splitRange(day(8, 1), day(10, 17), 31))
+
+	// 時刻が付いていても日付で分割する（既定の期間の to は現在時刻）
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	ranges := splitRange(day(10, 16), now, 1)
+	assert.Len(t, ranges, 2)
+	assert.Equal(t, now, ranges[1].To)
+}
+
+func TestHandleScrape(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scrape/{site}", handleScrape)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrape/theearth", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = post("/scrape/unknown", `{}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = post("/scrape/theearth", `{"credentials": {"txtID1": "user"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "ログイン情報 txtID2 が空です")
+
+	rec = post("/scrape/etc-meisai", `{"credentials": {"risLoginId": "ris", "risPassword": "pass"}, "from": "2026-09-30", "to": "2026-09-01"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post("/scrape/etc-meisai", `{"alias": "etc-honsha"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	store := useTestCredentials(t)
+	_, err := store.Create(Credential{Alias: "honsha", Site: jobTypeGeneralCsv, TxtID1: "user", TxtID2: "company", TxtPass: "pass"})
+	assert.Nil(t, err)
+	rec = post("/scrape/etc-meisai", `{"alias": "honsha"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "GeneralCsv 用です")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// 送信先の種類です
+const (
+	sinkHTTP = "http" // multipart の POST（従来の resUrl と同じ）
+	sinkDir  = "dir"  // ローカル・NFS のディレクトリ
+	sinkS3   = "s3"   // S3 互換のオブジェクトストレージ（MinIO など）
+	sinkSFTP = "sftp" // SFTP サーバー
+)
+
+// Sink はダウンロードしたファイルの送信先です
+type Sink interface {
+	// Put は file を送信します。name は送信先での名前（ジョブIDのディレクトリを含む "/" 区切りの相対パス）です
+	Put(ctx context.Context, file string, name string) error
+	// String はログに出力する送信先の説明です（パスワードなどは含めません）
+	String() string
+	// Config は送信先を作り直すための設定です（設定ファイルの sinks の送信先は名前だけ）
+	Config() SinkConfig
+}
+
+// SinkConfig は送信先の設定です
+// type と各項目は設定ファイルの sinks でのみ指定し、リクエストやスケジュールでは name で登録した送信先を参照します
+type SinkConfig struct {
+	Name string `yaml:"-" json:"name,omitempty"` // 設定ファイルの sinks の名前
+	Type string `yaml:"type" json:"type,omitempty"`
+
+	// http
+	URL   string `yaml:"url" json:"url,omitempty"`
+	Field string `yaml:"field" json:"field,omitempty"` // multipart のフィールド名（既定: file）
+
+	// dir・sftp の保存先のディレクトリ、s3 のキーの先頭
+	Dir string `yaml:"dir" json:"dir,omitempty"`
+
+	// s3
+	Endpoint  string `yaml:"endpoint" json:"endpoint,omitempty"` // host:port
+	Bucket    string `yaml:"bucket" json:"bucket,omitempty"`
+	Region    string `yaml:"region" json:"region,omitempty"`
+	AccessKey string `yaml:"accessKey" json:"accessKey,omitempty"`
+	SecretKey string `yaml:"secretKey" json:"secretKey,omitempty"`
+	Insecure  bool   `yaml:"insecure" json:"insecure,omitempty"` // HTTPS ではなく HTTP で接続する
+
+	// sftp
+	Host           string `yaml:"host" json:"host,omitempty"` // host:port（ポートを省略した場合は22）
+	User           string `yaml:"user" json:"user,omitempty"`
+	Password       string `yaml:"password" json:"password,omitempty"`
+	PrivateKeyFile string `yaml:"privateKeyFile" json:"privateKeyFile,omitempty"`
+	HostKey        string `yaml:"hostKey" json:"hostKey,omitempty"` // サーバーの公開鍵（authorized_keys の形式）
+}
+
+// NewSink はリクエストやスケジュールで指定された送信先を作成します
+// 任意のディレクトリへの書き込み・ファイルの読み込みやホストへの接続を防ぐため、設定ファイルの sinks に登録した名前だけを受け付けます
+func NewSink(c SinkConfig) (Sink, error) {
+	if c.Name == "" || c != (SinkConfig{Name: c.Name}) {
+		return nil, errors.New("送信先は設定ファイルの sinks に登録した名前（{\"name\": \"...\"}）で指定してください（type などは直接指定できません）")
+	}
+	named, ok := cfg.Sinks[c.Name]
+	if !ok {
+		return nil, fmt.Errorf("送信先 '%s' は設定ファイルの sinks に登録されていません", c.Name)
+	}
+	sink, err := newSink(named)
+	if err != nil {
+		return nil, fmt.Errorf("送信先 '%s': %w", c.Name, err)
+	}
+	return &namedSink{Sink: sink, name: c.Name}, nil
+}
+
+func newSink(c SinkConfig) (Sink, error) {
+	switch c.Type {
+	case sinkHTTP:
+		if c.URL == "" {
+			return nil, errors.New("http の送信先には url が必要です")
+		}
+		return &httpSink{URL: c.URL, Field: c.Field}, nil
+	case sinkDir:
+		if c.Dir == "" {
+			return nil, errors.New("dir の送信先には dir が必要です")
+		}
+		return &dirSink{Dir: c.Dir}, nil
+	case sinkS3:
+		return newS3Sink(c)
+	case sinkSFTP:
+		return newSFTPSink(c)
+	}
+	return nil, fmt.Errorf("送信先の type '%s' は不正です（%s / %s / %s / %s）", c.Type, sinkHTTP, sinkDir, sinkS3, sinkSFTP)
+}
+
+// namedSink は設定ファイルの sinks に登録した送信先です
+// 送信待ち（outbox）には名前だけを保存し、パスワードなどはファイルに書き込みません
+type namedSink struct {
+	Sink
+	name string
+}
+
+func (s *namedSink) String() string {
+	return s.name + " (" + s.Sink.String() + ")"
+}
+
+func (s *namedSink) Config() SinkConfig {
+	return SinkConfig{Name: s.name}
+}
+
+// resolveSinks はジョブの送信先を作成します。resUrl が指定されている場合は最初に multipart の POST を追加します
+func resolveSinks(resUrl string, configs []SinkConfig) ([]Sink, error) {
+	var sinks []Sink
+	if resUrl != "" {
+		sinks = append(sinks, &httpSink{URL: resUrl})
+	}
+	for i, c := range configs {
+		sink, err := NewSink(c)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// sinkName はファイルの送信先での名前（<ジョブID>/<ファイル名>）です
+func sinkName(job *Job, file string) string {
+	if job == nil {
+		return filepath.Base(file)
+	}
+	return path.Join(job.Info().ID, filepath.Base(file))
+}
+
+// deliverFiles は全ての送信先にファイルを送信します
+// 1つの送信先に失敗しても残りの送信先には送信し、失敗した送信先のエラーをまとめて返します
+// 失敗した送信先に送れなかったファイルは送信待ち（outbox）に追加します
+func deliverFiles(ctx context.Context, job *Job, sinks []Sink, files []string) error {
+	if len(sinks) == 0 {
+		job.Logln("送信先が指定されていないため、ファイルの送信は行いません。")
+		return nil
+	}
+	job.SetStep("ファイル送信")
+	var errs []error
+	for _, sink := range sinks {
+		for i, file := range files {
+			if err := sink.Put(ctx, file, sinkName(job, file)); err != nil {
+				job.Logf("%s への '%s' の送信に失敗しました: %v", sink, filepath.Base(file), err)
+				// 送信できなかったファイルは送信待ちに追加し、後で再送する
+				if ctx.Err() == nil {
+					var rest []multipartFile
+					for _, f := range files[i:] {
+						rest = append(rest, multipartFile{Path: f, Name: sinkName(job, f)})
+					}
+					if id := queueFailedFiles(job, sink, rest, err); id != "" {
+						err = &queuedError{ID: id, Err: err}
+					}
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", sink, err))
+				break
+			}
+			job.Logf("%s に '%s' を送信しました。", sink, filepath.Base(file))
+		}
+	}
+	return withCategory(errorDelivery, errors.Join(errs...))
+}
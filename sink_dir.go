@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// dirSink はファイルをローカル（または NFS でマウントした）ディレクトリにコピーします
+type dirSink struct {
+	Dir string
+}
+
+func (s *dirSink) String() string {
+	return "dir " + s.Dir
+}
+
+func (s *dirSink) Config() SinkConfig {
+	return SinkConfig{Type: sinkDir, Dir: s.Dir}
+}
+
+// Put は一時ファイルに書き込んでから名前を変更するため、受け取る側が書き込み途中のファイルを読むことはありません
+func (s *dirSink) Put(ctx context.Context, file string, name string) error {
+	dest := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("ディレクトリの作成に失敗しました: %w", err)
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("ファイルの作成に失敗しました: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, contextReader{ctx, in}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ファイルのコピーに失敗しました: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ファイルのコピーに失敗しました: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("ファイルの名前の変更に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// contextReader はジョブがキャンセルされた場合にコピーを中断する io.Reader です
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
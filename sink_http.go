@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// httpSink はファイルを multipart/form-data で POST します（従来の resUrl への送信）
+type httpSink struct {
+	URL   string
+	Field string // multipart のフィールド名（空の場合は file）
+}
+
+func (s *httpSink) String() string {
+	return "http " + s.URL
+}
+
+// sinkContentTypes は環境の mime.types に依存せずに決める Content-Type です（zip は従来どおり application/zip）
+var sinkContentTypes = map[string]string{
+	".zip": "application/zip",
+	".csv": "text/csv",
+}
+
+// sinkContentType はファイル名の拡張子から Content-Type を返します
+func sinkContentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := sinkContentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func (s *httpSink) Config() SinkConfig {
+	return SinkConfig{Type: sinkHTTP, URL: s.URL, Field: s.Field}
+}
+
+func (s *httpSink) Put(ctx context.Context, file string, name string) error {
+	field := s.Field
+	if field == "" {
+		field = "file"
+	}
+	return postMultipart(ctx, s.URL, nil, []multipartFile{{Field: field, Path: file, Name: path.Base(name)}})
+}
+
+// multipartFile は multipart/form-data で送信する1つのファイルです
+type multipartFile struct {
+	Field string `json:"field,omitempty"` // フィールド名
+	Path  string `json:"path"`            // 送信するファイル
+	Name  string `json:"name"`            // パートのファイル名
+}
+
+// postMultipart は fields（キーの順）と files（指定した順）を1つの multipart/form-data で target に POST します
+// ステータスコードが200以外の場合はエラーを返します
+func postMultipart(ctx context.Context, target string, fields url.Values, files []multipartFile) error {
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		for _, value := range fields[key] {
+			if err := writer.WriteField(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range files {
+		if err := writeFilePart(writer, file); err != nil {
+			return err
+		}
+	}
+	writer.Close()
+
+	// ジョブがキャンセルされた場合は送信も中断する
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, &b)
+	if err != nil {
+		log.Printf("リクエスト作成失敗: %v", err)
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("ファイル送信失敗: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		log.Printf("ファイル送信失敗: ステータスコード %d, レスポンス: %s", resp.StatusCode, string(respBody))
+		return fmt.Errorf("ファイル送信失敗: ステータスコード %d", resp.StatusCode)
+	}
+	log.Println("ファイル送信に成功しました。")
+	return nil
+}
+
+// writeFilePart はファイルを1つのパートとして書き込みます
+// CreateFormFile の代わりに CreatePart を使用し、Content-Type を明示的に設定（zip は application/zip）
+func writeFilePart(writer *multipart.Writer, file multipartFile) error {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		log.Printf("ファイルのオープンに失敗しました: %v", err)
+		return err
+	}
+	defer f.Close()
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, file.Field, file.Name))
+	header.Set("Content-Type", sinkContentType(file.Name))
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		log.Printf("multipart作成失敗: %v", err)
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		log.Printf("ファイルコピー失敗: %v", err)
+		return err
+	}
+	return nil
+}
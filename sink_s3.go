@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	s3creds "github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Sink はファイルを S3 互換のオブジェクトストレージ（AWS S3・MinIO など）にアップロードします
+type s3Sink struct {
+	client *minio.Client
+	bucket string
+	prefix string
+	config SinkConfig
+}
+
+func newS3Sink(c SinkConfig) (Sink, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, errors.New("s3 の送信先には endpoint と bucket が必要です")
+	}
+	region := c.Region
+	if region == "" {
+		// リージョンを指定しない場合、アップロードの前にバケットのリージョンを問い合わせることになるため既定値を使う
+		region = "us-east-1"
+	}
+	client, err := minio.New(c.Endpoint, &minio.Options{
+		Creds:  s3creds.NewStaticV4(c.AccessKey, c.SecretKey, ""),
+		Secure: !c.Insecure,
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 の送信先 '%s' の作成に失敗しました: %w", c.Endpoint, err)
+	}
+	return &s3Sink{client: client, bucket: c.Bucket, prefix: c.Dir, config: c}, nil
+}
+
+func (s *s3Sink) String() string {
+	return fmt.Sprintf("s3 %s/%s", s.client.EndpointURL().Host, path.Join(s.bucket, s.prefix))
+}
+
+func (s *s3Sink) Config() SinkConfig {
+	return s.config
+}
+
+func (s *s3Sink) Put(ctx context.Context, file string, name string) error {
+	key := path.Join(s.prefix, name)
+	_, err := s.client.FPutObject(ctx, s.bucket, key, file, minio.PutObjectOptions{ContentType: sinkContentType(name)})
+	if err != nil {
+		return fmt.Errorf("'%s' のアップロードに失敗しました: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpSink はファイルを SFTP サーバーにアップロードします
+// サーバーのなりすましを防ぐため、hostKey（サーバーの公開鍵）の指定を必須にしています
+type sftpSink struct {
+	host   string
+	dir    string
+	config *ssh.ClientConfig
+	sink   SinkConfig
+}
+
+func newSFTPSink(c SinkConfig) (Sink, error) {
+	if c.Host == "" || c.User == "" {
+		return nil, errors.New("sftp の送信先には host と user が必要です")
+	}
+	if c.HostKey == "" {
+		return nil, errors.New("sftp の送信先には hostKey（サーバーの公開鍵）が必要です")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("sftp の hostKey の形式が不正です: %w", err)
+	}
+	var auth []ssh.AuthMethod
+	if c.PrivateKeyFile != "" {
+		pem, err := os.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("sftp の秘密鍵の読み込みに失敗しました: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("sftp の秘密鍵の形式が不正です: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp の送信先には password または privateKeyFile が必要です")
+	}
+	host := c.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	return &sftpSink{
+		host: host,
+		dir:  c.Dir,
+		config: &ssh.ClientConfig{
+			User:            c.User,
+			Auth:            auth,
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+			Timeout:         30 * time.Second,
+		},
+		sink: c,
+	}, nil
+}
+
+func (s *sftpSink) String() string {
+	return fmt.Sprintf("sftp %s@%s:%s", s.config.User, s.host, s.dir)
+}
+
+func (s *sftpSink) Config() SinkConfig {
+	return s.sink
+}
+
+// Put は一時ファイルにアップロードしてから名前を変更します
+func (s *sftpSink) Put(ctx context.Context, file string, name string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.host)
+	if err != nil {
+		return fmt.Errorf("SFTPサーバーへの接続に失敗しました: %w", err)
+	}
+	// ジョブがキャンセルされた場合は接続を閉じて中断する
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.host, s.config)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SFTPサーバーへのログインに失敗しました: %w", err)
+	}
+	client, err := sftp.NewClient(ssh.NewClient(sshConn, chans, reqs))
+	if err != nil {
+		sshConn.Close()
+		return fmt.Errorf("SFTPの開始に失敗しました: %w", err)
+	}
+	defer client.Close()
+	defer sshConn.Close()
+
+	dest := path.Join(s.dir, name)
+	if err := client.MkdirAll(path.Dir(dest)); err != nil {
+		return fmt.Errorf("ディレクトリ '%s' の作成に失敗しました: %w", path.Dir(dest), err)
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dest + ".tmp"
+	out, err := client.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("'%s' の作成に失敗しました: %w", tmp, err)
+	}
+	if _, err := out.ReadFrom(in); err != nil {
+		out.Close()
+		client.Remove(tmp)
+		return fmt.Errorf("'%s' のアップロードに失敗しました: %w", dest, err)
+	}
+	if err := out.Close(); err != nil {
+		client.Remove(tmp)
+		return fmt.Errorf("'%s' のアップロードに失敗しました: %w", dest, err)
+	}
+	if err := client.PosixRename(tmp, dest); err != nil {
+		client.Remove(tmp)
+		return fmt.Errorf("'%s' の名前の変更に失敗しました: %w", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeTestFile はテスト用の一時ディレクトリに送信するファイルを作成します
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func TestResolveSinks(t *testing.T) {
+	orig := cfg.Sinks
+	t.Cleanup(func() { cfg.Sinks = orig })
+	cfg.Sinks = map[string]SinkConfig{"nas": {Type: sinkDir, Dir: "/mnt/nas"}}
+
+	sinks, err := resolveSinks("http://example.com/upload", []SinkConfig{{Name: "nas"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []Sink{
+		&httpSink{URL: "http://example.com/upload"},
+		&namedSink{Sink: &dirSink{Dir: "/mnt/nas"}, name: "nas"},
+	}, sinks)
+	// 登録した送信先は名前だけを設定として返す
+	assert.Equal(t, SinkConfig{Name: "nas"}, sinks[1].Config())
+	assert.Equal(t, SinkConfig{Type: sinkHTTP, URL: "http://example.com/upload"}, sinks[0].Config())
+
+	sinks, err = resolveSinks("", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, sinks)
+
+	_, err = resolveSinks("", []SinkConfig{{Name: "unknown"}})
+	assert.ErrorContains(t, err, "送信先 'unknown' は設定ファイルの sinks に登録されていません")
+
+	// リクエストでは送信先の type や各項目を直接指定できない
+	for _, c := range []SinkConfig{
+		{Type: sinkHTTP, URL: "http://example.com/other"},
+		{Type: sinkDir, Dir: "/etc"},
+		{Type: sinkS3, Endpoint: "169.254.169.254:80", Bucket: "b", AccessKey: "a", SecretKey: "s"},
+		{Type: sinkSFTP, Host: "localhost", User: "upload", PrivateKeyFile: "/etc/shadow", HostKey: "ssh-ed25519 AAAA"},
+		{Name: "nas", Dir: "/etc"},
+	} {
+		_, err := resolveSinks("", []SinkConfig{c})
+		assert.ErrorContains(t, err, "設定ファイルの sinks に登録した名前", "%+v", c)
+	}
+
+	// 設定ファイルの sinks の不正な送信先
+	for _, c := range []SinkConfig{
+		{Type: "ftp"},
+		{Type: sinkHTTP},
+		{Type: sinkDir},
+		{Type: sinkS3, Endpoint: "localhost:9000"},
+		{Type: sinkSFTP, Host: "localhost", User: "upload", Password: "secret"},
+		{Type: sinkSFTP, Host: "localhost", User: "upload", Password: "secret", HostKey: "invalid"},
+	} {
+		cfg.Sinks["invalid"] = c
+		_, err := resolveSinks("", []SinkConfig{{Name: "invalid"}})
+		assert.ErrorContains(t, err, "送信先 'invalid'", "%+v", c)
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	file := writeTestFile(t, "data.csv", "a,b\n1,2\n")
+	dir := t.TempDir()
+	sink, err := newSink(SinkConfig{Type: sinkDir, Dir: dir})
+	assert.Nil(t, err)
+
+	assert.Nil(t, sink.Put(context.Background(), file, "job-1/data.csv"))
+	data, err := os.ReadFile(filepath.Join(dir, "job-1", "data.csv"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b\n1,2\n", string(data))
+	// 一時ファイルは残らない
+	entries, _ := os.ReadDir(filepath.Join(dir, "job-1"))
+	assert.Len(t, entries, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, sink.Put(ctx, file, "job-2/data.csv"), context.Canceled)
+	_, err = os.Stat(filepath.Join(dir, "job-2", "data.csv"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSinkContentType(t *testing.T) {
+	// 環境の mime.types がなくても zip・csv は同じ Content-Type にする
+	assert.Equal(t, "application/zip", sinkContentType("job-1/downloaded_file.zip"))
+	assert.Equal(t, "application/zip", sinkContentType("ETC.ZIP"))
+	assert.Equal(t, "text/csv", sinkContentType("etc-honsha.csv"))
+	assert.Equal(t, "application/octet-stream", sinkContentType("data.unknown-ext"))
+}
+
+func TestHTTPSink(t *testing.T) {
+	var field, filename, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if !assert.Nil(t, err) {
+			return
+		}
+		part, err := reader.NextPart()
+		if !assert.Nil(t, err) {
+			return
+		}
+		field, filename, contentType = part.FormName(), part.FileName(), part.Header.Get("Content-Type")
+		data, _ := io.ReadAll(part)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	file := writeTestFile(t, "export.zip", "PK")
+	assert.Nil(t, (&httpSink{URL: server.URL}).Put(context.Background(), file, "job-1/export.zip"))
+	assert.Equal(t, "file", field)
+	assert.Equal(t, "export.zip", filename)
+	assert.Equal(t, "application/zip", contentType)
+	assert.Equal(t, "PK", body)
+
+	file = writeTestFile(t, "records.unknownext", "{}")
+	assert.Nil(t, (&httpSink{URL: server.URL, Field: "records"}).Put(context.Background(), file, "job-1/records.unknownext"))
+	assert.Equal(t, "records", field)
+	assert.Equal(t, "application/octet-stream", contentType)
+}
+
+func TestS3Sink(t *testing.T) {
+	// S3 の PutObject だけを受け付けるサーバー
+	var method, path, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, auth, body = r.Method, r.URL.Path, r.Header.Get("Authorization"), string(data)
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer server.Close()
+
+	sink, err := newSink(SinkConfig{
+		Type:      sinkS3,
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    "exports",
+		Dir:       "tacho",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Insecure:  true,
+	})
+	assert.Nil(t, err)
+	file := writeTestFile(t, "export.zip", "PK")
+	assert.Nil(t, sink.Put(context.Background(), file, "job-1/export.zip"))
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/exports/tacho/job-1/export.zip", path)
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/"), auth)
+	// HTTP の場合は署名付きのチャンク（aws-chunked）で送信される
+	assert.Contains(t, body, "\r\nPK\r\n")
+}
+
+// TestS3SinkMinIO はローカルの MinIO にアップロードします
+// MINIO_ENDPOINT・MINIO_BUCKET・MINIO_ACCESS_KEY・MINIO_SECRET_KEY を指定した場合だけ実行します
+func TestS3SinkMinIO(t *testing.T) {
+	endpoint, bucket := os.Getenv("MINIO_ENDPOINT"), os.Getenv("MINIO_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("MINIO_ENDPOINT と MINIO_BUCKET が指定されていないためスキップします")
+	}
+	sink, err := newSink(SinkConfig{
+		Type:      sinkS3,
+		Endpoint:  endpoint,
+		Bucket:    bucket,
+		AccessKey: os.Getenv("MINIO_ACCESS_KEY"),
+		SecretKey: os.Getenv("MINIO_SECRET_KEY"),
+		Insecure:  true,
+	})
+	assert.Nil(t, err)
+	file := writeTestFile(t, "export.zip", "PK")
+	assert.Nil(t, sink.Put(context.Background(), file, "test/export.zip"))
+}
+
+// startTestSFTPServer はパスワード認証の SFTP サーバーを起動し、アドレスとホスト公開鍵（authorized_keys の形式）を返します
+func startTestSFTPServer(t *testing.T, password string) (string, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.Nil(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != password {
+				return nil, errors.New("パスワードが違います")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSFTP(conn, config)
+		}
+	}()
+	return listener.Addr().String(), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveTestSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session のみ対応しています")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		server.Close()
+	}
+}
+
+func TestSFTPSink(t *testing.T) {
+	addr, hostKey := startTestSFTPServer(t, "secret")
+	dir := t.TempDir()
+	file := writeTestFile(t, "export.zip", "PK")
+
+	sink, err := newSink(SinkConfig{Type: sinkSFTP, Host: addr, User: "upload", Password: "secret", HostKey: hostKey, Dir: dir})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Put(context.Background(), file, "job-1/export.zip"))
+	data, err := os.ReadFile(filepath.Join(dir, "job-1", "export.zip"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PK", string(data))
+	entries, _ := os.ReadDir(filepath.Join(dir, "job-1"))
+	assert.Len(t, entries, 1)
+
+	// パスワードが違う場合
+	sink, err = newSink(SinkConfig{Type: sinkSFTP, Host: addr, User: "upload", Password: "wrong", HostKey: hostKey, Dir: dir})
+	assert.Nil(t, err)
+	assert.NotNil(t, sink.Put(context.Background(), file, "job-2/export.zip"))
+
+	// ホスト公開鍵が一致しない場合は接続しない
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	sink, err = newSink(SinkConfig{Type: sinkSFTP, Host: addr, User: "upload", Password: "secret", HostKey: string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey())), Dir: dir})
+	assert.Nil(t, err)
+	assert.NotNil(t, sink.Put(context.Background(), file, "job-3/export.zip"))
+	_, err = os.Stat(filepath.Join(dir, "job-3"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// failingSink は常に失敗する送信先です
+type failingSink struct{}
+
+func (failingSink) Put(ctx context.Context, file string, name string) error {
+	return errors.New("送信できません")
+}
+
+func (failingSink) String() string { return "failing" }
+
+func (failingSink) Config() SinkConfig { return SinkConfig{Type: "failing"} }
+
+func TestDeliverFiles(t *testing.T) {
+	job := jobs.Start("test", "", func(ctx context.Context, job *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	t.Cleanup(func() { job.Cancel() })
+
+	dir := t.TempDir()
+	files := []string{writeTestFile(t, "a.csv", "a"), writeTestFile(t, "a.json", "[]")}
+	err := deliverFiles(context.Background(), job, []Sink{failingSink{}, &dirSink{Dir: dir}}, files)
+	assert.ErrorContains(t, err, "failing: 送信できません")
+
+	// 失敗した送信先があっても残りの送信先には送信する
+	for _, name := range []string{"a.csv", "a.json"} {
+		_, err := os.Stat(filepath.Join(dir, job.Info().ID, name))
+		assert.Nil(t, err, name)
+	}
+
+	assert.Nil(t, deliverFiles(context.Background(), job, nil, files))
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// siteEtcMeisai は etc-meisai.jp のサイト名です
+const siteEtcMeisai = "etc-meisai"
+
+func init() {
+	RegisterSite(Site{
+		Name:        siteEtcMeisai,
+		JobType:     jobTypeEtcMeisai,
+		Credentials: []string{"risLoginId", "risPassword"},
+		// 既定では先月の1日から今日までの利用明細をダウンロードする
+		DefaultRange: func(now time.Time) (time.Time, time.Time) {
+			lastmonth := now.AddDate(0, -1, 0)
+			return time.Date(lastmonth.Year(), lastmonth.Month(), 1, 0, 0, 0, 0, now.Location()), now
+		},
+		// 画面の操作手順はシナリオファイル（既定は scenarios/etc-meisai.yaml）に記述している
+		New: func() (Scraper, error) {
+			return newScenarioScraper(cfg.EtcMeisai.Scenario, "etc-meisai.yaml", cfg.EtcMeisai)
+		},
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// siteTheEarth は theearth-np.com（デジタコ）のサイト名です
+const siteTheEarth = "theearth"
+
+func init() {
+	RegisterSite(Site{
+		Name:        siteTheEarth,
+		JobType:     jobTypeGeneralCsv,
+		Credentials: []string{"txtID1", "txtID2", "txtPass"},
+		// 既定では昨日から今日までのデータをダウンロードする
+		DefaultRange: func(now time.Time) (time.Time, time.Time) {
+			return now.AddDate(0, 0, -1), now
+		},
+		// 同じ会社の別のユーザーとは同期日を分ける
+		Account: func(params map[string]string) string {
+			return params["txtID2"] + "/" + params["txtID1"]
+		},
+		// 1回のCSV出力で指定できる日数を超える期間は分割して出力する
+		Limits: func() RangeLimits {
+			return RangeLimits{MaxDays: cfg.TheEarth.MaxRangeDays, MaxPastDays: cfg.TheEarth.MaxPastDays}
+		},
+		// 分割して出力したファイルも /post で送信できるように1つのzipにまとめる
+		Bundle: "downloaded_file.zip",
+		// zipの中のCSVを確認し、空のzipや途中で切れたzipは送信しない
+		Inspect: inspectTachoZip,
+		// 画面の操作手順はシナリオファイル（既定は scenarios/theearth.yaml）に記述している
+		New: func() (Scraper, error) {
+			return newScenarioScraper(cfg.TheEarth.Scenario, "theearth.yaml", cfg.TheEarth)
+		},
+	})
+}
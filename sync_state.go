@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// modeIncremental は前回の同期日からの期間だけをダウンロードするモードです
+const modeIncremental = "incremental"
+
+// validateMode はリクエストやスケジュールの mode を検証します（空は通常のモード）
+func validateMode(mode string) error {
+	switch mode {
+	case "", modeIncremental:
+		return nil
+	}
+	return fmt.Errorf("mode '%s' は不正です（%s を指定できます）", mode, modeIncremental)
+}
+
+// SyncMark はアカウント・サイトごとの同期日（最後に送信まで成功した期間の終了日）です
+type SyncMark struct {
+	Site      string    `json:"site"`
+	Account   string    `json:"account"`  // サイトのログインID（エイリアスではなく、同じアカウントなら同じ値）
+	LastDate  string    `json:"lastDate"` // 2006-01-02 形式
+	JobID     string    `json:"jobId,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SyncStore は同期日をJSONファイルに保存します
+type SyncStore struct {
+	path  string
+	mu    sync.Mutex
+	marks map[string]SyncMark // site + "/" + account → 同期日
+}
+
+// syncStore はサーバー起動時に開く同期日の保存先です（nil の場合は incremental を使えません）
+var syncStore *SyncStore
+
+// NewSyncStore は path のファイルを読み込んで同期日の保存先を作成します
+// ファイルが存在しない場合は空の状態から始めます
+func NewSyncStore(path string) (*SyncStore, error) {
+	s := &SyncStore{path: path, marks: make(map[string]SyncMark)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("同期日のファイル '%s' の読み込みに失敗しました: %w", path, err)
+	}
+	var marks []SyncMark
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return nil, fmt.Errorf("同期日のファイル '%s' の解析に失敗しました: %w", path, err)
+	}
+	for _, m := range marks {
+		s.marks[syncKey(m.Site, m.Account)] = m
+	}
+	return s, nil
+}
+
+func syncKey(site, account string) string {
+	return site + "/" + account
+}
+
+// Get はアカウント・サイトの同期日を返します
+func (s *SyncStore) Get(site, account string) (SyncMark, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.marks[syncKey(site, account)]
+	return m, ok
+}
+
+// List は全ての同期日をサイト・アカウントの順に返します
+func (s *SyncStore) List() []SyncMark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocked()
+}
+
+func (s *SyncStore) sortedLocked() []SyncMark {
+	marks := make([]SyncMark, 0, len(s.marks))
+	for _, m := range s.marks {
+		marks = append(marks, m)
+	}
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].Site != marks[j].Site {
+			return marks[i].Site < marks[j].Site
+		}
+		return marks[i].Account < marks[j].Account
+	})
+	return marks
+}
+
+// Advance は同期日を date に進めて保存します。既に date 以降の場合は何もしません
+func (s *SyncStore) Advance(site, account string, date time.Time, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := syncKey(site, account)
+	last := date.Format(rangeDateLayout)
+	if m, ok := s.marks[key]; ok && m.LastDate >= last {
+		return nil
+	}
+	prev, existed := s.marks[key]
+	s.marks[key] = SyncMark{Site: site, Account: account, LastDate: last, JobID: jobID, UpdatedAt: time.Now()}
+	if err := s.saveLocked(); err != nil {
+		// 保存できなかった場合はメモリ上の状態も戻す
+		if existed {
+			s.marks[key] = prev
+		} else {
+			delete(s.marks, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// saveLocked は同期日を一時ファイルに書き込み、置き換えます
+func (s *SyncStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.sortedLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("同期日のファイルのディレクトリの作成に失敗しました: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("同期日のファイルの書き込みに失敗しました: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("同期日のファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// initSyncStore は設定ファイルの sync.file から同期日を読み込みます
+func initSyncStore() error {
+	store, err := NewSyncStore(cfg.Sync.File)
+	if err != nil {
+		return err
+	}
+	syncStore = store
+	log.Printf("同期日のファイル '%s' を読み込みました（%d 件）", cfg.Sync.File, len(store.List()))
+	return nil
+}
+
+// exportRange はジョブでダウンロードする期間の指定です
+// From・To がゼロ値の場合はサイトの既定の期間を使います
+// Incremental の場合はジョブの実行時に、前回の同期日から（sync.overlapDays 日だけ重ねて）今日までの期間にします
+type exportRange struct {
+	From        time.Time
+	To          time.Time
+	Incremental bool
+}
+
+// resolve は実際にダウンロードする期間を返します
+// 同期日が今日以降で新しくダウンロードする期間がない場合は ok が false になります
+func (r exportRange) resolve(site *Site, params map[string]string, now time.Time) (from, to time.Time, ok bool, err error) {
+	if !r.Incremental {
+		if r.From.IsZero() || r.To.IsZero() {
+			from, to = site.DefaultRange(now)
+			return from, to, true, nil
+		}
+		return r.From, r.To, true, nil
+	}
+	if syncStore == nil {
+		return from, to, false, errors.New("同期日の保存先が初期化されていないため、incremental は使えません")
+	}
+	from, to = site.DefaultRange(now)
+	mark, found := syncStore.Get(site.Name, site.account(params))
+	if !found {
+		// 初回はサイトの既定の期間
+		return from, to, true, nil
+	}
+	last, err := time.ParseInLocation(rangeDateLayout, mark.LastDate, now.Location())
+	if err != nil {
+		return from, to, false, fmt.Errorf("同期日 '%s' の形式が不正です: %w", mark.LastDate, err)
+	}
+	from = last.AddDate(0, 0, 1-cfg.Sync.OverlapDays)
+	if startOfDay(from).After(startOfDay(to)) {
+		return from, to, false, nil
+	}
+	// 前回の同期から時間が経っている場合も、サイトで指定できるより前の日付にはしない
+	if site.Limits != nil {
+		if limits := site.Limits(); limits.MaxPastDays > 0 {
+			if oldest := startOfDay(now).AddDate(0, 0, -limits.MaxPastDays); from.Before(oldest) {
+				from = oldest
+			}
+		}
+	}
+	return from, to, true, nil
+}
+
+// parseExportRange はリクエストの mode・from・to からダウンロードする期間を作成します
+// incremental の場合は from・to を指定できません
+func (site *Site) parseExportRange(mode, fromText, toText string, now time.Time) (exportRange, error) {
+	if err := validateMode(mode); err != nil {
+		return exportRange{}, err
+	}
+	if mode == modeIncremental {
+		if fromText != "" || toText != "" {
+			return exportRange{}, errors.New("mode が incremental の場合は from・to を指定できません")
+		}
+		return exportRange{Incremental: true}, nil
+	}
+	from, to, err := site.parseRange(fromText, toText, now)
+	if err != nil {
+		return exportRange{}, err
+	}
+	return exportRange{From: from, To: to}, nil
+}
+
+// advanceSyncMark は incremental の場合に、送信まで成功した期間の終了日で同期日を進めます
+func advanceSyncMark(job *Job, site *Site, params map[string]string, r exportRange, to time.Time) error {
+	if !r.Incremental {
+		return nil
+	}
+	account := site.account(params)
+	if syncStore == nil {
+		return errors.New("同期日の保存先が初期化されていません")
+	}
+	if err := syncStore.Advance(site.Name, account, to, job.Info().ID); err != nil {
+		return fmt.Errorf("同期日の更新に失敗しました: %w", err)
+	}
+	job.Logf("%s (%s) の同期日を %s に更新しました。", site.Name, account, to.Format(rangeDateLayout))
+	return nil
+}
+
+// handleSyncMarks は GET /sync のハンドラーです
+func handleSyncMarks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみ許可されています", http.StatusMethodNotAllowed)
+		return
+	}
+	marks := []SyncMark{}
+	if syncStore != nil {
+		marks = syncStore.List()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(marks); err != nil {
+		log.Printf("JSONエンコードエラー: %v", err)
+	}
+}
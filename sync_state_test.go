@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestSyncStore はテスト用の一時ディレクトリに同期日の保存先を作成し、テスト終了時に元に戻します
+func useTestSyncStore(t *testing.T) *SyncStore {
+	t.Helper()
+	store, err := NewSyncStore(filepath.Join(t.TempDir(), "sync_state.json"))
+	assert.Nil(t, err)
+	old := syncStore
+	syncStore = store
+	t.Cleanup(func() { syncStore = old })
+	return store
+}
+
+func TestSyncStoreAdvance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "sync_state.json")
+	store, err := NewSyncStore(path)
+	assert.Nil(t, err)
+	assert.Empty(t, store.List())
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 15, 0, 0, 0, time.Local) }
+	assert.Nil(t, store.Advance(siteTheEarth, "company/user", day(10), "job-1"))
+	assert.Nil(t, store.Advance(siteEtcMeisai, "ris01", day(12), "job-2"))
+
+	// 同期日は戻らない
+	assert.Nil(t, store.Advance(siteTheEarth, "company/user", day(5), "job-3"))
+	mark, ok := store.Get(siteTheEarth, "company/user")
+	assert.True(t, ok)
+	assert.Equal(t, "2026-10-10", mark.LastDate)
+	assert.Equal(t, "job-1", mark.JobID)
+
+	// ファイルから読み込み直しても同じ同期日になる
+	reloaded, err := NewSyncStore(path)
+	assert.Nil(t, err)
+	marks := reloaded.List()
+	assert.Len(t, marks, 2)
+	assert.Equal(t, siteEtcMeisai, marks[0].Site)
+	assert.Equal(t, "2026-10-12", marks[0].LastDate)
+	assert.Equal(t, "2026-10-10", marks[1].LastDate)
+	_, ok = reloaded.Get(siteEtcMeisai, "ris02")
+	assert.False(t, ok)
+}
+
+func TestExportRangeResolve(t *testing.T) {
+	store := useTestSyncStore(t)
+	site, _ := LookupSite(siteTheEarth)
+	params := map[string]string{"txtID1": "user", "txtID2": "company", "txtPass": "pass"}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.Local) }
+
+	// 期間の指定がない場合はサイトの既定の期間
+	from, to, ok, err := exportRange{}.resolve(site, params, now)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, now.AddDate(0, 0, -1), from)
+	assert.Equal(t, now, to)
+
+	from, _, _, _ = exportRange{From: day(9, 1), To: day(9, 30)}.resolve(site, params, now)
+	assert.Equal(t, day(9, 1), from)
+
+	// 同期日がない場合はサイトの既定の期間
+	incremental := exportRange{Incremental: true}
+	from, _, ok, err = incremental.resolve(site, params, now)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, now.AddDate(0, 0, -1), from)
+
+	// 同期日から overlapDays 日分を重ねる
+	assert.Nil(t, store.Advance(siteTheEarth, "company/user", day(10, 10), "job-1"))
+	from, to, ok, err = incremental.resolve(site, params, now)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, day(10, 10), from)
+	assert.Equal(t, now, to)
+
+	old := cfg.Sync.OverlapDays
+	t.Cleanup(func() { cfg.Sync.OverlapDays = old })
+	cfg.Sync.OverlapDays = 0
+	from, _, _, _ = incremental.resolve(site, params, now)
+	assert.Equal(t, day(10, 11), from)
+
+	// 今日まで同期済みの場合はダウンロードしない
+	assert.Nil(t, store.Advance(siteTheEarth, "company/user", now, "job-2"))
+	_, _, ok, err = incremental.resolve(site, params, now)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// サイトで指定できるより前の日付にはしない
+	params["txtID1"] = "other"
+	assert.Nil(t, store.Advance(siteTheEarth, "company/other", day(1, 1).AddDate(-1, 0, 0), "job-3"))
+	from, _, ok, _ = incremental.resolve(site, params, now)
+	assert.True(t, ok)
+	assert.Equal(t, startOfDay(now).AddDate(0, 0, -cfg.TheEarth.MaxPastDays), from)
+
+	// 同期日の保存先がない場合はエラー
+	syncStore = nil
+	_, _, _, err = incremental.resolve(site, params, now)
+	assert.ErrorContains(t, err, "incremental は使えません")
+}
+
+func TestParseExportRange(t *testing.T) {
+	site, _ := LookupSite(siteEtcMeisai)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+
+	rng, err := site.parseExportRange("", "2026-09-01", "2026-09-30", now)
+	assert.Nil(t, err)
+	assert.False(t, rng.Incremental)
+	assert.Equal(t, "2026-09-01", rng.From.Format(rangeDateLayout))
+
+	rng, err = site.parseExportRange(modeIncremental, "", "", now)
+	assert.Nil(t, err)
+	assert.Equal(t, exportRange{Incremental: true}, rng)
+
+	_, err = site.parseExportRange(modeIncremental, "2026-09-01", "", now)
+	assert.ErrorContains(t, err, "from・to を指定できません")
+	_, err = site.parseExportRange("full", "", "", now)
+	assert.ErrorContains(t, err, "mode 'full' は不正です")
+}
+
+func TestSiteAccount(t *testing.T) {
+	theEarth, _ := LookupSite(siteTheEarth)
+	assert.Equal(t, "company/user", theEarth.account(map[string]string{"txtID1": "user", "txtID2": "company"}))
+	etc, _ := LookupSite(siteEtcMeisai)
+	assert.Equal(t, "ris01", etc.account(map[string]string{"risLoginId": "ris01", "risPassword": "pass01"}))
+}
+
+func TestHandleSyncMarks(t *testing.T) {
+	store := useTestSyncStore(t)
+	assert.Nil(t, store.Advance(siteEtcMeisai, "ris01", time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local), "job-1"))
+
+	rec := httptest.NewRecorder()
+	handleSyncMarks(rec, httptest.NewRequest(http.MethodGet, "/sync", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var marks []SyncMark
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &marks))
+	assert.Len(t, marks, 1)
+	assert.Equal(t, "ris01", marks[0].Account)
+	assert.Equal(t, "2026-10-16", marks[0].LastDate)
+
+	rec = httptest.NewRecorder()
+	handleSyncMarks(rec, httptest.NewRequest(http.MethodPost, "/sync", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+// デジタコのCSVの種類（マニフェストの type）です
+const (
+	tachoOperations = "operations" // 運行データ
+	tachoEvents     = "events"     // 運転イベント（急加速・速度超過など）
+	tachoStops      = "stops"      // 停車・休憩
+	tachoUnknown    = "unknown"    // 見出しから判別できないCSV
+)
+
+var (
+	// errTachoEmpty はzipにデータの行がない場合のエラーです
+	errTachoEmpty = errors.New("デジタコのCSVにデータがありません")
+	// errTachoTruncated はzipやCSVが途中で切れている場合のエラーです
+	errTachoTruncated = errors.New("デジタコのCSVが壊れているか途中で切れています")
+)
+
+// TachoOperation は運行データの1行分です
+type TachoOperation struct {
+	Date          string    `json:"date"` // 運行日（2006-01-02）
+	VehicleNumber string    `json:"vehicleNumber"`
+	Driver        string    `json:"driver,omitempty"`
+	DepartureAt   time.Time `json:"departureAt,omitzero"` // 出庫日時
+	ReturnAt      time.Time `json:"returnAt,omitzero"`    // 帰庫日時
+	DistanceKm    float64   `json:"distanceKm,omitempty"` // 走行距離
+}
+
+// TachoEvent は運転イベントの1行分です
+type TachoEvent struct {
+	At            time.Time `json:"at"`
+	Event         string    `json:"event"`
+	VehicleNumber string    `json:"vehicleNumber,omitempty"`
+	Driver        string    `json:"driver,omitempty"`
+	SpeedKmh      float64   `json:"speedKmh,omitempty"`
+	Location      string    `json:"location,omitempty"`
+}
+
+// TachoStop は停車・休憩の1行分です
+type TachoStop struct {
+	StartAt       time.Time `json:"startAt"`
+	EndAt         time.Time `json:"endAt"`
+	Kind          string    `json:"kind,omitempty"` // 区分（休憩・荷積みなど）
+	VehicleNumber string    `json:"vehicleNumber,omitempty"`
+	Driver        string    `json:"driver,omitempty"`
+	Location      string    `json:"location,omitempty"`
+}
+
+// TachoData はデジタコのzipに含まれる全てのCSVのレコードです
+type TachoData struct {
+	Operations []TachoOperation `json:"operations"`
+	Events     []TachoEvent     `json:"events"`
+	Stops      []TachoStop      `json:"stops"`
+}
+
+// tachoCsvType は見出しで判別するCSVの種類です
+type tachoCsvType struct {
+	name     string
+	headers  func() map[string][]string // 列 → 見出しの候補（設定ファイルの theearth.tachoHeaders）
+	required []string                   // この列が全てある場合にこの種類と判断する
+	add      func(data *TachoData, field func(key string) string) error
+}
+
+// 列の見出しは出力の設定によって名前が異なるため、見出しの候補を設定ファイルで変更できます
+var tachoCsvTypes = []tachoCsvType{
+	{
+		name:     tachoEvents,
+		headers:  func() map[string][]string { return cfg.TheEarth.TachoHeaders.Events },
+		required: []string{"at", "event"},
+		add: func(data *TachoData, field func(string) string) error {
+			e := TachoEvent{Event: field("event"), VehicleNumber: field("vehicle"), Driver: field("driver"), Location: field("location")}
+			var err error
+			if e.At, err = parseTachoTime(field("at")); err != nil {
+				return err
+			}
+			if e.SpeedKmh, err = parseTachoNumber(field("speed")); err != nil {
+				return err
+			}
+			data.Events = append(data.Events, e)
+			return nil
+		},
+	},
+	{
+		name:     tachoStops,
+		headers:  func() map[string][]string { return cfg.TheEarth.TachoHeaders.Stops },
+		required: []string{"start", "end"},
+		add: func(data *TachoData, field func(string) string) error {
+			s := TachoStop{Kind: field("kind"), VehicleNumber: field("vehicle"), Driver: field("driver"), Location: field("location")}
+			var err error
+			if s.StartAt, err = parseTachoTime(field("start")); err != nil {
+				return err
+			}
+			if s.EndAt, err = parseTachoTime(field("end")); err != nil {
+				return err
+			}
+			data.Stops = append(data.Stops, s)
+			return nil
+		},
+	},
+	{
+		name:     tachoOperations,
+		headers:  func() map[string][]string { return cfg.TheEarth.TachoHeaders.Operations },
+		required: []string{"date", "vehicle"},
+		add: func(data *TachoData, field func(string) string) error {
+			o := TachoOperation{VehicleNumber: field("vehicle"), Driver: field("driver")}
+			date, err := parseTachoTime(field("date"))
+			if err != nil {
+				return err
+			}
+			if !date.IsZero() {
+				o.Date = date.Format(rangeDateLayout)
+			}
+			if o.DepartureAt, err = parseTachoTime(field("departure")); err != nil {
+				return err
+			}
+			if o.ReturnAt, err = parseTachoTime(field("return")); err != nil {
+				return err
+			}
+			if o.DistanceKm, err = parseTachoNumber(field("distance")); err != nil {
+				return err
+			}
+			data.Operations = append(data.Operations, o)
+			return nil
+		},
+	},
+}
+
+// detectTachoCsv は見出しからCSVの種類と列の位置を判別します
+func detectTachoCsv(header []string) (*tachoCsvType, map[string]int) {
+	for i := range tachoCsvTypes {
+		t := &tachoCsvTypes[i]
+		aliases := map[string]string{}
+		for key, names := range t.headers() {
+			for _, name := range names {
+				aliases[normalizeCsvHeader(name)] = key
+			}
+		}
+		columns := map[string]int{}
+		for j, name := range header {
+			if key, ok := aliases[normalizeCsvHeader(name)]; ok {
+				if _, dup := columns[key]; !dup {
+					columns[key] = j
+				}
+			}
+		}
+		matched := true
+		for _, key := range t.required {
+			if _, ok := columns[key]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return t, columns
+		}
+	}
+	return nil, nil
+}
+
+// tachoTimeLayouts はデジタコのCSVの日時の形式です
+var tachoTimeLayouts = []string{
+	"2006/01/02 15:04:05", "2006/01/02 15:04", "2006/01/02",
+	"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02",
+	"2006/1/2 15:04:05", "2006/1/2 15:04", "2006/1/2",
+}
+
+// parseTachoTime は日時（2026/10/16 08:00:00 など）を解析します。空の場合はゼロ値です
+func parseTachoTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range tachoTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("日時 '%s' の形式が不正です", s)
+}
+
+// parseTachoNumber は距離や速度（1,234.5 など）を解析します。空の場合は0です
+func parseTachoNumber(s string) (float64, error) {
+	n := strings.ReplaceAll(width.Fold.String(s), ",", "")
+	if n == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0, fmt.Errorf("数値 '%s' の形式が不正です", s)
+	}
+	return v, nil
+}
+
+// ParseTachoZip はデジタコのzipを開き、含まれるCSVを見出しで判別してレコードに変換します
+// 分割して出力したzipをまとめたもの（zipの中のzip）も読み込みます
+// CSVが1つもない場合やデータの行がない場合は errTachoEmpty、zipやCSVが途中で切れている場合は errTachoTruncated を返します
+func ParseTachoZip(zipPath string) (*TachoData, []ManifestEntry, error) {
+	data := &TachoData{Operations: []TachoOperation{}, Events: []TachoEvent{}, Stops: []TachoStop{}}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errTachoTruncated, err)
+	}
+	defer zr.Close()
+	var manifest []ManifestEntry
+	if err := parseTachoFiles(&zr.Reader, "", data, &manifest); err != nil {
+		return nil, manifest, err
+	}
+	rows := 0
+	for _, entry := range manifest {
+		rows += entry.Rows
+	}
+	if rows == 0 {
+		return nil, manifest, fmt.Errorf("%w（CSV %d 個）", errTachoEmpty, len(manifest))
+	}
+	return data, manifest, nil
+}
+
+func parseTachoFiles(zr *zip.Reader, prefix string, data *TachoData, manifest *[]ManifestEntry) error {
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := prefix + f.Name
+		content, err := readZipFile(f)
+		if err != nil {
+			return fmt.Errorf("%w: '%s': %v", errTachoTruncated, name, err)
+		}
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".zip":
+			inner, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				return fmt.Errorf("%w: '%s': %v", errTachoTruncated, name, err)
+			}
+			if err := parseTachoFiles(inner, name+"/", data, manifest); err != nil {
+				return err
+			}
+		case ".csv":
+			entry, err := parseTachoCsv(name, content, data)
+			if err != nil {
+				return err
+			}
+			*manifest = append(*manifest, entry)
+		}
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// parseTachoCsv は1つのCSVを読み込み、判別できた種類のレコードを data に追加します
+func parseTachoCsv(name string, content []byte, data *TachoData) (ManifestEntry, error) {
+	entry := ManifestEntry{File: name, Type: tachoUnknown, Size: int64(len(content))}
+	decoded, err := decodeShiftJIS(content)
+	if err != nil {
+		return entry, fmt.Errorf("'%s': %w", name, err)
+	}
+	reader := csv.NewReader(bytes.NewReader(decoded))
+	// 見出しと列の数が違う行（途中で切れた行）はエラーにする
+	reader.FieldsPerRecord = 0
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		// 見出しもない空のCSV
+		return entry, nil
+	}
+	if err != nil {
+		return entry, fmt.Errorf("%w: '%s': %v", errTachoTruncated, name, err)
+	}
+	t, columns := detectTachoCsv(header)
+	if t != nil {
+		entry.Type = t.name
+	}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entry, fmt.Errorf("%w: '%s' の %d 行目: %v", errTachoTruncated, name, line, err)
+		}
+		entry.Rows++
+		if t == nil {
+			continue
+		}
+		field := func(key string) string {
+			if i, ok := columns[key]; ok {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		if err := t.add(data, field); err != nil {
+			return entry, fmt.Errorf("'%s' の %d 行目: %w", name, line, err)
+		}
+	}
+	return entry, nil
+}
+
+// inspectTachoZip はダウンロードしたzipを確認し、ジョブのマニフェストを記録してレコードを <zipの名前>.json に保存します
+// 保存したJSONのパスを返し、zipと一緒に送信します。空のzipや途中で切れたzipは送信する前にエラーにします
+func inspectTachoZip(job *Job, files []string) ([]string, error) {
+	var saved []string
+	for _, file := range files {
+		job.SetStep("CSVの確認")
+		data, manifest, err := ParseTachoZip(file)
+		job.AddManifest(manifest...)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' の確認に失敗しました: %w", filepath.Base(file), err)
+		}
+		for _, entry := range manifest {
+			job.Logf("%s: %s（%d 行）", entry.File, entry.Type, entry.Rows)
+		}
+		out := strings.TrimSuffix(file, filepath.Ext(file)) + ".json"
+		b, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(out, b, 0644); err != nil {
+			return nil, fmt.Errorf("レコードの保存に失敗しました: %w", err)
+		}
+		job.Logf("運行 %d 件・イベント %d 件・停車 %d 件のレコードを '%s' に保存しました。", len(data.Operations), len(data.Events), len(data.Stops), out)
+		saved = append(saved, out)
+	}
+	return saved, nil
+}
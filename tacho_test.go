@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestZip は files をzipにして一時ディレクトリに保存します
+func writeTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "downloaded_file.zip")
+	assert.Nil(t, os.WriteFile(path, fakeZip(t, files), 0644))
+	return path
+}
+
+func TestParseTachoZip(t *testing.T) {
+	at := func(d, h, m int) time.Time { return time.Date(2026, 10, d, h, m, 0, 0, time.Local) }
+	path := writeTestZip(t, map[string]string{
+		"unko.csv":   string(fakeShiftJIS(t, "運行日,車両番号,乗務員,出庫日時,帰庫日時,走行距離\r\n2026/10/16,品川100あ1234,山田,2026/10/16 06:00:00,2026/10/16 18:30:00,\"1,215.4\"\r\n2026/10/16,品川100あ5678,佐藤,,,\r\n")),
+		"event.csv":  string(fakeShiftJIS(t, "発生日時,車両番号,乗務員,イベント,速度（km/h）\r\n2026/10/16 09:12,品川100あ1234,山田,速度超過,92\r\n")),
+		"teisha.csv": "停車開始日時,停車終了日時,車両番号,停車区分,場所\n2026/10/16 12:00:00,2026/10/16 12:45:00,品川100あ1234,休憩,足柄SA\n",
+		"memo.csv":   "メモ\nあいう\n",
+		"readme.txt": "CSVではないファイル",
+	})
+
+	data, manifest, err := ParseTachoZip(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []TachoOperation{
+		{Date: "2026-10-16", VehicleNumber: "品川100あ1234", Driver: "山田", DepartureAt: at(16, 6, 0), ReturnAt: at(16, 18, 30), DistanceKm: 1215.4},
+		{Date: "2026-10-16", VehicleNumber: "品川100あ5678", Driver: "佐藤"},
+	}, data.Operations)
+	assert.Equal(t, []TachoEvent{{At: at(16, 9, 12), Event: "速度超過", VehicleNumber: "品川100あ1234", Driver: "山田", SpeedKmh: 92}}, data.Events)
+	assert.Equal(t, []TachoStop{{StartAt: at(16, 12, 0), EndAt: at(16, 12, 45), Kind: "休憩", VehicleNumber: "品川100あ1234", Location: "足柄SA"}}, data.Stops)
+
+	types := map[string]string{}
+	rows := map[string]int{}
+	for _, entry := range manifest {
+		types[entry.File] = entry.Type
+		rows[entry.File] = entry.Rows
+		assert.Positive(t, entry.Size)
+	}
+	assert.Equal(t, map[string]string{"unko.csv": tachoOperations, "event.csv": tachoEvents, "teisha.csv": tachoStops, "memo.csv": tachoUnknown}, types)
+	assert.Equal(t, map[string]int{"unko.csv": 2, "event.csv": 1, "teisha.csv": 1, "memo.csv": 1}, rows)
+}
+
+func TestParseTachoZipBundled(t *testing.T) {
+	// 分割して出力したzipをまとめたもの（BundleDownloads の結果）も読み込む
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeGeneralCsv, "")
+	var files []string
+	for _, name := range []string{"theearth_a.zip", "theearth_b.zip"} {
+		path, err := job.ArtifactPath(artifactDownloads, name)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(path, fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号\n2026/10/16,品川100あ1234\n"}), 0644))
+		files = append(files, path)
+	}
+	bundle, err := job.BundleDownloads(files, "downloaded_file.zip")
+	assert.Nil(t, err)
+
+	data, manifest, err := ParseTachoZip(bundle)
+	assert.Nil(t, err)
+	assert.Len(t, data.Operations, 2)
+	assert.Equal(t, []ManifestEntry{
+		{File: "theearth_a/unko.csv", Type: tachoOperations, Rows: 1, Size: manifest[0].Size},
+		{File: "theearth_b/unko.csv", Type: tachoOperations, Rows: 1, Size: manifest[1].Size},
+	}, manifest)
+
+	// zipの中のzipも読み込む
+	nested := writeTestZip(t, map[string]string{"inner.zip": string(fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号\n2026/10/16,品川100あ1234\n"}))})
+	_, manifest, err = ParseTachoZip(nested)
+	assert.Nil(t, err)
+	assert.Equal(t, "inner.zip/unko.csv", manifest[0].File)
+}
+
+func TestParseTachoZipRejects(t *testing.T) {
+	// CSVがない・データの行がない
+	_, _, err := ParseTachoZip(writeTestZip(t, map[string]string{}))
+	assert.ErrorIs(t, err, errTachoEmpty)
+	_, manifest, err := ParseTachoZip(writeTestZip(t, map[string]string{"unko.csv": "運行日,車両番号\n", "empty.csv": ""}))
+	assert.ErrorIs(t, err, errTachoEmpty)
+	assert.Len(t, manifest, 2)
+
+	// 途中で切れたzip
+	content := fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号\n2026/10/16,品川100あ1234\n"})
+	path := filepath.Join(t.TempDir(), "truncated.zip")
+	assert.Nil(t, os.WriteFile(path, content[:len(content)/2], 0644))
+	_, _, err = ParseTachoZip(path)
+	assert.ErrorIs(t, err, errTachoTruncated)
+
+	// 最後の行が途中で切れたCSV
+	_, _, err = ParseTachoZip(writeTestZip(t, map[string]string{"unko.csv": "運行日,車両番号,乗務員\n2026/10/16,品川100あ1234,山田\n2026/10/16,品川"}))
+	assert.ErrorIs(t, err, errTachoTruncated)
+	assert.ErrorContains(t, err, "'unko.csv' の 3 行目")
+
+	// 形式が不正な値
+	_, _, err = ParseTachoZip(writeTestZip(t, map[string]string{"unko.csv": "運行日,車両番号\n10月16日,品川100あ1234\n"}))
+	assert.ErrorContains(t, err, "'unko.csv' の 2 行目: 日時 '10月16日' の形式が不正です")
+}
+
+func TestInspectTachoZip(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+	job := store.New(jobTypeGeneralCsv, "")
+	path, err := job.ArtifactPath(artifactDownloads, "downloaded_file.zip")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号\n2026/10/16,品川100あ1234\n"}), 0644))
+
+	saved, err := inspectTachoZip(job, []string{path})
+	assert.Nil(t, err)
+	// レコードのJSONはzipと一緒に送信する
+	assert.Equal(t, []string{filepath.Join(filepath.Dir(path), "downloaded_file.json")}, saved)
+	assert.Equal(t, []ManifestEntry{{File: "unko.csv", Type: tachoOperations, Rows: 1, Size: int64(len("運行日,車両番号\n2026/10/16,品川100あ1234\n"))}}, job.Info().Manifest)
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(path), "downloaded_file.json"))
+	assert.Nil(t, err)
+	var data TachoData
+	assert.Nil(t, json.Unmarshal(content, &data))
+	assert.Len(t, data.Operations, 1)
+	assert.Empty(t, data.Events)
+
+	// 空のzipはエラーにし、マニフェストには記録する
+	job = store.New(jobTypeGeneralCsv, "")
+	path, _ = job.ArtifactPath(artifactDownloads, "downloaded_file.zip")
+	assert.Nil(t, os.WriteFile(path, fakeZip(t, map[string]string{"unko.csv": "運行日,車両番号\n"}), 0644))
+	saved, err = inspectTachoZip(job, []string{path})
+	assert.ErrorIs(t, err, errTachoEmpty)
+	assert.Nil(t, saved)
+	assert.ErrorContains(t, err, "'downloaded_file.zip' の確認に失敗しました")
+	assert.Len(t, job.Info().Manifest, 1)
+}
+
+func TestTachoHeadersConfig(t *testing.T) {
+	orig := cfg.TheEarth
+	t.Cleanup(func() { cfg.TheEarth = orig })
+
+	// 設定ファイルで指定した列は既定の見出しの候補を置き換える
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte("theearth:\n  tachoHeaders:\n    operations:\n      date: [乗務日]\n"), 0644))
+	c, err := LoadConfig(config)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"乗務日"}, c.TheEarth.TachoHeaders.Operations["date"])
+	assert.Equal(t, DefaultConfig().TheEarth.TachoHeaders.Operations["vehicle"], c.TheEarth.TachoHeaders.Operations["vehicle"])
+	cfg.TheEarth = c.TheEarth
+
+	data, manifest, err := ParseTachoZip(writeTestZip(t, map[string]string{"unko.csv": "乗務日,車番\n2026/10/16,品川100あ1234\n"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []TachoOperation{{Date: "2026-10-16", VehicleNumber: "品川100あ1234"}}, data.Operations)
+	assert.Equal(t, tachoOperations, manifest[0].Type)
+
+	// 置き換えた見出しは判別に使わない
+	_, manifest, err = ParseTachoZip(writeTestZip(t, map[string]string{"unko.csv": "運行日,車番\n2026/10/16,品川100あ1234\n"}))
+	assert.Nil(t, err)
+	assert.Equal(t, tachoUnknown, manifest[0].Type)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// traceNamePattern はトレースのファイル名に使えない文字です
+var traceNamePattern = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// startTrace は BrowserContext の Playwright トレースの記録を開始し、記録を終了する関数を返します
+// 終了する関数には実行結果のエラーを渡します。失敗した場合（または keepTraceOnSuccess の場合）は
+// ジョブの作業ディレクトリの traces/<name>.zip に保存し、成功した場合は破棄します
+// 終了する関数は最初の呼び出しだけが有効です（キャンセルで BrowserContext を閉じる前と、実行の終了時の両方から呼び出すため）
+// トレースを記録しない設定の場合や開始に失敗した場合は何もしない関数を返します
+func startTrace(job *Job, bc playwright.BrowserContext, name string) func(err error) {
+	if !cfg.Browser.Tracing {
+		return func(error) {}
+	}
+	tracing := bc.Tracing()
+	err := tracing.Start(playwright.TracingStartOptions{
+		Title:       playwright.String(name),
+		Screenshots: playwright.Bool(true),
+		Snapshots:   playwright.Bool(true),
+		Sources:     playwright.Bool(true),
+	})
+	if err != nil {
+		job.Logf("トレースの開始に失敗しました: %v", err)
+		return func(error) {}
+	}
+	var once sync.Once
+	return func(runErr error) {
+		once.Do(func() { finishTrace(job, tracing, name, runErr) })
+	}
+}
+
+// finishTrace はトレースの記録を終了し、runErr に応じて保存または破棄します
+func finishTrace(job *Job, tracing playwright.Tracing, name string, runErr error) {
+	if runErr == nil && !cfg.Browser.KeepTraceOnSuccess {
+		// 保存先を指定せずに終了するとトレースは破棄される
+		if err := tracing.Stop(); err != nil {
+			job.Logf("トレースの終了に失敗しました: %v", err)
+		}
+		return
+	}
+	path, err := job.ArtifactPath(artifactTraces, traceNamePattern.ReplaceAllString(name, "_")+".zip")
+	if err != nil {
+		job.Logf("トレースの保存先の作成に失敗しました: %v", err)
+		tracing.Stop()
+		return
+	}
+	if err := tracing.Stop(path); err != nil {
+		job.Logf("トレースの保存に失敗しました: %v", err)
+		return
+	}
+	job.Logf("トレースを '%s' に保存しました。", path)
+}
+
+// traceName は runSite で記録するトレースの名前です（例: etc-meisai-risLoginId）
+func traceName(site *Site, params map[string]string) string {
+	if len(site.Credentials) == 0 || params[site.Credentials[0]] == "" {
+		return site.Name
+	}
+	return fmt.Sprintf("%s-%s", site.Name, params[site.Credentials[0]])
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTracing は Start / Stop の呼び出しを記録する playwright.Tracing のモックです
+type fakeTracing struct {
+	playwright.Tracing
+	started bool
+	stopped bool
+	saved   string
+	closed  *atomic.Bool // true の場合は BrowserContext が閉じられたものとして Stop を失敗させる
+}
+
+func (t *fakeTracing) Start(options ...playwright.TracingStartOptions) error {
+	t.started = true
+	return nil
+}
+
+func (t *fakeTracing) Stop(path ...string) error {
+	if t.closed != nil && t.closed.Load() {
+		return errors.New("Target page, context or browser has been closed")
+	}
+	t.stopped = true
+	if len(path) > 0 {
+		t.saved = path[0]
+		return os.WriteFile(path[0], []byte("trace"), 0644)
+	}
+	return nil
+}
+
+// tracingBrowserContext は Tracing だけを実装した playwright.BrowserContext のモックです
+type tracingBrowserContext struct {
+	playwright.BrowserContext
+	tracing *fakeTracing
+}
+
+func (c *tracingBrowserContext) Tracing() playwright.Tracing {
+	return c.tracing
+}
+
+// closingTraceContext は閉じた後はトレースを保存できない playwright.BrowserContext のモックです
+type closingTraceContext struct {
+	playwright.BrowserContext
+	tracing *fakeTracing
+	closed  atomic.Bool
+}
+
+func (c *closingTraceContext) Tracing() playwright.Tracing {
+	return c.tracing
+}
+
+func (c *closingTraceContext) NewPage() (playwright.Page, error) {
+	return newFakePage(), nil
+}
+
+func (c *closingTraceContext) Close(options ...playwright.BrowserContextCloseOptions) error {
+	c.closed.Store(true)
+	return nil
+}
+
+// tracedBrowser は bctx を BrowserContext として払い出すブラウザです
+type tracedBrowser struct {
+	*fakeBrowser
+	bctx playwright.BrowserContext
+}
+
+func (b *tracedBrowser) NewContext(options ...playwright.BrowserNewContextOptions) (playwright.BrowserContext, error) {
+	return b.bctx, nil
+}
+
+// blockingScraper はキャンセルされるまでログインを終えない Scraper です
+type blockingScraper struct {
+	loggingIn chan struct{}
+}
+
+func (s *blockingScraper) Login(ctx context.Context, _ *ScrapeSession) error {
+	close(s.loggingIn)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingScraper) Navigate(context.Context, *ScrapeSession) error { return nil }
+func (s *blockingScraper) SetRange(context.Context, *ScrapeSession, time.Time, time.Time) error {
+	return nil
+}
+func (s *blockingScraper) Download(context.Context, *ScrapeSession) ([]string, error) {
+	return nil, nil
+}
+func (s *blockingScraper) Logout(context.Context, *ScrapeSession) error { return nil }
+
+func TestStartTrace(t *testing.T) {
+	orig := cfg.Browser
+	t.Cleanup(func() { cfg.Browser = orig })
+	cfg.Browser.Tracing = true
+	cfg.Browser.KeepTraceOnSuccess = false
+
+	store := NewJobStore(t.TempDir())
+	run := func(runErr error) (*Job, *fakeTracing) {
+		job := store.New(jobTypeEtcMeisai, "")
+		bc := &tracingBrowserContext{tracing: &fakeTracing{}}
+		startTrace(job, bc, "etc-meisai-ris/01")(runErr)
+		return job, bc.tracing
+	}
+
+	// 成功した場合は破棄する
+	_, tr := run(nil)
+	assert.True(t, tr.started)
+	assert.True(t, tr.stopped)
+	assert.Empty(t, tr.saved)
+
+	// 失敗した場合はジョブの traces に保存する
+	job, tr := run(errors.New("failed"))
+	assert.Equal(t, filepath.Join(job.Dir(), artifactTraces, "etc-meisai-ris_01.zip"), tr.saved)
+	content, err := os.ReadFile(filepath.Join(job.Dir(), jobLogName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "トレースを")
+
+	// keepTraceOnSuccess の場合は成功しても保存する
+	cfg.Browser.KeepTraceOnSuccess = true
+	_, tr = run(nil)
+	assert.NotEmpty(t, tr.saved)
+
+	// 記録しない設定の場合は開始しない
+	cfg.Browser.Tracing = false
+	_, tr = run(errors.New("failed"))
+	assert.False(t, tr.started)
+	assert.False(t, tr.stopped)
+}
+
+func TestTraceName(t *testing.T) {
+	site, _ := LookupSite(siteEtcMeisai)
+	assert.Equal(t, "etc-meisai-ris01", traceName(site, map[string]string{"risLoginId": "ris01"}))
+	assert.Equal(t, "etc-meisai", traceName(site, nil))
+}
+
+func TestTraceSavedOnCancel(t *testing.T) {
+	orig, origPool := cfg.Browser, browserPool
+	t.Cleanup(func() { cfg.Browser, browserPool = orig, origPool })
+	cfg.Browser.Tracing = true
+	cfg.Browser.KeepTraceOnSuccess = false
+
+	bctx := &closingTraceContext{}
+	bctx.tracing = &fakeTracing{closed: &bctx.closed}
+	browserPool = NewBrowserPool(func() (playwright.Browser, error) {
+		return &tracedBrowser{fakeBrowser: &fakeBrowser{connected: true}, bctx: bctx}, nil
+	}, 1, 0)
+	t.Cleanup(browserPool.Close)
+	scraper := &blockingScraper{loggingIn: make(chan struct{})}
+	site := &Site{Name: "trace-test", Credentials: []string{"userId"}, New: func() (Scraper, error) { return scraper, nil }}
+
+	store := NewJobStore(t.TempDir())
+	now := time.Now()
+	job := store.Start(jobTypeGeneralCsv, "", func(ctx context.Context, job *Job) error {
+		_, err := runSite(ctx, job, site, map[string]string{"userId": "u1"}, now, now)
+		return err
+	})
+	select {
+	case <-scraper.loggingIn:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ログインが開始されませんでした")
+	}
+
+	// キャンセルでプールが BrowserContext を閉じる前にトレースを保存する
+	assert.True(t, job.Cancel())
+	assert.Eventually(t, func() bool { return job.Info().EndedAt != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, JobCanceled, job.Info().Status)
+	assert.True(t, bctx.closed.Load())
+	assert.Equal(t, filepath.Join(job.Dir(), artifactTraces, "trace-test-u1.zip"), bctx.tracing.saved)
+	assert.FileExists(t, bctx.tracing.saved)
+}